@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MaxSmoot/NES_Emulator/nes"
+)
+
+// breakpoint stops execution when the cpu is about to run the instruction at addr
+type breakpoint struct {
+	number    int
+	addr      uint16
+	temporary bool //deleted once it is hit (tbreak)
+	enabled   bool
+	hits      int //times the cpu reached it, ignored hits included
+	ignore    int //hits left to ignore before it stops execution
+}
+
+var breakpoints []*breakpoint
+var nextBreakpoint = 1
+
+// breakAt marks the addresses with an enabled breakpoint,
+// the execution loop checks it after every instruction so free running stays fast
+var breakAt [0x10000]bool
+
+// labels are names for addresses usable in place of a number (EX: b main), loaded with --labels
+var labels = map[string]uint16{}
+
+// loadLabels reads a VICE label file (ld65 -Ln), lines look like "al 00C000 .main"
+func loadLabels(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("couldn't load labels: %s", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 || fields[0] != "al" {
+			return fmt.Errorf("couldn't load labels, %s:%d isn't \"al <address> .<name>\"", path, line)
+		}
+		addr, err := strconv.ParseUint(fields[1], 16, 32)
+		if err != nil || addr > 0xFFFF {
+			return fmt.Errorf("couldn't load labels, %s:%d has an invalid address", path, line)
+		}
+		labels[strings.TrimPrefix(fields[2], ".")] = uint16(addr)
+	}
+	return scanner.Err()
+}
+
+// getAddressArgument returns the address of a number, a label or one of the vectors (nmi, reset and irq)
+func getAddressArgument(arg string) (uint16, error) {
+	if addr, err := getNumberArgument(arg); err == nil {
+		return addr, nil
+	}
+	if addr, ok := labels[arg]; ok {
+		return addr, nil
+	}
+	vectors := map[string]uint16{"nmi": 0xFFFA, "reset": 0xFFFC, "irq": 0xFFFE}
+	if vector, ok := vectors[strings.ToLower(arg)]; ok {
+		return uint16(bus.PeekCPUByte(vector)) | uint16(bus.PeekCPUByte(vector+1))<<8, nil
+	}
+	return 0, fmt.Errorf("no label or address %q", arg)
+}
+
+// labelFor returns the name of an address or "" if it has none
+func labelFor(addr uint16) string {
+	names := []string{}
+	for name, labelAddr := range labels {
+		if labelAddr == addr {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// formatAddress formats an address with its label (EX: 0xC000 <main>)
+func formatAddress(addr uint16) string {
+	if label := labelFor(addr); label != "" {
+		return fmt.Sprintf("0x%04X <%s>", addr, label)
+	}
+	return fmt.Sprintf("0x%04X", addr)
+}
+
+// updateBreakAt rebuilds breakAt from the enabled breakpoints
+func updateBreakAt() {
+	breakAt = [0x10000]bool{}
+	for _, bp := range breakpoints {
+		if bp.enabled {
+			breakAt[bp.addr] = true
+		}
+	}
+}
+
+// breakCmd adds a breakpoint
+// b <address or label>, tbreak <address or label>
+func breakCmd(args []string, temporary bool) {
+	if len(args) != 2 {
+		fmt.Println("Usage: " + args[0] + " <address or label>")
+		return
+	}
+	addr, err := getAddressArgument(args[1])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	bp := addBreakpoint(addr, temporary)
+	kind := "Breakpoint"
+	if temporary {
+		kind = "Temporary breakpoint"
+	}
+	fmt.Printf("%s %d at %s\n", kind, bp.number, formatAddress(addr))
+}
+
+// addBreakpoint adds an enabled breakpoint at addr with the next number
+func addBreakpoint(addr uint16, temporary bool) *breakpoint {
+	bp := &breakpoint{number: nextBreakpoint, addr: addr, temporary: temporary, enabled: true}
+	nextBreakpoint++
+	breakpoints = append(breakpoints, bp)
+	updateBreakAt()
+	return bp
+}
+
+// selectBreakpoints returns the breakpoints numbered in args, or all of them if there are no numbers
+func selectBreakpoints(args []string) ([]*breakpoint, error) {
+	if len(args) == 0 {
+		return breakpoints, nil
+	}
+	var selected []*breakpoint
+	for _, arg := range args {
+		number, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid breakpoint number %q", arg)
+		}
+		bp := findBreakpoint(number)
+		if bp == nil {
+			return nil, fmt.Errorf("no breakpoint number %d", number)
+		}
+		selected = append(selected, bp)
+	}
+	return selected, nil
+}
+
+func findBreakpoint(number int) *breakpoint {
+	for _, bp := range breakpoints {
+		if bp.number == number {
+			return bp
+		}
+	}
+	return nil
+}
+
+func deleteBreakpoint(bp *breakpoint) {
+	for i := range breakpoints {
+		if breakpoints[i] == bp {
+			breakpoints = append(breakpoints[:i], breakpoints[i+1:]...)
+			break
+		}
+	}
+	updateBreakAt()
+}
+
+// deleteCmd deletes breakpoints, all of them if no numbers are given
+// delete [number...]
+func deleteCmd(args []string) {
+	selected, err := selectBreakpoints(args[1:])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, bp := range append([]*breakpoint(nil), selected...) {
+		deleteBreakpoint(bp)
+	}
+}
+
+// enableCmd enables or disables breakpoints, all of them if no numbers are given
+// enable [number...], disable [number...]
+func enableCmd(args []string, enabled bool) {
+	selected, err := selectBreakpoints(args[1:])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, bp := range selected {
+		bp.enabled = enabled
+	}
+	updateBreakAt()
+}
+
+// ignoreCmd makes a breakpoint let the next count hits through
+// ignore <number> <count>
+func ignoreCmd(args []string) {
+	if len(args) != 3 {
+		fmt.Println("Usage: ignore <breakpoint number> <count>")
+		return
+	}
+	selected, err := selectBreakpoints(args[1:2])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	count, err := strconv.Atoi(args[2])
+	if err != nil || count < 0 {
+		fmt.Println("Invalid ignore count " + args[2])
+		return
+	}
+	selected[0].ignore = count
+	fmt.Printf("Will ignore next %d crossings of breakpoint %d.\n", count, selected[0].number)
+}
+
+// printBreakpoints lists the breakpoints like GDB's info breakpoints
+func printBreakpoints() {
+	if len(breakpoints) == 0 {
+		fmt.Println("No breakpoints.")
+		return
+	}
+	fmt.Println("Num\tDisp\tEnb\tAddress")
+	for _, bp := range breakpoints {
+		disp, enb := "keep", "y"
+		if bp.temporary {
+			disp = "del"
+		}
+		if !bp.enabled {
+			enb = "n"
+		}
+		fmt.Printf("%d\t%s\t%s\t%s\n", bp.number, disp, enb, formatAddress(bp.addr))
+		if bp.hits == 1 {
+			fmt.Println("\tbreakpoint already hit 1 time")
+		} else if bp.hits > 1 {
+			fmt.Printf("\tbreakpoint already hit %d times\n", bp.hits)
+		}
+		if bp.ignore > 0 {
+			fmt.Printf("\twill ignore next %d crossings of breakpoint\n", bp.ignore)
+		}
+	}
+}
+
+// checkBreakpoints counts a hit on every enabled breakpoint at PC
+// and returns the one that stops execution, nil if they were all ignored
+func checkBreakpoints(pc uint16) *breakpoint {
+	var stop *breakpoint
+	for _, bp := range append([]*breakpoint(nil), breakpoints...) {
+		if !bp.enabled || bp.addr != pc {
+			continue
+		}
+		bp.hits++
+		if bp.ignore > 0 {
+			bp.ignore--
+			continue
+		}
+		if stop == nil {
+			stop = bp
+		}
+		if bp.temporary {
+			deleteBreakpoint(bp)
+		}
+	}
+	return stop
+}
+
+// printBreakpointHit prints the breakpoint execution stopped on
+func printBreakpointHit(bp *breakpoint) {
+	kind := "Breakpoint"
+	if bp.temporary {
+		kind = "Temporary breakpoint"
+	}
+	fmt.Printf("%s %d, %s\n", kind, bp.number, formatAddress(bp.addr))
+}
+
+// continueCmd runs until a breakpoint is hit, the cpu halts or PC gets stuck in a trap loop
+// c, continue, run
+func continueCmd() {
+	totalCycles := 0
+	for {
+		if tracing {
+			fmt.Println(nes.TraceLine(cpu))
+		}
+		step, err := bus.Step()
+		totalCycles += step.Cycles
+		if err != nil {
+			printFault(err)
+			break
+		}
+		if breakAt[cpu.PC] {
+			if bp := checkBreakpoints(cpu.PC); bp != nil {
+				printBreakpointHit(bp)
+				break
+			}
+		}
+		//an instruction that leaves PC where it was is a trap loop (EX: JMP *)
+		if step.After.PC == step.PC {
+			fmt.Printf("PC stuck on %04X\n", cpu.PC)
+			break
+		}
+	}
+	fmt.Println("Total Cycles", totalCycles)
+	printCurrentInstr()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MaxSmoot/NES_Emulator/nes"
+)
+
+// clearBreakpoints resets the debugger's breakpoints and labels between tests
+func clearBreakpoints() {
+	breakpoints = nil
+	nextBreakpoint = 1
+	labels = map[string]uint16{}
+	updateBreakAt()
+}
+
+func TestLoadLabels(t *testing.T) {
+	clearBreakpoints()
+	path := filepath.Join(t.TempDir(), "game.lbl")
+	os.WriteFile(path, []byte("al 00C000 .main\n\nal 000010 .counter\nal 00FFFA .nmi_vector\n"), 0644)
+	if err := loadLabels(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) != 3 || labels["main"] != 0xC000 || labels["counter"] != 0x0010 || labels["nmi_vector"] != 0xFFFA {
+		t.Errorf("loaded labels %v", labels)
+	}
+	if formatAddress(0xC000) != "0xC000 <main>" || formatAddress(0xC001) != "0xC001" {
+		t.Errorf("addresses formatted as %q and %q", formatAddress(0xC000), formatAddress(0xC001))
+	}
+
+	tests := []struct {
+		name, contents, err string
+	}{
+		{"format", "al 00C000 .main\nadd_label C000 main\n", ":2 isn't"},
+		{"address", "al 01C000 .main\n", ":1 has an invalid address"},
+		{"hex", "al C0Z0 .main\n", ":1 has an invalid address"},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), test.name+".lbl")
+		os.WriteFile(path, []byte(test.contents), 0644)
+		if err := loadLabels(path); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: returned %v, expected %q", test.name, err, test.err)
+		}
+	}
+	if err := loadLabels(filepath.Join(t.TempDir(), "missing.lbl")); err == nil {
+		t.Error("loading a missing file didn't fail")
+	}
+}
+
+func TestGetAddressArgument(t *testing.T) {
+	clearBreakpoints()
+	labels["main"] = 0xC000
+	flatBus := nes.CreateFlatBus(nes.NMOS6502)
+	flatBus.Load([]byte{0x00, 0x90, 0x34, 0x12, 0x78, 0x56}, 0xFFFA)
+	bus = flatBus
+	defer func() { bus = nil }()
+	tests := []struct {
+		arg  string
+		addr uint16
+	}{
+		{"0x8000", 0x8000},
+		{"main", 0xC000},
+		{"nmi", 0x9000},
+		{"RESET", 0x1234},
+		{"irq", 0x5678},
+	}
+	for _, test := range tests {
+		if addr, err := getAddressArgument(test.arg); err != nil || addr != test.addr {
+			t.Errorf("%q is %04X, %v, expected %04X", test.arg, addr, err, test.addr)
+		}
+	}
+	if _, err := getAddressArgument("nowhere"); err == nil {
+		t.Error("an unknown label didn't fail")
+	}
+}
+
+func TestCheckBreakpoints(t *testing.T) {
+	clearBreakpoints()
+	ignored := addBreakpoint(0x8000, false)
+	ignored.ignore = 2
+	temporary := addBreakpoint(0x8000, true)
+	disabled := addBreakpoint(0x9000, false)
+	disabled.enabled = false
+	updateBreakAt()
+	if !breakAt[0x8000] || breakAt[0x9000] {
+		t.Fatal("breakAt doesn't match the enabled breakpoints")
+	}
+
+	if bp := checkBreakpoints(0x9000); bp != nil || disabled.hits != 0 {
+		t.Errorf("disabled breakpoint stopped on %v with %d hits", bp, disabled.hits)
+	}
+	//the temporary breakpoint stops the first time and is deleted, the other one is still ignoring hits
+	if bp := checkBreakpoints(0x8000); bp != temporary {
+		t.Fatalf("first hit stopped on %+v", bp)
+	}
+	if findBreakpoint(temporary.number) != nil {
+		t.Error("temporary breakpoint wasn't deleted after it was hit")
+	}
+	if bp := checkBreakpoints(0x8000); bp != nil {
+		t.Errorf("second hit stopped on breakpoint %d while it was ignored", bp.number)
+	}
+	if bp := checkBreakpoints(0x8000); bp != ignored || ignored.hits != 3 || ignored.ignore != 0 {
+		t.Errorf("third hit stopped on %+v", bp)
+	}
+	if bp := checkBreakpoints(0x8001); bp != nil {
+		t.Errorf("stopped on breakpoint %d at another address", bp.number)
+	}
+}
+
+func TestSelectBreakpoints(t *testing.T) {
+	clearBreakpoints()
+	first := addBreakpoint(0x8000, false)
+	addBreakpoint(0x8010, false)
+	if selected, err := selectBreakpoints(nil); err != nil || len(selected) != 2 {
+		t.Errorf("selecting all returned %d breakpoints, %v", len(selected), err)
+	}
+	if selected, err := selectBreakpoints([]string{"1"}); err != nil || len(selected) != 1 || selected[0] != first {
+		t.Errorf("selecting 1 returned %v, %v", selected, err)
+	}
+	for _, arg := range []string{"3", "one"} {
+		if _, err := selectBreakpoints([]string{arg}); err == nil {
+			t.Errorf("selecting %q didn't fail", arg)
+		}
+	}
+	deleteBreakpoint(first)
+	if len(breakpoints) != 1 || breakAt[0x8000] {
+		t.Error("deleting breakpoint 1 left it in place")
+	}
+}
@@ -0,0 +1,136 @@
+// nestest runs NES test roms headlessly and prints a pass/fail table
+// roms report their result through the $6000 status byte and the text at $6004 (blargg's protocol),
+// roms that never report time out
+// usage: nestest [--timeout=<seconds>] [--junit=<file>] <rom or directory> [...]
+// --timeout=<seconds>, emulated seconds a rom gets before it times out (default 30)
+// --junit=<file>, also writes the results as JUnit XML
+// directories are searched for .nes files recursively
+// exits with 1 if any rom didn't pass
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MaxSmoot/NES_Emulator/nes"
+)
+
+const ntscClockRate = 1789773 //cpu cycles per second
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name    string        `xml:"name,attr"`
+	Time    float64       `xml:"time,attr"`
+	Failure *junitFailure `xml:"failure,omitempty"`
+	Error   *junitFailure `xml:"error,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName  xml.Name        `xml:"testsuite"`
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Time     float64         `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+func main() {
+	timeout := flag.Float64("timeout", 30, "Emulated seconds a rom gets before it times out")
+	junitPath := flag.String("junit", "", "Write the results as JUnit XML to this file")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: nestest [--timeout=<seconds>] [--junit=<file>] <rom or directory> [...]")
+		os.Exit(2)
+	}
+	var roms []string
+	for _, path := range flag.Args() {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if !info.IsDir() {
+			roms = append(roms, path)
+			continue
+		}
+		found, err := nes.FindTestROMs(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		roms = append(roms, found...)
+	}
+
+	maxCycles := uint64(*timeout * ntscClockRate)
+	suite := junitTestSuite{Name: "nestest"}
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "RESULT\tROM\tCYCLES\tMESSAGE")
+	passed := 0
+	start := time.Now()
+	for _, rom := range roms {
+		romStart := time.Now()
+		result := nes.RunTestROM(rom, maxCycles)
+		message := strings.Join(strings.Fields(result.Message), " ") //the text is often several lines
+		fmt.Fprintf(table, "%s\t%s\t%d\t%s\n", result.Outcome, rom, result.Cycles, message)
+
+		testCase := junitTestCase{Name: rom, Time: time.Since(romStart).Seconds()}
+		failure := &junitFailure{result.Outcome.String(), result.Message}
+		if result.Code != 0 {
+			failure.Message = fmt.Sprintf("%s (code %d)", result.Outcome, result.Code)
+		}
+		switch result.Outcome {
+		case nes.TestROMPassed:
+			passed++
+		case nes.TestROMError:
+			testCase.Error = failure
+			suite.Errors++
+		default:
+			testCase.Failure = failure
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	table.Flush()
+	fmt.Printf("%d/%d passed\n", passed, len(roms))
+
+	if *junitPath != "" {
+		suite.Tests = len(roms)
+		suite.Time = time.Since(start).Seconds()
+		if err := writeJUnit(*junitPath, suite); err != nil {
+			fmt.Fprintf(os.Stderr, "couldn't write JUnit XML: %s\n", err)
+			os.Exit(2)
+		}
+	}
+	if passed != len(roms) {
+		os.Exit(1)
+	}
+}
+
+// writeJUnit writes suite to path as JUnit XML
+func writeJUnit(path string, suite junitTestSuite) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.WriteString(xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(file)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suite); err != nil {
+		return err
+	}
+	_, err = file.WriteString("\n")
+	return err
+}
@@ -0,0 +1,141 @@
+// nsfplay renders a track of an NSF or NSFe file to a WAV file
+// usage: nsfplay [--track n] [--seconds s] [--rate hz] [--list] [-o out.wav] <file.nsf>
+// --track, track to render (1 based), defaults to the file's starting track
+// --seconds, length to render, defaults to the NSFe track time or 120 seconds
+// --rate, sample rate of the WAV file
+// --list, print the file's information and tracks instead of rendering
+// -o, output path, defaults to the input name with the extension replaced by .wav
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MaxSmoot/NES_Emulator/nes"
+)
+
+const defaultSeconds = 120
+
+func main() {
+	track := flag.Int("track", 0, "Track to render (1 based), defaults to the file's starting track")
+	seconds := flag.Float64("seconds", 0, "Seconds to render, defaults to the NSFe track time or 120")
+	rate := flag.Int("rate", 44100, "Sample rate of the WAV file")
+	list := flag.Bool("list", false, "Print the file's information and tracks")
+	output := flag.String("o", "", "Output WAV path, defaults to <file>.wav")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: nsfplay [--track n] [--seconds s] [--rate hz] [--list] [-o out.wav] <file.nsf>")
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	nsf, err := nes.ParseNSF(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+		os.Exit(1)
+	}
+	if *list {
+		printInfo(nsf)
+		return
+	}
+	if unsupported := nsf.UnsupportedChips(); unsupported != 0 {
+		fmt.Fprintf(os.Stderr, "warning: %s expansion audio isn't supported and will be silent\n", unsupported)
+	}
+
+	player, err := nes.CreateNSFPlayer(nsf, *rate)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *track != 0 {
+		if err := player.SelectTrack(*track); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	length := *seconds
+	if length <= 0 {
+		length = defaultSeconds
+		if ms := nsf.TrackTime(player.Track()); ms > 0 {
+			length = float64(ms) / 1000
+		}
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(path, filepath.Ext(path)) + ".wav"
+	}
+	samples := make([]float32, int(length*float64(*rate)))
+	if err := player.Render(samples); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", err)
+	}
+	if err := writeWAV(*output, samples, *rate); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("rendered track %d (%.1fs) to %s\n", player.Track(), length, *output)
+}
+
+// printInfo prints the file's header and NSFe track information
+func printInfo(nsf *nes.NSF) {
+	fmt.Printf("Title: %s\n", nsf.Title)
+	fmt.Printf("Artist: %s\n", nsf.Artist)
+	fmt.Printf("Copyright: %s\n", nsf.Copyright)
+	if nsf.Ripper != "" {
+		fmt.Printf("Ripper: %s\n", nsf.Ripper)
+	}
+	fmt.Printf("Region: %s\n", nsf.Region)
+	fmt.Printf("Expansion Audio: %s\n", nsf.Chips)
+	fmt.Printf("Load: $%04X Init: $%04X Play: $%04X\n", nsf.LoadAddr, nsf.InitAddr, nsf.PlayAddr)
+	fmt.Printf("Bank Switched: %t\n", nsf.Banked)
+	fmt.Printf("Tracks: %d (starting track %d)\n", nsf.Songs, nsf.StartSong)
+	for track := 1; track <= nsf.Songs; track++ {
+		line := fmt.Sprintf("  %3d", track)
+		if label := nsf.TrackLabel(track); label != "" {
+			line += " " + label
+		}
+		if ms := nsf.TrackTime(track); ms >= 0 {
+			line += fmt.Sprintf(" (%d:%02d)", ms/60000, ms/1000%60)
+		}
+		fmt.Println(line)
+	}
+}
+
+// writeWAV writes samples as a mono 16 bit PCM WAV file
+func writeWAV(path string, samples []float32, rate int) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	out := bufio.NewWriter(file)
+	dataSize := uint32(len(samples) * 2)
+	header := []interface{}{
+		[]byte("RIFF"), 36 + dataSize, []byte("WAVE"),
+		[]byte("fmt "), uint32(16), uint16(1), uint16(1), uint32(rate), uint32(rate * 2), uint16(2), uint16(16),
+		[]byte("data"), dataSize,
+	}
+	for _, field := range header {
+		if err := binary.Write(out, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+	for _, sample := range samples {
+		value := math.Max(-1, math.Min(1, float64(sample)))
+		if err := binary.Write(out, binary.LittleEndian, int16(value*math.MaxInt16)); err != nil {
+			return err
+		}
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
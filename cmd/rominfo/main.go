@@ -0,0 +1,67 @@
+// rominfo prints information about NES roms
+// the rom's mapper doesn't need to be supported by the emulator
+// usage: rominfo [--json] [--autopatch] <rom> [rom...]
+// --json, prints each rom's info as a JSON object (an array when multiple roms are given)
+// --autopatch, applies <rom>.ips, <rom>.ups and <rom>.bps patches found alongside the rom first
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/MaxSmoot/NES_Emulator/nes"
+)
+
+func main() {
+	asJSON := flag.Bool("json", false, "Print rom information as JSON")
+	autoPatch := flag.Bool("autopatch", false, "Apply <rom>.ips, <rom>.ups and <rom>.bps patches found alongside the rom")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: rominfo [--json] [--autopatch] <rom> [rom...]")
+		os.Exit(2)
+	}
+	exitCode := 0
+	var infos []nes.CartridgeInfo
+	for _, romPath := range flag.Args() {
+		var patches []string
+		if *autoPatch {
+			patches = nes.FindPatches(romPath)
+		}
+		romBuffer, err := nes.ReadRomFile(romPath, patches)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", romPath, err)
+			exitCode = 1
+			continue
+		}
+		info, err := nes.ReadCartInfo(romBuffer)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", romPath, err)
+			exitCode = 1
+			continue
+		}
+		if *asJSON {
+			infos = append(infos, info)
+			continue
+		}
+		fmt.Println(romPath)
+		fmt.Println(info)
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		var err error
+		if len(infos) == 1 {
+			err = encoder.Encode(infos[0])
+		} else {
+			err = encoder.Encode(infos)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	os.Exit(exitCode)
+}
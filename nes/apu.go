@@ -0,0 +1,599 @@
+package nes
+
+// APU is the 2A03's audio processing unit
+// two pulse channels, a triangle channel, a noise channel and a delta modulation channel (DMC)
+// $4000-$4013 configure the channels, $4015 enables them and reports their status
+// and $4017 controls the frame counter that clocks envelopes, sweeps and length counters
+type APU struct {
+	Pulse1   pulseChannel
+	Pulse2   pulseChannel
+	Triangle triangleChannel
+	Noise    noiseChannel
+	DMC      dmcChannel
+
+	frameCycle    int  // cpu cycles since the frame counter was reset
+	fiveStep      bool // $4017 bit 7, 5 step sequence instead of 4 step
+	irqInhibit    bool // $4017 bit 6
+	frameIRQ      bool
+	evenCycle     bool // pulse, noise and DMC timers are clocked every other cpu cycle
+	pendingReset  int  // cpu cycles until a $4017 write resets the frame counter
+	readMemory    func(addr uint16) uint8
+	frameCounterW uint8 // value written to $4017, applied when pendingReset reaches 0
+}
+
+// length counter values loaded from the upper 5 bits of $4003, $4007, $400B and $400F
+var lengthTable = [32]uint8{
+	10, 254, 20, 2, 40, 4, 80, 6, 160, 8, 60, 10, 14, 12, 26, 14,
+	12, 16, 24, 18, 48, 20, 96, 22, 192, 24, 72, 26, 16, 28, 32, 30,
+}
+
+// pulse duty cycle sequences
+var dutyTable = [4][8]uint8{
+	{0, 1, 0, 0, 0, 0, 0, 0},
+	{0, 1, 1, 0, 0, 0, 0, 0},
+	{0, 1, 1, 1, 1, 0, 0, 0},
+	{1, 0, 0, 1, 1, 1, 1, 1},
+}
+
+// 32 step triangle wave
+var triangleTable = [32]uint8{
+	15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0,
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+}
+
+// noise timer periods in cpu cycles (NTSC)
+var noiseTable = [16]uint16{4, 8, 16, 32, 64, 96, 128, 160, 202, 254, 380, 508, 762, 1016, 2034, 4068}
+
+// DMC timer periods in cpu cycles (NTSC)
+var dmcTable = [16]uint16{428, 380, 340, 320, 286, 254, 226, 214, 190, 160, 142, 128, 106, 84, 72, 54}
+
+// frame counter step timings in cpu cycles (NTSC)
+const (
+	frameStep1    = 7457
+	frameStep2    = 14913
+	frameStep3    = 22371
+	frameStep4    = 29829 //last step of the 4 step sequence
+	frameStep5    = 37281 //last step of the 5 step sequence
+	frameLength4  = 29830
+	frameLength5  = 37282
+	frameIRQStart = 29828 //the frame IRQ flag is set on the last 3 cycles of the 4 step sequence
+)
+
+// CreateAPU creates an APU, readMemory is used by the DMC to fetch samples
+func CreateAPU(readMemory func(addr uint16) uint8) *APU {
+	apu := new(APU)
+	apu.readMemory = readMemory
+	apu.Noise.shift = 1
+	apu.Pulse1.onesComplement = true //pulse 1's sweep subtracts one more than pulse 2's
+	return apu
+}
+
+// PowerOn puts the APU in its power up state, every channel silent and the frame counter in 4 step mode
+func (apu *APU) PowerOn() {
+	*apu = *CreateAPU(apu.readMemory)
+}
+
+// Reset is the reset button, it silences every channel, clears the frame IRQ
+// and restarts the frame counter with the last value written to $4017
+func (apu *APU) Reset() {
+	apu.WriteRegister(0x4015, 0)
+	apu.frameIRQ = false
+	apu.WriteRegister(0x4017, apu.frameCounterW)
+}
+
+// envelope generates a decaying volume or a constant volume
+type envelope struct {
+	start    bool
+	loop     bool // also halts the length counter
+	constant bool
+	volume   uint8 // constant volume or the envelope's period
+	divider  uint8
+	decay    uint8
+}
+
+// clock is called every quarter frame
+func (env *envelope) clock() {
+	if env.start {
+		env.start = false
+		env.decay = 15
+		env.divider = env.volume
+		return
+	}
+	if env.divider > 0 {
+		env.divider--
+		return
+	}
+	env.divider = env.volume
+	if env.decay > 0 {
+		env.decay--
+	} else if env.loop {
+		env.decay = 15
+	}
+}
+
+// output returns the current volume
+func (env *envelope) output() uint8 {
+	if env.constant {
+		return env.volume
+	}
+	return env.decay
+}
+
+type pulseChannel struct {
+	enabled        bool
+	duty           uint8
+	dutyPos        uint8
+	env            envelope
+	timer          uint16
+	period         uint16 // 11 bits
+	length         uint8
+	sweepEnabled   bool
+	sweepPeriod    uint8
+	sweepNegate    bool
+	sweepShift     uint8
+	sweepDivider   uint8
+	sweepReload    bool
+	onesComplement bool
+	noSweep        bool // MMC5 pulses have no sweep unit and are never muted by it
+}
+
+// writeRegister handles writes to the 4 pulse registers (reg 0-3)
+func (pulse *pulseChannel) writeRegister(reg uint16, value uint8) {
+	switch reg {
+	case 0:
+		pulse.duty = value >> 6
+		pulse.env.loop = getBit(5, value)
+		pulse.env.constant = getBit(4, value)
+		pulse.env.volume = value & 0x0F
+	case 1:
+		if pulse.noSweep {
+			return
+		}
+		pulse.sweepEnabled = getBit(7, value)
+		pulse.sweepPeriod = (value >> 4) & 0x7
+		pulse.sweepNegate = getBit(3, value)
+		pulse.sweepShift = value & 0x7
+		pulse.sweepReload = true
+	case 2:
+		pulse.period = pulse.period&0x0700 | uint16(value)
+	case 3:
+		pulse.period = pulse.period&0x00FF | uint16(value&0x7)<<8
+		if pulse.enabled {
+			pulse.length = lengthTable[value>>3]
+		}
+		pulse.dutyPos = 0
+		pulse.env.start = true
+	}
+}
+
+// clockTimer is called every other cpu cycle
+func (pulse *pulseChannel) clockTimer() {
+	if pulse.timer == 0 {
+		pulse.timer = pulse.period
+		pulse.dutyPos = (pulse.dutyPos + 1) & 0x7
+	} else {
+		pulse.timer--
+	}
+}
+
+// sweepTarget returns the period the sweep unit is moving towards
+func (pulse *pulseChannel) sweepTarget() uint16 {
+	change := pulse.period >> pulse.sweepShift
+	if !pulse.sweepNegate {
+		return pulse.period + change
+	}
+	if pulse.onesComplement {
+		change++
+	}
+	if change > pulse.period {
+		return 0
+	}
+	return pulse.period - change
+}
+
+// clockSweep is called every half frame
+func (pulse *pulseChannel) clockSweep() {
+	if pulse.sweepDivider == 0 && pulse.sweepEnabled && pulse.sweepShift > 0 && !pulse.muted() {
+		pulse.period = pulse.sweepTarget()
+	}
+	if pulse.sweepDivider == 0 || pulse.sweepReload {
+		pulse.sweepDivider = pulse.sweepPeriod
+		pulse.sweepReload = false
+	} else {
+		pulse.sweepDivider--
+	}
+}
+
+// clockLength is called every half frame
+func (pulse *pulseChannel) clockLength() {
+	if !pulse.env.loop && pulse.length > 0 {
+		pulse.length--
+	}
+}
+
+// muted returns true if the period is too low or the sweep would overflow it
+func (pulse *pulseChannel) muted() bool {
+	if pulse.noSweep {
+		return false
+	}
+	return pulse.period < 8 || pulse.sweepTarget() > 0x7FF
+}
+
+func (pulse *pulseChannel) output() uint8 {
+	if !pulse.enabled || pulse.length == 0 || pulse.muted() || dutyTable[pulse.duty][pulse.dutyPos] == 0 {
+		return 0
+	}
+	return pulse.env.output()
+}
+
+type triangleChannel struct {
+	enabled       bool
+	control       bool // halts the length counter and controls the linear counter reload
+	linearPeriod  uint8
+	linearCounter uint8
+	linearReload  bool
+	timer         uint16
+	period        uint16
+	length        uint8
+	step          uint8
+}
+
+func (tri *triangleChannel) writeRegister(reg uint16, value uint8) {
+	switch reg {
+	case 0:
+		tri.control = getBit(7, value)
+		tri.linearPeriod = value & 0x7F
+	case 2:
+		tri.period = tri.period&0x0700 | uint16(value)
+	case 3:
+		tri.period = tri.period&0x00FF | uint16(value&0x7)<<8
+		if tri.enabled {
+			tri.length = lengthTable[value>>3]
+		}
+		tri.linearReload = true
+	}
+}
+
+// clockTimer is called every cpu cycle, the sequencer only moves
+// while both the length and linear counters are non zero
+func (tri *triangleChannel) clockTimer() {
+	if tri.timer == 0 {
+		tri.timer = tri.period
+		if tri.length > 0 && tri.linearCounter > 0 {
+			tri.step = (tri.step + 1) & 0x1F
+		}
+	} else {
+		tri.timer--
+	}
+}
+
+// clockLinear is called every quarter frame
+func (tri *triangleChannel) clockLinear() {
+	if tri.linearReload {
+		tri.linearCounter = tri.linearPeriod
+	} else if tri.linearCounter > 0 {
+		tri.linearCounter--
+	}
+	if !tri.control {
+		tri.linearReload = false
+	}
+}
+
+func (tri *triangleChannel) clockLength() {
+	if !tri.control && tri.length > 0 {
+		tri.length--
+	}
+}
+
+func (tri *triangleChannel) output() uint8 {
+	if tri.period < 2 {
+		return 7 //ultrasonic periods are silenced, games use them to stop the channel
+	}
+	return triangleTable[tri.step]
+}
+
+type noiseChannel struct {
+	enabled bool
+	env     envelope
+	mode    bool // short 93 step sequence instead of 32767 steps
+	period  uint16
+	timer   uint16
+	shift   uint16
+	length  uint8
+}
+
+func (noise *noiseChannel) writeRegister(reg uint16, value uint8) {
+	switch reg {
+	case 0:
+		noise.env.loop = getBit(5, value)
+		noise.env.constant = getBit(4, value)
+		noise.env.volume = value & 0x0F
+	case 2:
+		noise.mode = getBit(7, value)
+		noise.period = noiseTable[value&0x0F]
+	case 3:
+		if noise.enabled {
+			noise.length = lengthTable[value>>3]
+		}
+		noise.env.start = true
+	}
+}
+
+// clockTimer is called every other cpu cycle, the period table is in cpu cycles so it is halved
+func (noise *noiseChannel) clockTimer() {
+	if noise.timer == 0 {
+		noise.timer = noise.period/2 - 1
+		bit := uint16(1)
+		if noise.mode {
+			bit = 6
+		}
+		feedback := (noise.shift ^ (noise.shift >> bit)) & 1
+		noise.shift = noise.shift>>1 | feedback<<14
+	} else {
+		noise.timer--
+	}
+}
+
+func (noise *noiseChannel) clockLength() {
+	if !noise.env.loop && noise.length > 0 {
+		noise.length--
+	}
+}
+
+func (noise *noiseChannel) output() uint8 {
+	if !noise.enabled || noise.length == 0 || noise.shift&1 > 0 {
+		return 0
+	}
+	return noise.env.output()
+}
+
+type dmcChannel struct {
+	enabled       bool
+	irqEnabled    bool
+	loop          bool
+	irq           bool
+	period        uint16
+	timer         uint16
+	level         uint8 // 7 bit output level
+	sampleAddr    uint16
+	sampleLength  uint16
+	currentAddr   uint16
+	bytesLeft     uint16
+	buffer        uint8
+	bufferFull    bool
+	shift         uint8
+	bitsLeft      uint8
+	silence       bool
+	lastFetchAddr uint16
+}
+
+func (dmc *dmcChannel) writeRegister(reg uint16, value uint8) {
+	switch reg {
+	case 0:
+		dmc.irqEnabled = getBit(7, value)
+		dmc.loop = getBit(6, value)
+		dmc.period = dmcTable[value&0x0F]
+		if !dmc.irqEnabled {
+			dmc.irq = false
+		}
+	case 1:
+		dmc.level = value & 0x7F
+	case 2:
+		dmc.sampleAddr = 0xC000 | uint16(value)<<6
+	case 3:
+		dmc.sampleLength = uint16(value)<<4 | 1
+	}
+}
+
+// restart starts playing the sample from the beginning
+func (dmc *dmcChannel) restart() {
+	dmc.currentAddr = dmc.sampleAddr
+	dmc.bytesLeft = dmc.sampleLength
+}
+
+// fetch refills the sample buffer from memory when it is empty
+func (dmc *dmcChannel) fetch(readMemory func(addr uint16) uint8) {
+	if dmc.bufferFull || dmc.bytesLeft == 0 {
+		return
+	}
+	dmc.lastFetchAddr = dmc.currentAddr
+	dmc.buffer = readMemory(dmc.currentAddr)
+	dmc.bufferFull = true
+	dmc.currentAddr++
+	if dmc.currentAddr == 0 {
+		dmc.currentAddr = 0x8000 //wraps to $8000 rather than $0000
+	}
+	dmc.bytesLeft--
+	if dmc.bytesLeft == 0 {
+		if dmc.loop {
+			dmc.restart()
+		} else if dmc.irqEnabled {
+			dmc.irq = true
+		}
+	}
+}
+
+// clockTimer is called every other cpu cycle, the rate table is in cpu cycles so it is halved
+func (dmc *dmcChannel) clockTimer(readMemory func(addr uint16) uint8) {
+	if dmc.timer > 0 {
+		dmc.timer--
+		return
+	}
+	dmc.timer = dmc.period/2 - 1
+	if !dmc.silence {
+		if dmc.shift&1 > 0 && dmc.level <= 125 {
+			dmc.level += 2
+		} else if dmc.shift&1 == 0 && dmc.level >= 2 {
+			dmc.level -= 2
+		}
+	}
+	dmc.shift >>= 1
+	if dmc.bitsLeft > 0 {
+		dmc.bitsLeft--
+	}
+	if dmc.bitsLeft == 0 {
+		dmc.bitsLeft = 8
+		dmc.silence = !dmc.bufferFull
+		if dmc.bufferFull {
+			dmc.shift = dmc.buffer
+			dmc.bufferFull = false
+		}
+	}
+	dmc.fetch(readMemory)
+}
+
+// WriteRegister handles cpu writes to $4000-$4017
+func (apu *APU) WriteRegister(addr uint16, value uint8) {
+	switch {
+	case addr <= 0x4003:
+		apu.Pulse1.writeRegister(addr-0x4000, value)
+	case addr <= 0x4007:
+		apu.Pulse2.writeRegister(addr-0x4004, value)
+	case addr <= 0x400B:
+		apu.Triangle.writeRegister(addr-0x4008, value)
+	case addr <= 0x400F:
+		apu.Noise.writeRegister(addr-0x400C, value)
+	case addr <= 0x4013:
+		apu.DMC.writeRegister(addr-0x4010, value)
+	case addr == 0x4015:
+		apu.Pulse1.enabled = getBit(0, value)
+		apu.Pulse2.enabled = getBit(1, value)
+		apu.Triangle.enabled = getBit(2, value)
+		apu.Noise.enabled = getBit(3, value)
+		apu.DMC.enabled = getBit(4, value)
+		if !apu.Pulse1.enabled {
+			apu.Pulse1.length = 0
+		}
+		if !apu.Pulse2.enabled {
+			apu.Pulse2.length = 0
+		}
+		if !apu.Triangle.enabled {
+			apu.Triangle.length = 0
+		}
+		if !apu.Noise.enabled {
+			apu.Noise.length = 0
+		}
+		if !apu.DMC.enabled {
+			apu.DMC.bytesLeft = 0
+		} else if apu.DMC.bytesLeft == 0 {
+			apu.DMC.restart()
+			apu.DMC.fetch(apu.readMemory)
+		}
+		apu.DMC.irq = false
+	case addr == 0x4017:
+		apu.frameCounterW = value
+		apu.irqInhibit = getBit(6, value)
+		if apu.irqInhibit {
+			apu.frameIRQ = false
+		}
+		//the frame counter resets 3 or 4 cpu cycles after the write
+		apu.pendingReset = 3
+		if !apu.evenCycle {
+			apu.pendingReset = 4
+		}
+	}
+}
+
+// ReadStatus handles cpu reads of $4015
+// bits 0-4 are set while each channel's length counter (or DMC bytes remaining) is non zero,
+// bit 6 is the frame IRQ (cleared by the read) and bit 7 is the DMC IRQ
+func (apu *APU) ReadStatus() uint8 {
+	var status uint8
+	status = setBit(status, 0, apu.Pulse1.length > 0)
+	status = setBit(status, 1, apu.Pulse2.length > 0)
+	status = setBit(status, 2, apu.Triangle.length > 0)
+	status = setBit(status, 3, apu.Noise.length > 0)
+	status = setBit(status, 4, apu.DMC.bytesLeft > 0)
+	status = setBit(status, 6, apu.frameIRQ)
+	status = setBit(status, 7, apu.DMC.irq)
+	apu.frameIRQ = false
+	return status
+}
+
+// IRQ returns true while the frame counter or the DMC is asserting the IRQ line
+func (apu *APU) IRQ() bool {
+	return apu.frameIRQ || apu.DMC.irq
+}
+
+// quarterFrame clocks the envelopes and the triangle's linear counter
+func (apu *APU) quarterFrame() {
+	apu.Pulse1.env.clock()
+	apu.Pulse2.env.clock()
+	apu.Noise.env.clock()
+	apu.Triangle.clockLinear()
+}
+
+// halfFrame clocks the length counters and sweep units
+func (apu *APU) halfFrame() {
+	apu.Pulse1.clockLength()
+	apu.Pulse2.clockLength()
+	apu.Triangle.clockLength()
+	apu.Noise.clockLength()
+	apu.Pulse1.clockSweep()
+	apu.Pulse2.clockSweep()
+}
+
+// clockFrameCounter steps the frame counter sequence
+func (apu *APU) clockFrameCounter() {
+	if apu.pendingReset > 0 {
+		apu.pendingReset--
+		if apu.pendingReset == 0 {
+			apu.fiveStep = getBit(7, apu.frameCounterW)
+			apu.frameCycle = 0
+			if apu.fiveStep { //writing with bit 7 set clocks everything immediately
+				apu.quarterFrame()
+				apu.halfFrame()
+			}
+		}
+	}
+	apu.frameCycle++
+	switch apu.frameCycle {
+	case frameStep1, frameStep3:
+		apu.quarterFrame()
+	case frameStep2:
+		apu.quarterFrame()
+		apu.halfFrame()
+	case frameStep4:
+		if !apu.fiveStep {
+			apu.quarterFrame()
+			apu.halfFrame()
+		}
+	case frameStep5:
+		apu.quarterFrame()
+		apu.halfFrame()
+	}
+	if !apu.fiveStep && !apu.irqInhibit && apu.frameCycle >= frameIRQStart && apu.frameCycle <= frameLength4 {
+		apu.frameIRQ = true
+	}
+	if (!apu.fiveStep && apu.frameCycle >= frameLength4) || apu.frameCycle >= frameLength5 {
+		apu.frameCycle = 0
+	}
+}
+
+// Clock advances the APU by one cpu cycle
+func (apu *APU) Clock() {
+	apu.clockFrameCounter()
+	apu.Triangle.clockTimer()
+	if apu.evenCycle {
+		apu.Pulse1.clockTimer()
+		apu.Pulse2.clockTimer()
+		apu.Noise.clockTimer()
+		apu.DMC.clockTimer(apu.readMemory)
+	}
+	apu.evenCycle = !apu.evenCycle
+}
+
+// Output returns the mixed level of all 5 channels from 0 to 1
+// using the nonlinear mixing of the real hardware's resistor network
+func (apu *APU) Output() float32 {
+	var pulseOut, tndOut float32
+	pulse := float32(apu.Pulse1.output()) + float32(apu.Pulse2.output())
+	if pulse > 0 {
+		pulseOut = 95.88 / (8128/pulse + 100)
+	}
+	tnd := float32(apu.Triangle.output())/8227 + float32(apu.Noise.output())/12241 + float32(apu.DMC.level)/22638
+	if tnd > 0 {
+		tndOut = 159.79 / (1/tnd + 100)
+	}
+	return pulseOut + tndOut
+}
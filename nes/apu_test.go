@@ -0,0 +1,78 @@
+package nes
+
+import "testing"
+
+func clockAPU(apu *APU, cycles int) {
+	for i := 0; i < cycles; i++ {
+		apu.Clock()
+	}
+}
+
+func TestAPULengthCounter(t *testing.T) {
+	apu := CreateAPU(func(addr uint16) uint8 { return 0 })
+	apu.WriteRegister(0x4003, 0x08) //disabled channels don't load their length counter
+	if apu.ReadStatus()&0x01 != 0 {
+		t.Fatal("pulse 1 loaded its length counter while disabled")
+	}
+
+	apu.WriteRegister(0x4015, 0x01)
+	apu.WriteRegister(0x4000, 0x10) //constant volume, length counter running
+	apu.WriteRegister(0x4003, 0x00) //length 10, counted down by the 2 half frames in each frame
+	clockAPU(apu, 4*frameLength4)
+	if apu.Pulse1.length != 2 || apu.ReadStatus()&0x01 == 0 {
+		t.Fatalf("length is %d after 8 half frames, expected 2", apu.Pulse1.length)
+	}
+	clockAPU(apu, frameLength4)
+	if apu.ReadStatus()&0x01 != 0 {
+		t.Fatalf("length is %d after 10 half frames", apu.Pulse1.length)
+	}
+
+	apu.WriteRegister(0x4000, 0x30) //halt the length counter
+	apu.WriteRegister(0x4003, 0x08) //length 254
+	clockAPU(apu, 2*frameLength4)
+	if apu.Pulse1.length != 254 {
+		t.Errorf("halted length counter went down to %d", apu.Pulse1.length)
+	}
+	apu.WriteRegister(0x4015, 0x00)
+	if apu.ReadStatus()&0x01 != 0 {
+		t.Error("disabling pulse 1 didn't clear its length counter")
+	}
+}
+
+func TestAPUFrameIRQ(t *testing.T) {
+	apu := CreateAPU(func(addr uint16) uint8 { return 0 })
+	clockAPU(apu, frameIRQStart-1)
+	if apu.IRQ() {
+		t.Fatalf("frame IRQ set before cycle %d", frameIRQStart)
+	}
+	apu.Clock()
+	if !apu.IRQ() {
+		t.Fatalf("frame IRQ not set on cycle %d", frameIRQStart)
+	}
+	clockAPU(apu, frameLength4-frameIRQStart)
+	if status := apu.ReadStatus(); status&0x40 == 0 {
+		t.Errorf("$4015 reads %02X with the frame IRQ set", status)
+	}
+	if apu.IRQ() {
+		t.Error("reading $4015 didn't clear the frame IRQ")
+	}
+	clockAPU(apu, frameIRQStart-1)
+	if apu.IRQ() {
+		t.Error("frame IRQ set again before the end of the next frame")
+	}
+
+	//the 5 step sequence and the inhibit flag never set it, setting the inhibit flag clears it
+	for _, value := range []uint8{0x80, 0x40} {
+		apu := CreateAPU(func(addr uint16) uint8 { return 0 })
+		clockAPU(apu, frameLength4)
+		apu.WriteRegister(0x4017, value)
+		if value == 0x40 && apu.IRQ() {
+			t.Error("setting the inhibit flag didn't clear the frame IRQ")
+		}
+		apu.ReadStatus()
+		clockAPU(apu, 2*frameLength5)
+		if apu.IRQ() {
+			t.Errorf("frame IRQ set after writing $%02X to $4017", value)
+		}
+	}
+}
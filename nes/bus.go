@@ -0,0 +1,58 @@
+package nes
+
+import "fmt"
+
+const FlatMemorySize = 0x10000 //64 KB
+
+// Bus is the memory the cpu reads and writes through
+type Bus interface {
+	GetCPUByte(addr uint16) uint8
+	SetCPUByte(addr uint16, value uint8)
+}
+
+// FlatBus is 64KB of RAM with nothing else mapped,
+// used to run raw 6502 binaries (EX: the test programs in TestBinary)
+type FlatBus struct {
+	Memory []uint8 //64 kilobytes of ram
+	CPU    *CPU
+}
+
+// CreateFlatBus creates a flat 64KB bus with a cpu emulating variant
+func CreateFlatBus(variant CPUVariant) *FlatBus {
+	bus := new(FlatBus)
+	bus.Memory = make([]uint8, FlatMemorySize)
+	bus.CPU = CreateCPUVariant(bus, variant)
+	return bus
+}
+
+// Load copies a binary into memory starting at addr
+func (bus *FlatBus) Load(binary []byte, addr uint16) error {
+	if int(addr)+len(binary) > FlatMemorySize {
+		return fmt.Errorf("couldn't load binary, %d bytes at $%04X doesn't fit in 64KB", len(binary), addr)
+	}
+	copy(bus.Memory[addr:], binary)
+	return nil
+}
+
+// Clock advances the cpu by one cycle
+func (bus *FlatBus) Clock() error {
+	return bus.CPU.Clock()
+}
+
+// Step clocks the cpu until it finishes the current instruction
+func (bus *FlatBus) Step() (StepInfo, error) {
+	return bus.CPU.stepWith(bus.Clock)
+}
+
+func (bus *FlatBus) GetCPUByte(addr uint16) uint8 {
+	return bus.Memory[addr]
+}
+
+// PeekCPUByte reads memory without side effects, used by debuggers and traces
+func (bus *FlatBus) PeekCPUByte(addr uint16) uint8 {
+	return bus.Memory[addr]
+}
+
+func (bus *FlatBus) SetCPUByte(addr uint16, value uint8) {
+	bus.Memory[addr] = value
+}
@@ -1,9 +1,19 @@
 package nes
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
 	"fmt"
-	"io"
+	"hash/crc32"
 	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	inesMagic = []byte("NES\x1A")
+	unifMagic = []byte("UNIF")
 )
 
 type Cartridge struct {
@@ -15,9 +25,46 @@ type Cartridge struct {
 	CHRRom              []byte
 	PRGRom              []byte
 	IgnoreMirrorControl bool   // if true, ignore MirrorVertically flag and provide four-screen vram
-	MapperNumber        uint8  //mapper to use
+	MapperNumber        uint16 //mapper to use
+	Submapper           uint8  //mapper variant, only known from the rom database
 	HasTrainer          bool   //if true, there is a 512 byte trainer before the PRG ROM
-	mapper              Mapper //the mapper to use
+	PRGRamSize          int    //PRG Ram ($6000-7FFF) size in bytes
+	CHRRamSize          int    //CHR Ram size in bytes, only used when there is no CHR Rom
+	PRGRam              []byte
+	CHRRam              []byte
+	Region              Region
+	BoardName           string      //UNIF board name, empty for iNES roms
+	DiskSides           [][]byte    //FDS disk sides, empty for cartridges
+	Format              RomFormat   //file format the rom was loaded from
+	CRC32               uint32      //CRC32 of PRG Rom + CHR Rom
+	SHA1                [20]byte    //SHA-1 of PRG Rom + CHR Rom
+	DBEntry             *RomDBEntry //rom database entry matching the hashes, nil if the rom isn't in the database
+	Overrides           []string    //header values replaced by the rom database
+	mapper              Mapper      //the mapper to use
+}
+
+// Region is the TV system a rom was made for
+type Region uint8
+
+const (
+	RegionNTSC Region = iota
+	RegionPAL
+	RegionMulti //works on both NTSC and PAL
+	RegionDendy
+)
+
+func (region Region) String() string {
+	switch region {
+	case RegionNTSC:
+		return "NTSC"
+	case RegionPAL:
+		return "PAL"
+	case RegionMulti:
+		return "Multi-region"
+	case RegionDendy:
+		return "Dendy"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(region))
 }
 
 type Mapper interface {
@@ -25,27 +72,78 @@ type Mapper interface {
 	PPUGetMapAddr(address uint16) uint32
 }
 
+// cpuBusMapper is implemented by mappers that respond to cpu accesses themselves
+// (registers, extra ram) instead of only translating addresses into PRG Rom.
+// ok is false when the mapper leaves the address to the cartridge
+type cpuBusMapper interface {
+	CPURead(address uint16) (value uint8, ok bool)
+	CPUWrite(address uint16, value uint8) (ok bool)
+}
+
+// clockedMapper is implemented by mappers with hardware that runs every cpu cycle
+// (IRQ counters, disk drives, expansion audio)
+type clockedMapper interface {
+	Clock()
+	IRQ() bool //true while the mapper is asserting the IRQ line
+}
+
+// powerOnMapper is implemented by mappers with registers that have a power up state
+type powerOnMapper interface {
+	PowerOn()
+}
+
+// resetMapper is implemented by mappers with registers the reset button changes
+type resetMapper interface {
+	Reset()
+}
+
+// audioMapper is implemented by mappers with expansion audio
+type audioMapper interface {
+	AudioOutput() float32 //level from 0 to 1
+}
+
 // CreateCart load's an INES formatted Rom into
 // a Cartirdge object and returns the new object
 func CreateCart(filename string) (*Cartridge, error) {
-	cart := new(Cartridge)
-	if err := cart.parseHeader(filename); err != nil {
-		return nil, fmt.Errorf("couldn't create Cartridge: %s", err)
-	}
-	fmt.Println("====================")
-	fmt.Printf("Rom Information:\n")
-	fmt.Printf("Mapper: %d\n", cart.MapperNumber)
-	fmt.Printf("Character Rom Size: %dkb\n", cart.CHRRomSize/1024)
-	fmt.Printf("Program Rom Size: %dkb\n", cart.PRGRomSize/1024)
-	fmt.Printf("Mirror Vertically: %t\n", cart.MirrorVertically)
-	fmt.Printf("Ignore Mirror Control Bit: %t\n", cart.IgnoreMirrorControl)
-	fmt.Printf("Has Battery Ram: %t\n", cart.HasBatteryRam)
-	fmt.Println("====================")
-	//load roms
-	cart.PRGRom = make([]byte, cart.PRGRomSize)
-	cart.CHRRom = make([]byte, cart.CHRRomSize)
-	if err := cart.loadRoms(filename); err != nil {
-		return nil, fmt.Errorf("couldn't create cartridge, %s", err)
+	return CreatePatchedCart(filename, nil)
+}
+
+// CreatePatchedCart loads the rom at filename, applies each IPS, UPS or BPS
+// patch in patches (in order) to it in memory, then loads the patched rom
+// into a Cartridge object
+func CreatePatchedCart(filename string, patches []string) (*Cartridge, error) {
+	romBuffer, err := ReadRomFile(filename, patches)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create Cartridge: %w", err)
+	}
+	return CreateCartFromBytes(romBuffer)
+}
+
+// ReadRomFile reads the rom at filename into memory and
+// applies each IPS, UPS or BPS patch in patches to it in order
+func ReadRomFile(filename string, patches []string) ([]byte, error) {
+	romBuffer, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %w", filename, err)
+	}
+	for _, patchPath := range patches {
+		patch, err := os.ReadFile(patchPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not open patch %s: %w", patchPath, err)
+		}
+		if romBuffer, err = ApplyPatch(romBuffer, patch); err != nil {
+			return nil, fmt.Errorf("can't apply %s, %s", patchPath, err)
+		}
+	}
+	return romBuffer, nil
+}
+
+// CreateCartFromBytes loads an INES or UNIF formatted Rom that is already
+// in memory into a Cartridge object and returns the new object
+func CreateCartFromBytes(romBuffer []byte) (*Cartridge, error) {
+	cart, err := parseRom(romBuffer)
+	if err != nil {
+		return nil, err
 	}
 	if err := cart.loadMapper(); err != nil {
 		return nil, fmt.Errorf("coudn't create cartridge, %s", err)
@@ -53,49 +151,109 @@ func CreateCart(filename string) (*Cartridge, error) {
 	return cart, nil
 }
 
-// loadRoms loads the CHR ROM and the PRG Rom into memory
-func (cart *Cartridge) loadRoms(filename string) error {
-	romFile, err := os.Open(filename)
+// ReadCartInfo describes the rom in romBuffer without needing
+// an implementation of its mapper
+func ReadCartInfo(romBuffer []byte) (CartridgeInfo, error) {
+	cart, err := parseRom(romBuffer)
 	if err != nil {
-		return fmt.Errorf("can't open file in loadRoms(), %s", err)
+		return CartridgeInfo{}, err
 	}
-	romBuffer, err := io.ReadAll(romFile)
-	if err != nil {
-		return fmt.Errorf("can't read bytes from Rom file in loadRoms(), %s", err)
+	return cart.Info(), nil
+}
+
+// parseRom reads the header and roms out of romBuffer and corrects the header
+// with the rom database. Everything but attaching the mapper
+func parseRom(romBuffer []byte) (*Cartridge, error) {
+	cart := new(Cartridge)
+	//detect the format from the file magic
+	switch {
+	case bytes.HasPrefix(romBuffer, inesMagic):
+		if err := cart.parseHeader(romBuffer); err != nil {
+			return nil, fmt.Errorf("couldn't create Cartridge: %s", err)
+		}
+		//load roms
+		cart.PRGRom = make([]byte, cart.PRGRomSize)
+		cart.CHRRom = make([]byte, cart.CHRRomSize)
+		if err := cart.loadRoms(romBuffer); err != nil {
+			return nil, fmt.Errorf("couldn't create cartridge, %s", err)
+		}
+	case bytes.HasPrefix(romBuffer, unifMagic):
+		if err := cart.parseUNIF(romBuffer); err != nil {
+			return nil, fmt.Errorf("couldn't create Cartridge: %s", err)
+		}
+	case isFDSImage(romBuffer):
+		if err := cart.parseFDS(romBuffer); err != nil {
+			return nil, fmt.Errorf("couldn't create Cartridge: %s", err)
+		}
+	default:
+		return nil, fmt.Errorf("couldn't create Cartridge: unknown rom format")
+	}
+	cart.hashRoms()
+	if err := cart.applyRomDB(); err != nil {
+		return nil, fmt.Errorf("couldn't create cartridge, %s", err)
 	}
+	cart.PRGRam = make([]byte, cart.PRGRamSize)
+	cart.CHRRam = make([]byte, cart.CHRRamSize)
+	return cart, nil
+}
+
+// loadRoms loads the CHR ROM and the PRG Rom into memory
+func (cart *Cartridge) loadRoms(romBuffer []byte) error {
 	offset := 16 //offset so we start reading after the header
 	if cart.HasTrainer {
 		offset += 512 //offset so we aren't reading the trainer
 	}
-	if bytesCopied := copy(cart.PRGRom, romBuffer[offset:offset+cart.PRGRomSize]); bytesCopied != cart.PRGRomSize {
+	if offset > len(romBuffer) {
+		offset = len(romBuffer)
+	}
+	if bytesCopied := copy(cart.PRGRom, romBuffer[offset:]); bytesCopied != cart.PRGRomSize {
 		return fmt.Errorf("header specified PRG Rom size of %d but only %d bytes read", cart.PRGRomSize, bytesCopied)
 	}
-	if bytesCopied := copy(cart.CHRRom, romBuffer[offset+cart.PRGRomSize:offset+cart.PRGRomSize+cart.CHRRomSize]); bytesCopied != cart.CHRRomSize {
+	offset += cart.PRGRomSize
+	if bytesCopied := copy(cart.CHRRom, romBuffer[offset:]); bytesCopied != cart.CHRRomSize {
 		return fmt.Errorf("header specified CHR Rom size of %d but only %d bytes read", cart.CHRRomSize, bytesCopied)
 	}
 	return nil
 }
 
-// parseHeader takes the path to the rom
-// and populates the cartridges rom info
-// from the iNES header on the rom file
-func (cart *Cartridge) parseHeader(filename string) error {
-	file, err := os.Open(filename) //read the iNES rom
-	if err != nil {
-		return fmt.Errorf("could not open %s", filename)
+// hashRoms computes the CRC32 and SHA-1 of PRG Rom + CHR Rom
+// used to look the rom up in the rom database
+func (cart *Cartridge) hashRoms() {
+	crc := crc32.NewIEEE()
+	sha := sha1.New()
+	for _, rom := range [][]byte{cart.PRGRom, cart.CHRRom} {
+		crc.Write(rom)
+		sha.Write(rom)
 	}
-	buffer := make([]byte, 16)
-	_, error := io.ReadFull(file, buffer)
-	//parse headers
-	if error != nil {
+	cart.CRC32 = crc.Sum32()
+	copy(cart.SHA1[:], sha.Sum(nil))
+}
+
+// parseHeader populates the cartridges rom info
+// from the iNES header at the start of the rom
+func (cart *Cartridge) parseHeader(romBuffer []byte) error {
+	if len(romBuffer) < 16 {
 		return fmt.Errorf("error reading rom into buffer")
 	}
+	buffer := romBuffer[:16]
+	//parse headers
 	cart.PRGRomSize = 16384 * int(buffer[4]) //compute PRG Rom size
 	cart.CHRRomSize = 8192 * int(buffer[5])  //compute CHR Rom size
 	cart.MirrorVertically = getBit(0, buffer[6])
 	cart.IgnoreMirrorControl = getBit(3, buffer[6])
 	cart.HasBatteryRam = getBit(1, buffer[6])
-	cart.MapperNumber = (buffer[6] >> 4) | (buffer[7] & 0xF0)
+	cart.HasTrainer = getBit(2, buffer[6])
+	cart.MapperNumber = uint16((buffer[6] >> 4) | (buffer[7] & 0xF0))
+	cart.PRGRamSize = 8192 * int(buffer[8]) //0 means 8kb for compatibility
+	if cart.PRGRamSize == 0 {
+		cart.PRGRamSize = 8192
+	}
+	if cart.CHRRomSize == 0 {
+		cart.CHRRamSize = 8192 //boards without CHR Rom have 8kb of CHR Ram
+	}
+	if getBit(0, buffer[9]) {
+		cart.Region = RegionPAL
+	}
 
 	if getBit(0, buffer[7]) {
 		return fmt.Errorf("rom is for VS Unisystem")
@@ -106,26 +264,220 @@ func (cart *Cartridge) parseHeader(filename string) error {
 	return nil
 }
 
+// unifBoards maps UNIF board names (without the NES-/UNL-/HVC- style prefix)
+// to the iNES mapper number that implements the board
+var unifBoards = map[string]uint16{
+	"NROM": 0, "NROM-128": 0, "NROM-256": 0, "RROM": 0, "RROM-128": 0,
+	"SAROM": 1, "SBROM": 1, "SCROM": 1, "SC1ROM": 1, "SEROM": 1, "SFROM": 1, "SGROM": 1, "SHROM": 1,
+	"SJROM": 1, "SKROM": 1, "SLROM": 1, "SL1ROM": 1, "SL2ROM": 1, "SL3ROM": 1, "SLRROM": 1,
+	"SNROM": 1, "SOROM": 1, "SUROM": 1, "SXROM": 1,
+	"UNROM": 2, "UOROM": 2, "UN1ROM": 94,
+	"CNROM": 3,
+	"TBROM": 4, "TEROM": 4, "TFROM": 4, "TGROM": 4, "TKROM": 4, "TLROM": 4, "TL1ROM": 4,
+	"TR1ROM": 4, "TSROM": 4, "TVROM": 4, "TLSROM": 118, "TKSROM": 118, "TQROM": 119,
+	"EKROM": 5, "ELROM": 5, "ETROM": 5, "EWROM": 5,
+	"AMROM": 7, "ANROM": 7, "AN1ROM": 7, "AOROM": 7,
+	"PNROM": 9, "PEEOROM": 9,
+	"FJROM": 10, "FKROM": 10,
+	"CPROM": 13,
+	"BNROM": 34,
+	"GNROM": 66, "MHROM": 66,
+}
+
+// unifBoardMapper returns the mapper number for a UNIF board name
+// board names are prefixed with the manufacturer (NES-, UNL-, HVC-...) which we ignore
+func unifBoardMapper(boardName string) (uint16, bool) {
+	name := strings.ToUpper(boardName)
+	if mapper, ok := unifBoards[name]; ok {
+		return mapper, true
+	}
+	if dash := strings.Index(name, "-"); dash >= 0 {
+		mapper, ok := unifBoards[name[dash+1:]]
+		return mapper, ok
+	}
+	return 0, false
+}
+
+// parseUNIF populates the cartridge from a UNIF formatted rom
+// a UNIF file is a 32 byte header followed by chunks made of a 4 character ID,
+// a 4 byte little endian length and the chunk data.
+// MAPR holds the board name, PRG0-PRGF and CHR0-CHRF hold the roms (in numbered order),
+// MIRR the mirroring and BATR marks battery backed ram
+func (cart *Cartridge) parseUNIF(romBuffer []byte) error {
+	if len(romBuffer) < 32 {
+		return fmt.Errorf("UNIF header is truncated")
+	}
+	var prgChunks, chrChunks [16][]byte
+	cart.Format = FormatUNIF
+	cart.MirrorVertically = false
+	hasMapr := false
+	for offset := 32; offset < len(romBuffer); {
+		if offset+8 > len(romBuffer) {
+			return fmt.Errorf("UNIF chunk at 0x%X is truncated", offset)
+		}
+		id := string(romBuffer[offset : offset+4])
+		length := int(binary.LittleEndian.Uint32(romBuffer[offset+4:]))
+		offset += 8
+		if length < 0 || offset+length > len(romBuffer) {
+			return fmt.Errorf("UNIF %s chunk is truncated", id)
+		}
+		data := romBuffer[offset : offset+length]
+		offset += length
+		switch {
+		case id == "MAPR":
+			cart.BoardName = string(bytes.TrimRight(data, "\x00"))
+			hasMapr = true
+		case strings.HasPrefix(id, "PRG") || strings.HasPrefix(id, "CHR"):
+			index, err := strconv.ParseUint(id[3:], 16, 8)
+			if err != nil {
+				continue //not a numbered rom chunk
+			}
+			if id[0] == 'P' {
+				prgChunks[index] = data
+			} else {
+				chrChunks[index] = data
+			}
+		case id == "MIRR" && length > 0:
+			switch data[0] {
+			case 0: //hard wired horizontal
+				cart.MirrorVertically = false
+			case 1: //hard wired vertical
+				cart.MirrorVertically = true
+			case 4: //four screen
+				cart.IgnoreMirrorControl = true
+			}
+			//2 and 3 are single screen and 5 is mapper controlled, the mapper sets those at runtime
+		case id == "BATR":
+			cart.HasBatteryRam = true
+		case id == "TVCI" && length > 0:
+			switch data[0] {
+			case 1:
+				cart.Region = RegionPAL
+			case 2:
+				cart.Region = RegionMulti
+			}
+		}
+	}
+	if !hasMapr {
+		return fmt.Errorf("UNIF rom has no MAPR chunk")
+	}
+	mapper, ok := unifBoardMapper(cart.BoardName)
+	if !ok {
+		return fmt.Errorf("unsupported UNIF board: %s", cart.BoardName)
+	}
+	cart.MapperNumber = mapper
+	for _, chunk := range prgChunks {
+		cart.PRGRom = append(cart.PRGRom, chunk...)
+	}
+	for _, chunk := range chrChunks {
+		cart.CHRRom = append(cart.CHRRom, chunk...)
+	}
+	cart.PRGRomSize = len(cart.PRGRom)
+	cart.CHRRomSize = len(cart.CHRRom)
+	if len(prgChunks[0]) == 0 {
+		return fmt.Errorf("UNIF rom has no PRG0 chunk") //the other chunks would end up where PRG0 belongs
+	}
+	cart.PRGRamSize = 8192 //UNIF doesn't specify PRG Ram so assume 8kb like iNES does
+	if cart.CHRRomSize == 0 {
+		cart.CHRRamSize = 8192
+	}
+	return nil
+}
+
 // loadMapper use's the cartridges mapper number from the header
 // to attach a mapper object to cartridge.MemMapper
 func (cart *Cartridge) loadMapper() error {
 	switch cart.MapperNumber {
 	case 0:
 		cart.mapper = CreateMapper_0(cart.PRGRomSize == 16*1024)
+	case 20:
+		return fmt.Errorf("FDS disk images need the FDS BIOS, load them with CreateFDSCart")
 	default:
 		return fmt.Errorf("unsupported mapper: %d", cart.MapperNumber)
 	}
 	return nil
 }
 
-func (cart *Cartridge) GetCPUByte(addr uint16) uint8 {
+// PowerOn fills the cartridge's ram and puts the mapper in its power up state.
+// Battery backed PRG Ram keeps its contents
+func (cart *Cartridge) PowerOn(ramInit *RAMInit) {
+	if !cart.HasBatteryRam {
+		ramInit.fill(cart.PRGRam)
+	}
+	ramInit.fill(cart.CHRRam)
+	if mapper, ok := cart.mapper.(powerOnMapper); ok {
+		mapper.PowerOn()
+	}
+}
+
+// Reset passes the reset button on to the mapper
+func (cart *Cartridge) Reset() {
+	if mapper, ok := cart.mapper.(resetMapper); ok {
+		mapper.Reset()
+	}
+}
+
+// Clock runs any hardware on the cartridge for one cpu cycle
+func (cart *Cartridge) Clock() {
+	if mapper, ok := cart.mapper.(clockedMapper); ok {
+		mapper.Clock()
+	}
+}
+
+// IRQ returns true while the cartridge is asserting the IRQ line
+func (cart *Cartridge) IRQ() bool {
+	if mapper, ok := cart.mapper.(clockedMapper); ok {
+		return mapper.IRQ()
+	}
+	return false
+}
+
+// AudioOutput returns the level of the cartridge's expansion audio, 0 if it has none
+func (cart *Cartridge) AudioOutput() float32 {
+	if mapper, ok := cart.mapper.(audioMapper); ok {
+		return mapper.AudioOutput()
+	}
+	return 0
+}
+
+// GetCPUByte reads from the cartridge, ok is false if nothing on the
+// cartridge responds to the address (the cpu then reads open bus)
+func (cart *Cartridge) GetCPUByte(addr uint16) (value uint8, ok bool) {
+	if mapper, ok := cart.mapper.(cpuBusMapper); ok {
+		if value, ok := mapper.CPURead(addr); ok {
+			return value, true
+		}
+	}
+	if addr >= 0x6000 && addr <= 0x7FFF {
+		if len(cart.PRGRam) == 0 {
+			return 0, false
+		}
+		return cart.PRGRam[int(addr-0x6000)%len(cart.PRGRam)], true
+	}
+	if addr < 0x8000 {
+		return 0, false
+	}
 	mapped_addr := cart.mapper.CPUGetMapAddr(addr)
-	return cart.PRGRom[mapped_addr]
+	if int(mapped_addr) >= len(cart.PRGRom) {
+		return 0, false
+	}
+	return cart.PRGRom[mapped_addr], true
 }
 func (cart *Cartridge) SetCPUByte(addr uint16, value uint8) {
+	if mapper, ok := cart.mapper.(cpuBusMapper); ok && mapper.CPUWrite(addr, value) {
+		return
+	}
+	if addr >= 0x6000 && addr <= 0x7FFF && len(cart.PRGRam) > 0 {
+		cart.PRGRam[int(addr-0x6000)%len(cart.PRGRam)] = value
+		return
+	}
+	if addr < 0x8000 {
+		return
+	}
 	mapped_addr := cart.mapper.CPUGetMapAddr(addr)
-	fmt.Printf("Addr: 0x%04X Mapped Addr: 0x%08X\n", addr, mapped_addr)
-	cart.PRGRom[mapped_addr] = value
+	if int(mapped_addr) < len(cart.PRGRom) {
+		cart.PRGRom[mapped_addr] = value
+	}
 }
 func (cart *Cartridge) GetPPUByte(addr uint16) uint8 {
 	mapped_addr := cart.mapper.CPUGetMapAddr(addr)
@@ -0,0 +1,159 @@
+package nes
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// RomFormat is the file format a cartridge was loaded from
+type RomFormat uint8
+
+const (
+	FormatINES RomFormat = iota
+	FormatUNIF
+	FormatFDS
+	FormatNSF
+)
+
+func (format RomFormat) String() string {
+	switch format {
+	case FormatINES:
+		return "iNES"
+	case FormatUNIF:
+		return "UNIF"
+	case FormatFDS:
+		return "FDS"
+	case FormatNSF:
+		return "NSF"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(format))
+}
+
+// mapperNames maps mapper numbers to the board or chip name they are known by
+var mapperNames = map[uint16]string{
+	0:  "NROM",
+	1:  "MMC1",
+	2:  "UxROM",
+	3:  "CNROM",
+	4:  "MMC3",
+	5:  "MMC5",
+	7:  "AxROM",
+	9:  "MMC2",
+	10: "MMC4",
+	11: "Color Dreams",
+	13: "CPROM",
+	19: "Namco 163",
+	20: "Famicom Disk System",
+	21: "VRC4a/VRC4c",
+	22: "VRC2a",
+	23: "VRC2b/VRC4e",
+	24: "VRC6a",
+	25: "VRC4b/VRC4d",
+	26: "VRC6b",
+	34: "BNROM/NINA-001",
+	66: "GxROM",
+	69: "Sunsoft FME-7",
+	71: "Camerica",
+	85: "VRC7",
+}
+
+// MapperName returns the name of the board or chip a mapper number refers to
+func MapperName(mapper uint16) string {
+	if name, ok := mapperNames[mapper]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// CartridgeInfo describes a loaded cartridge
+// sizes are in bytes, hashes are of PRG Rom + CHR Rom
+type CartridgeInfo struct {
+	HeaderFormat string   `json:"headerFormat"`
+	BoardName    string   `json:"boardName,omitempty"` // UNIF board name
+	DiskSides    int      `json:"diskSides,omitempty"` // FDS disk sides
+	Mapper       uint16   `json:"mapper"`
+	Submapper    uint8    `json:"submapper"`
+	MapperName   string   `json:"mapperName"`
+	PRGRomSize   int      `json:"prgRomSize"`
+	CHRRomSize   int      `json:"chrRomSize"`
+	PRGRamSize   int      `json:"prgRamSize"`
+	CHRRamSize   int      `json:"chrRamSize"`
+	Mirroring    string   `json:"mirroring"`
+	Battery      bool     `json:"battery"`
+	Trainer      bool     `json:"trainer"`
+	Region       string   `json:"region"`
+	CRC32        string   `json:"crc32"`
+	SHA1         string   `json:"sha1"`
+	DatabaseName string   `json:"databaseName,omitempty"` // name of the matching rom database entry
+	Overrides    []string `json:"overrides,omitempty"`    // header values replaced by the rom database
+}
+
+// Info returns a description of the cartridge
+func (cart *Cartridge) Info() CartridgeInfo {
+	info := CartridgeInfo{
+		HeaderFormat: cart.Format.String(),
+		BoardName:    cart.BoardName,
+		DiskSides:    len(cart.DiskSides),
+		Mapper:       cart.MapperNumber,
+		Submapper:    cart.Submapper,
+		MapperName:   MapperName(cart.MapperNumber),
+		PRGRomSize:   cart.PRGRomSize,
+		CHRRomSize:   cart.CHRRomSize,
+		PRGRamSize:   cart.PRGRamSize,
+		CHRRamSize:   cart.CHRRamSize,
+		Mirroring:    "horizontal",
+		Battery:      cart.HasBatteryRam,
+		Trainer:      cart.HasTrainer,
+		Region:       cart.Region.String(),
+		CRC32:        fmt.Sprintf("%08X", cart.CRC32),
+		SHA1:         strings.ToUpper(hex.EncodeToString(cart.SHA1[:])),
+		Overrides:    cart.Overrides,
+	}
+	if cart.IgnoreMirrorControl {
+		info.Mirroring = "four-screen"
+	} else if cart.MirrorVertically {
+		info.Mirroring = "vertical"
+	}
+	if cart.DBEntry != nil {
+		info.DatabaseName = cart.DBEntry.Name
+	}
+	return info
+}
+
+// String formats the info as a human readable block
+func (info CartridgeInfo) String() string {
+	var out strings.Builder
+	fmt.Fprintln(&out, "====================")
+	fmt.Fprintf(&out, "Rom Information:\n")
+	fmt.Fprintf(&out, "Format: %s\n", info.HeaderFormat)
+	if info.BoardName != "" {
+		fmt.Fprintf(&out, "Board: %s\n", info.BoardName)
+	}
+	if info.DiskSides > 0 {
+		fmt.Fprintf(&out, "Disk Sides: %d\n", info.DiskSides)
+	}
+	fmt.Fprintf(&out, "Mapper: %d (%s)", info.Mapper, info.MapperName)
+	if info.Submapper != 0 {
+		fmt.Fprintf(&out, " submapper %d", info.Submapper)
+	}
+	fmt.Fprintln(&out)
+	fmt.Fprintf(&out, "Program Rom Size: %dkb\n", info.PRGRomSize/1024)
+	fmt.Fprintf(&out, "Character Rom Size: %dkb\n", info.CHRRomSize/1024)
+	fmt.Fprintf(&out, "PRG Ram Size: %dkb\n", info.PRGRamSize/1024)
+	fmt.Fprintf(&out, "CHR Ram Size: %dkb\n", info.CHRRamSize/1024)
+	fmt.Fprintf(&out, "Mirroring: %s\n", info.Mirroring)
+	fmt.Fprintf(&out, "Has Battery Ram: %t\n", info.Battery)
+	fmt.Fprintf(&out, "Has Trainer: %t\n", info.Trainer)
+	fmt.Fprintf(&out, "Region: %s\n", info.Region)
+	fmt.Fprintf(&out, "CRC32: %s\n", info.CRC32)
+	fmt.Fprintf(&out, "SHA-1: %s\n", info.SHA1)
+	if info.DatabaseName != "" {
+		fmt.Fprintf(&out, "Rom Database: %s\n", info.DatabaseName)
+	}
+	for _, override := range info.Overrides {
+		fmt.Fprintf(&out, "Header Overridden: %s\n", override)
+	}
+	fmt.Fprint(&out, "====================")
+	return out.String()
+}
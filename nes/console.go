@@ -0,0 +1,160 @@
+package nes
+
+/*
+Console
+runs a NesSystem in frames and cycles while keeping track of the master clock,
+the cpu, PPU and APU all run off the master clock at fixed ratios that depend on the region.
+The PPU isn't emulated yet so frames are counted from the master clock
+*/
+
+// consoleTiming is how a region's master clock is divided
+type consoleTiming struct {
+	cpuDivider    uint64 //master cycles per cpu (and APU) cycle
+	ppuDivider    uint64 //master cycles per PPU dot
+	dotsPerLine   uint64
+	linesPerFrame uint64
+}
+
+var (
+	ntscTiming  = consoleTiming{12, 4, 341, 262} //21.477272 MHz master clock
+	palTiming   = consoleTiming{16, 5, 341, 312} //26.601712 MHz master clock
+	dendyTiming = consoleTiming{15, 5, 341, 312} //26.601712 MHz master clock
+)
+
+func timingForRegion(region Region) consoleTiming {
+	switch region {
+	case RegionPAL:
+		return palTiming
+	case RegionDendy:
+		return dendyTiming
+	}
+	return ntscTiming
+}
+
+// Console wraps a NesSystem with frame and cycle level controls
+type Console struct {
+	System       *NesSystem
+	MasterCycles uint64 //master clock cycles since power on
+	timing       consoleTiming
+	rewind       *rewindBuffer //nil unless rewind is enabled
+}
+
+// CreateConsole loads a rom and powers on a console with it
+func CreateConsole(romPath string) (*Console, error) {
+	system, err := CreateBus(romPath)
+	if err != nil {
+		return nil, err
+	}
+	return CreateConsoleFromSystem(system), nil
+}
+
+// CreateConsoleFromSystem powers on a console around an already created system
+func CreateConsoleFromSystem(system *NesSystem) *Console {
+	console := new(Console)
+	console.System = system
+	console.timing = timingForRegion(system.Cart.Region)
+	console.PowerCycle()
+	return console
+}
+
+// CPUCycles returns the cpu cycles run since power on, the APU runs at the same rate
+func (console *Console) CPUCycles() uint64 {
+	return console.MasterCycles / console.timing.cpuDivider
+}
+
+// PPUDots returns the PPU dots run since power on
+func (console *Console) PPUDots() uint64 {
+	return console.MasterCycles / console.timing.ppuDivider
+}
+
+// Frame returns the number of the frame the PPU is on
+func (console *Console) Frame() uint64 {
+	return console.PPUDots() / console.dotsPerFrame()
+}
+
+// Scanline returns the scanline the PPU is on
+func (console *Console) Scanline() uint64 {
+	return console.PPUDots() / console.timing.dotsPerLine % console.timing.linesPerFrame
+}
+
+// Dot returns the dot of the scanline the PPU is on
+func (console *Console) Dot() uint64 {
+	return console.PPUDots() % console.timing.dotsPerLine
+}
+
+func (console *Console) dotsPerFrame() uint64 {
+	return console.timing.dotsPerLine * console.timing.linesPerFrame
+}
+
+func (console *Console) GetCPUByte(addr uint16) uint8 {
+	return console.System.GetCPUByte(addr)
+}
+
+func (console *Console) SetCPUByte(addr uint16, value uint8) {
+	console.System.SetCPUByte(addr, value)
+}
+
+// PeekCPUByte reads memory without side effects
+func (console *Console) PeekCPUByte(addr uint16) uint8 {
+	return console.System.PeekCPUByte(addr)
+}
+
+// Clock runs the system for one cpu cycle
+// with rewind enabled a snapshot is saved on the first instruction boundary of every frame
+func (console *Console) Clock() error {
+	console.MasterCycles += console.timing.cpuDivider
+	err := console.System.Clock()
+	if console.rewind != nil && console.System.CPU.RemCycles == 0 && !console.rewind.savedFrame(console.Frame()) {
+		console.saveRewindFrame()
+	}
+	return err
+}
+
+// Step runs the system until the cpu finishes an instruction
+func (console *Console) Step() (StepInfo, error) {
+	return console.System.CPU.stepWith(console.Clock)
+}
+
+// RunCycles runs the system for n cpu cycles
+func (console *Console) RunCycles(n uint64) error {
+	for i := uint64(0); i < n; i++ {
+		if err := console.Clock(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunFrame runs the system until the PPU starts the next frame
+func (console *Console) RunFrame() error {
+	nextFrame := (console.Frame() + 1) * console.dotsPerFrame()
+	for console.PPUDots() < nextFrame {
+		if err := console.Clock(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunUntil runs instructions until predicate returns true, predicate is checked after every instruction.
+// Stops early if the cpu halts
+func (console *Console) RunUntil(predicate func(console *Console) bool) error {
+	for !predicate(console) {
+		if _, err := console.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset presses the reset button, memory is left alone
+func (console *Console) Reset() {
+	console.System.Reset()
+	console.MasterCycles += 7 * console.timing.cpuDivider //the reset sequence takes 7 cycles
+}
+
+// PowerCycle turns the console off and on, everything starts over but battery backed ram
+func (console *Console) PowerCycle() {
+	console.System.PowerOn()
+	console.MasterCycles = 7 * console.timing.cpuDivider //the reset sequence takes 7 cycles
+}
@@ -0,0 +1,119 @@
+package nes
+
+import (
+	"errors"
+	"testing"
+)
+
+// createRegionConsole powers on stateTestProgram with the timing of region
+func createRegionConsole(t *testing.T, region Region) *Console {
+	console := createTestConsole(t, stateTestProgram)
+	console.System.Cart.Region = region
+	return CreateConsoleFromSystem(console.System)
+}
+
+func TestRunCycles(t *testing.T) {
+	console := createTestConsole(t, stateTestProgram)
+	if console.MasterCycles != 7*12 || console.CPUCycles() != 7 {
+		t.Fatalf("powered on at master cycle %d", console.MasterCycles)
+	}
+	if err := console.RunCycles(1000); err != nil {
+		t.Fatal(err)
+	}
+	if console.CPUCycles() != 1007 || console.MasterCycles != 1007*12 {
+		t.Errorf("at cpu cycle %d, master cycle %d after running 1000 cycles", console.CPUCycles(), console.MasterCycles)
+	}
+	if console.System.CPU.Cycles != console.CPUCycles() {
+		t.Errorf("cpu ran %d cycles, the console counted %d", console.System.CPU.Cycles, console.CPUCycles())
+	}
+	if console.PPUDots() != 1007*3 {
+		t.Errorf("PPU is at dot %d, expected 3 dots per cpu cycle", console.PPUDots())
+	}
+}
+
+func TestRunFrame(t *testing.T) {
+	tests := []struct {
+		region      Region
+		timing      consoleTiming
+		frameCycles uint64 //whole cpu cycles in a frame, frames take this or one more
+	}{
+		{RegionNTSC, ntscTiming, 29780},
+		{RegionPAL, palTiming, 33247},
+		{RegionDendy, dendyTiming, 35464},
+	}
+	for _, test := range tests {
+		console := createRegionConsole(t, test.region)
+		if console.timing != test.timing {
+			t.Errorf("%v console has timing %+v", test.region, console.timing)
+		}
+		for frame := uint64(1); frame <= 3; frame++ {
+			start := console.CPUCycles()
+			if err := console.RunFrame(); err != nil {
+				t.Fatal(err)
+			}
+			if console.Frame() != frame || console.Scanline() != 0 {
+				t.Fatalf("%v: RunFrame stopped on frame %d scanline %d, expected frame %d", test.region, console.Frame(), console.Scanline(), frame)
+			}
+			//the frame started during the last cpu cycle
+			frameStart := frame * console.dotsPerFrame()
+			if console.PPUDots() < frameStart || (console.MasterCycles-test.timing.cpuDivider)/test.timing.ppuDivider >= frameStart {
+				t.Errorf("%v: RunFrame stopped at dot %d, frame %d starts at dot %d", test.region, console.PPUDots(), frame, frameStart)
+			}
+			expected := test.frameCycles
+			if frame == 1 {
+				expected -= 7 //the reset sequence ran in the first frame
+			}
+			if cycles := console.CPUCycles() - start; cycles != expected && cycles != expected+1 {
+				t.Errorf("%v: frame %d took %d cpu cycles, expected %d", test.region, frame, cycles, expected)
+			}
+		}
+	}
+}
+
+func TestConsoleResetAndPowerCycle(t *testing.T) {
+	console := createRegionConsole(t, RegionPAL)
+	runFrames(t, console, 2)
+	master, cpuCycles := console.MasterCycles, console.System.CPU.Cycles
+	console.Reset()
+	if console.MasterCycles != master+7*16 || console.System.CPU.Cycles != cpuCycles+7 {
+		t.Errorf("reset moved the master clock by %d and the cpu by %d cycles, expected 7 cpu cycles",
+			console.MasterCycles-master, console.System.CPU.Cycles-cpuCycles)
+	}
+	if console.System.CPU.PC != 0x8000 {
+		t.Errorf("reset went to $%04X", console.System.CPU.PC)
+	}
+
+	console.PowerCycle()
+	if console.MasterCycles != 7*16 || console.System.CPU.Cycles != 7 || console.Frame() != 0 {
+		t.Errorf("power cycled to master cycle %d, cpu cycle %d, frame %d", console.MasterCycles, console.System.CPU.Cycles, console.Frame())
+	}
+}
+
+func TestRunUntil(t *testing.T) {
+	console := createTestConsole(t, stateTestProgram)
+	steps := 0
+	err := console.RunUntil(func(console *Console) bool {
+		steps++
+		return console.System.CPU.PC == 0x8016 //INC $01, after $00 wraps
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if console.System.CPU.PC != 0x8016 || console.System.CPU.RemCycles != 0 {
+		t.Errorf("stopped at $%04X with %d cycles left", console.System.CPU.PC, console.System.CPU.RemCycles)
+	}
+	if ram := console.System.Memory[0]; ram != 0 {
+		t.Errorf("stopped with $00 at %d", ram)
+	}
+	if steps != 7+2*256+1 { //7 setup instructions, 256 INC BNE loops and the check before the first step
+		t.Errorf("predicate checked %d times", steps)
+	}
+
+	//a halted cpu stops it
+	console = createTestConsole(t, []byte{0xEA, 0x02}) //NOP, KIL
+	err = console.RunUntil(func(console *Console) bool { return false })
+	var invalidOpcode *InvalidOpcodeError
+	if !errors.As(err, &invalidOpcode) || invalidOpcode.PC != 0x8001 {
+		t.Errorf("running into KIL returned %v", err)
+	}
+}
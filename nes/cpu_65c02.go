@@ -0,0 +1,291 @@
+package nes
+
+/*
+65C02 (WDC W65C02S) variant
+the CMOS 6502 adds instructions in the NMOS chip's undocumented opcodes, fixes the JMP ($xxFF) bug,
+gives valid N and Z flags in decimal mode and turns every unused opcode into a NOP
+*/
+
+// populateCMOSInstructionTable builds the 65C02's table from the NMOS one
+func (a *CPU) populateCMOSInstructionTable() {
+	a.populateInstructionTable()
+	//every unused opcode is a NOP, columns 3 and B are single cycle NOPs
+	for high := 0; high < 0x100; high += 0x10 {
+		a.instructionTable[high|0x03] = instructionAndAddrMode{a.nop, a.implied, 1, accessNone}
+		a.instructionTable[high|0x0B] = instructionAndAddrMode{a.nop, a.implied, 1, accessNone}
+	}
+	for _, opcode := range []uint8{0x02, 0x22, 0x42, 0x62, 0x82, 0xC2, 0xE2} {
+		a.instructionTable[opcode] = instructionAndAddrMode{a.nopRead, a.immediate, 2, accessRead}
+	}
+	//bit instructions, the bit number is bits 4-6 of the opcode
+	for bit := uint8(0); bit < 8; bit++ {
+		a.instructionTable[bit<<4|0x07] = instructionAndAddrMode{a.rmb(bit), a.zeroPage, 5, accessRMW}
+		a.instructionTable[bit<<4|0x87] = instructionAndAddrMode{a.smb(bit), a.zeroPage, 5, accessRMW}
+		a.instructionTable[bit<<4|0x0F] = instructionAndAddrMode{a.bbr(bit), a.zeroPageRelative, 5, accessNone}
+		a.instructionTable[bit<<4|0x8F] = instructionAndAddrMode{a.bbs(bit), a.zeroPageRelative, 5, accessNone}
+	}
+	cmos := map[uint8]instructionAndAddrMode{
+		0x04: {a.tsb, a.zeroPage, 5, accessRMW},
+		0x0C: {a.tsb, a.absolute, 6, accessRMW},
+		0x12: {a.ora, a.zeroPageIndirect, 5, accessRead},
+		0x14: {a.trb, a.zeroPage, 5, accessRMW},
+		0x1A: {a.incA, a.accumulator, 2, accessNone},
+		0x1C: {a.trb, a.absolute, 6, accessRMW},
+		0x1E: {a.asl, a.absoluteX, 6, accessRMW},
+		0x32: {a.and, a.zeroPageIndirect, 5, accessRead},
+		0x34: {a.bit, a.zeroPageX, 4, accessRead},
+		0x3A: {a.decA, a.accumulator, 2, accessNone},
+		0x3C: {a.bit, a.absoluteX, 4, accessRead},
+		0x3E: {a.rol, a.absoluteX, 6, accessRMW},
+		0x44: {a.nopRead, a.zeroPage, 3, accessRead},
+		0x52: {a.eor, a.zeroPageIndirect, 5, accessRead},
+		0x54: {a.nopRead, a.zeroPageX, 4, accessRead},
+		0x5A: {a.phy, a.push, 3, accessNone},
+		0x5C: {a.nop, a.longNOP, 8, accessNone},
+		0x5E: {a.lsr, a.absoluteX, 6, accessRMW},
+		0x64: {a.stz, a.zeroPage, 3, accessWrite},
+		0x6C: {a.jmp, a.indirectCMOS, 6, accessJump},
+		0x72: {a.adc, a.zeroPageIndirect, 5, accessRead},
+		0x74: {a.stz, a.zeroPageX, 4, accessWrite},
+		0x7A: {a.ply, a.pull, 4, accessNone},
+		0x7C: {a.jmp, a.absoluteIndexedIndirect, 6, accessJump},
+		0x7E: {a.ror, a.absoluteX, 6, accessRMW},
+		0x80: {a.bra, a.relative, 2, accessNone},
+		0x89: {a.bitImmediate, a.immediate, 2, accessRead},
+		0x92: {a.sta, a.zeroPageIndirect, 5, accessWrite},
+		0x9C: {a.stz, a.absolute, 4, accessWrite},
+		0x9E: {a.stz, a.absoluteX, 5, accessWrite},
+		0xB2: {a.lda, a.zeroPageIndirect, 5, accessRead},
+		0xCB: {a.wai, a.impliedSlow, 3, accessNone},
+		0xD2: {a.cmp, a.zeroPageIndirect, 5, accessRead},
+		0xD4: {a.nopRead, a.zeroPageX, 4, accessRead},
+		0xDA: {a.phx, a.push, 3, accessNone},
+		0xDB: {a.stp, a.impliedSlow, 3, accessNone},
+		0xDC: {a.nopRead, a.absolute, 4, accessRead},
+		0xF2: {a.sbc, a.zeroPageIndirect, 5, accessRead},
+		0xF4: {a.nopRead, a.zeroPageX, 4, accessRead},
+		0xFA: {a.plx, a.pull, 4, accessNone},
+		0xFC: {a.nopRead, a.absolute, 4, accessRead},
+	}
+	for opcode, entry := range cmos {
+		a.instructionTable[opcode] = entry
+	}
+}
+
+/*
+65C02 Instruction Functions
+*/
+
+// branch always
+func (cpu *CPU) bra() {
+	cpu.branch(true)
+}
+
+// push index X to stack
+func (cpu *CPU) phx() {
+	cpu.value = cpu.X
+}
+
+// push index Y to stack
+func (cpu *CPU) phy() {
+	cpu.value = cpu.Y
+}
+
+// pull index X from stack
+func (cpu *CPU) plx() {
+	cpu.X = cpu.value
+	cpu.setNZFlags(cpu.X)
+}
+
+// pull index Y from stack
+func (cpu *CPU) ply() {
+	cpu.Y = cpu.value
+	cpu.setNZFlags(cpu.Y)
+}
+
+// store zero in memory
+func (cpu *CPU) stz() {
+	cpu.value = 0
+}
+
+// test and reset bits, clears the bits of memory that are set in the accumulator
+func (cpu *CPU) trb() {
+	cpu.setFlag(ZF, cpu.value&cpu.AC == 0)
+	cpu.value &^= cpu.AC
+}
+
+// test and set bits, sets the bits of memory that are set in the accumulator
+func (cpu *CPU) tsb() {
+	cpu.setFlag(ZF, cpu.value&cpu.AC == 0)
+	cpu.value |= cpu.AC
+}
+
+// BIT immediate only changes ZF
+func (cpu *CPU) bitImmediate() {
+	cpu.setFlag(ZF, cpu.value&cpu.AC == 0)
+}
+
+// increment accumulator by 1
+func (cpu *CPU) incA() {
+	cpu.AC++
+	cpu.setNZFlags(cpu.AC)
+}
+
+// decrement accumulator by 1
+func (cpu *CPU) decA() {
+	cpu.AC--
+	cpu.setNZFlags(cpu.AC)
+}
+
+// reset memory bit
+func (cpu *CPU) rmb(bit uint8) func() {
+	return func() {
+		cpu.value = setBit(cpu.value, bit, false)
+	}
+}
+
+// set memory bit
+func (cpu *CPU) smb(bit uint8) func() {
+	return func() {
+		cpu.value = setBit(cpu.value, bit, true)
+	}
+}
+
+// branch on memory bit reset
+func (cpu *CPU) bbr(bit uint8) func() {
+	return func() {
+		cpu.branch(!getBit(int(bit), cpu.value))
+	}
+}
+
+// branch on memory bit set
+func (cpu *CPU) bbs(bit uint8) func() {
+	return func() {
+		cpu.branch(getBit(int(bit), cpu.value))
+	}
+}
+
+// wait for interrupt, the cpu stops until IRQ or NMI is asserted
+func (cpu *CPU) wai() {
+	cpu.Waiting = true
+}
+
+// stop the clock, only Reset restarts the cpu
+func (cpu *CPU) stp() {
+	cpu.Halted = true
+	cpu.Fault = &StoppedError{PC: cpu.PC - 1}
+}
+
+/*
+65C02 Addressing modes
+*/
+
+// (zero page), a zero page pointer holds the address
+func (cpu *CPU) zeroPageIndirect() {
+	switch cpu.cycle {
+	case 2:
+		cpu.pointer = cpu.fetch()
+	case 3:
+		cpu.OperandAddr = uint16(cpu.read(uint16(cpu.pointer)))
+	case 4:
+		cpu.OperandAddr |= uint16(cpu.read(uint16(cpu.pointer+1))) << 8
+	default:
+		cpu.memoryAccess(cpu.cycle - 5)
+	}
+}
+
+// (absolute, X), only used by JMP
+func (cpu *CPU) absoluteIndexedIndirect() {
+	switch cpu.cycle {
+	case 2:
+		cpu.baseAddr = uint16(cpu.fetch())
+	case 3:
+		cpu.baseAddr |= uint16(cpu.fetch()) << 8
+	case 4:
+		cpu.read(cpu.PC - 1)
+		cpu.baseAddr += uint16(cpu.X)
+	case 5:
+		cpu.OperandAddr = uint16(cpu.read(cpu.baseAddr))
+	case 6:
+		cpu.OperandAddr |= uint16(cpu.read(cpu.baseAddr+1)) << 8
+		cpu.instruction.instr()
+		cpu.finished = true
+	}
+}
+
+// indirect JMP without the page wrap bug, it takes an extra cycle
+func (cpu *CPU) indirectCMOS() {
+	switch cpu.cycle {
+	case 2:
+		cpu.baseAddr = uint16(cpu.fetch())
+	case 3:
+		cpu.baseAddr |= uint16(cpu.fetch()) << 8
+	case 4:
+		cpu.read(cpu.PC - 1)
+	case 5:
+		cpu.OperandAddr = uint16(cpu.read(cpu.baseAddr))
+	case 6:
+		cpu.OperandAddr |= uint16(cpu.read(cpu.baseAddr+1)) << 8
+		cpu.instruction.instr()
+		cpu.finished = true
+	}
+}
+
+// zero page, relative, used by BBR and BBS.
+// tests a bit of a zero page byte then branches like relative
+func (cpu *CPU) zeroPageRelative() {
+	switch cpu.cycle {
+	case 2:
+		cpu.OperandAddr = uint16(cpu.fetch())
+	case 3:
+		cpu.value = cpu.read(cpu.OperandAddr)
+	case 4:
+		cpu.read(cpu.OperandAddr)
+	case 5:
+		offset := cpu.fetch()
+		cpu.OperandAddr = cpu.PC + uint16(int8(offset))
+		cpu.instruction.instr()
+		if !cpu.takeBranch {
+			cpu.finished = true
+			return
+		}
+		cpu.expectedCycles++
+	case 6:
+		cpu.read(cpu.PC)
+		newPC := cpu.PC&0xFF00 | cpu.OperandAddr&0x00FF
+		cpu.PC = newPC
+		if newPC == cpu.OperandAddr {
+			cpu.finished = true
+			return
+		}
+		cpu.expectedCycles++
+	case 7:
+		cpu.read(cpu.PC)
+		cpu.PC = cpu.OperandAddr
+		cpu.finished = true
+	}
+}
+
+// implied instructions that take 3 cycles (WAI, STP)
+func (cpu *CPU) impliedSlow() {
+	cpu.read(cpu.PC)
+	if cpu.cycle == 3 {
+		cpu.instruction.instr()
+		cpu.finished = true
+	}
+}
+
+// the 8 cycle NOP ($5C), reads an absolute address then spins reading $FFxx
+func (cpu *CPU) longNOP() {
+	switch cpu.cycle {
+	case 2:
+		cpu.OperandAddr = uint16(cpu.fetch())
+	case 3:
+		cpu.OperandAddr |= uint16(cpu.fetch()) << 8
+	default:
+		cpu.read(0xFF00 | cpu.OperandAddr&0x00FF)
+		if cpu.cycle == 8 {
+			cpu.finished = true
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package nes
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSTP(t *testing.T) {
+	bus := CreateFlatBus(CMOS65C02)
+	bus.Load([]byte{0xEA, 0xDB, 0xEA}, 0x0200) //NOP, STP, NOP
+	bus.CPU.PC = 0x0200
+	if _, err := bus.Step(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := bus.Step()
+	var stopped *StoppedError
+	if !errors.As(err, &stopped) {
+		t.Fatalf("stepping STP returned %v", err)
+	}
+	if stopped.PC != 0x0201 {
+		t.Errorf("STP reported at $%04X, expected $0201", stopped.PC)
+	}
+
+	//the cpu stays stopped, every clock returns the same error
+	for i := 0; i < 10; i++ {
+		if err := bus.Clock(); !errors.As(err, &stopped) {
+			t.Fatalf("clock %d after STP returned %v", i, err)
+		}
+	}
+	if bus.CPU.PC != 0x0202 {
+		t.Errorf("PC moved to $%04X after STP", bus.CPU.PC)
+	}
+}
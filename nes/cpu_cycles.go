@@ -0,0 +1,380 @@
+package nes
+
+/*
+Addressing modes
+each call runs one cycle of the instruction (cpu.cycle, the opcode fetch is cycle 1) and
+performs exactly the bus access the 6502 does on that cycle, including the dummy reads
+and writes. The addressing mode sets cpu.finished on the instruction's last cycle
+*/
+
+// read performs a bus read
+func (cpu *CPU) read(addr uint16) uint8 {
+	return cpu.Bus.GetCPUByte(addr)
+}
+
+// write performs a bus write
+func (cpu *CPU) write(addr uint16, value uint8) {
+	cpu.Bus.SetCPUByte(addr, value)
+}
+
+// fetches the byte at PC and increments PC
+func (cpu *CPU) fetch() uint8 {
+	value := cpu.read(cpu.PC)
+	cpu.PC++
+	return value
+}
+
+// memoryAccess performs the accesses to OperandAddr once it's known,
+// step counts the cycles since the address was formed (0 is the first access)
+func (cpu *CPU) memoryAccess(step int) {
+	switch cpu.instruction.access {
+	case accessRead:
+		cpu.value = cpu.read(cpu.OperandAddr)
+		cpu.instruction.instr()
+		cpu.finished = true
+	case accessWrite:
+		cpu.instruction.instr()
+		cpu.write(cpu.OperandAddr, cpu.value)
+		cpu.finished = true
+	case accessRMW:
+		switch step {
+		case 0:
+			cpu.value = cpu.read(cpu.OperandAddr)
+		case 1:
+			if cpu.Variant == CMOS65C02 {
+				cpu.read(cpu.OperandAddr) //the 65C02 reads again instead of writing
+			} else {
+				cpu.write(cpu.OperandAddr, cpu.value) //the unmodified value is written back while the ALU works
+			}
+			cpu.instruction.instr()
+		case 2:
+			cpu.write(cpu.OperandAddr, cpu.value)
+			cpu.finished = true
+		}
+	}
+}
+
+// implied, reads the next byte and throws it away
+func (cpu *CPU) implied() {
+	cpu.read(cpu.PC)
+	cpu.instruction.instr()
+	cpu.finished = true
+}
+
+// accumulator, behaves like implied
+func (cpu *CPU) accumulator() {
+	cpu.implied()
+}
+
+// immediate, operand is the byte after the opcode
+func (cpu *CPU) immediate() {
+	cpu.OperandAddr = cpu.PC
+	cpu.value = cpu.fetch()
+	cpu.instruction.instr()
+	cpu.finished = true
+}
+
+// zero page, operand is in the first 256 bytes
+func (cpu *CPU) zeroPage() {
+	if cpu.cycle == 2 {
+		cpu.OperandAddr = uint16(cpu.fetch())
+		return
+	}
+	cpu.memoryAccess(cpu.cycle - 3)
+}
+
+// zero page indexed, the index is added while the unindexed address is read
+// the result wraps around in the zero page
+func (cpu *CPU) zeroPageIndexed(index uint8) {
+	switch cpu.cycle {
+	case 2:
+		cpu.OperandAddr = uint16(cpu.fetch())
+	case 3:
+		cpu.read(cpu.OperandAddr)
+		cpu.OperandAddr = uint16(uint8(cpu.OperandAddr) + index)
+	default:
+		cpu.memoryAccess(cpu.cycle - 4)
+	}
+}
+
+// zero page indexed by X
+func (cpu *CPU) zeroPageX() {
+	cpu.zeroPageIndexed(cpu.X)
+}
+
+// zero page indexed by Y
+func (cpu *CPU) zeroPageY() {
+	cpu.zeroPageIndexed(cpu.Y)
+}
+
+// absolute, operand is at the 16 bit address after the opcode
+func (cpu *CPU) absolute() {
+	switch cpu.cycle {
+	case 2:
+		cpu.OperandAddr = uint16(cpu.fetch())
+	case 3:
+		cpu.OperandAddr |= uint16(cpu.fetch()) << 8
+		if cpu.instruction.access == accessJump {
+			cpu.instruction.instr()
+			cpu.finished = true
+		}
+	default:
+		cpu.memoryAccess(cpu.cycle - 4)
+	}
+}
+
+// addIndex adds an index to the low byte of baseAddr without carrying into the high byte,
+// the carry is fixed up a cycle later by fixAddress
+func (cpu *CPU) addIndex(index uint8) {
+	low := uint16(uint8(cpu.baseAddr) + index)
+	cpu.pageCrossed = uint16(uint8(cpu.baseAddr))+uint16(index) > 0xFF
+	cpu.OperandAddr = cpu.baseAddr&0xFF00 | low
+}
+
+// fixAddress is the cycle after an index was added.
+// reads that didn't cross a page get their operand now, everything else reads
+// the unfixed (possibly wrong) address and waits a cycle for the carry.
+// The 65C02's shifts with abs,X (6 cycles in its table) also skip the wait without a page cross,
+// and on a page cross it reads the last operand byte instead of the wrong address
+func (cpu *CPU) fixAddress() {
+	penalty := cpu.instruction.access == accessRead || (cpu.instruction.access == accessRMW && cpu.instruction.cycles < 7)
+	if penalty && !cpu.pageCrossed {
+		cpu.memoryAccess(0)
+		return
+	}
+	if cpu.Variant == CMOS65C02 && cpu.pageCrossed {
+		cpu.read(cpu.PC - 1)
+	} else {
+		cpu.read(cpu.OperandAddr)
+	}
+	if cpu.pageCrossed {
+		cpu.OperandAddr += 0x100
+		if penalty {
+			cpu.expectedCycles++ //page crossing penalty
+		}
+	}
+}
+
+// absolute indexed, 16 bit address plus an index
+func (cpu *CPU) absoluteIndexed(index uint8) {
+	switch cpu.cycle {
+	case 2:
+		cpu.baseAddr = uint16(cpu.fetch())
+	case 3:
+		cpu.baseAddr |= uint16(cpu.fetch()) << 8
+		cpu.addIndex(index)
+	case 4:
+		cpu.fixAddress()
+	default:
+		cpu.memoryAccess(cpu.cycle - 5)
+	}
+}
+
+// absolute indexed by X
+func (cpu *CPU) absoluteX() {
+	cpu.absoluteIndexed(cpu.X)
+}
+
+// absolute indexed by Y
+func (cpu *CPU) absoluteY() {
+	cpu.absoluteIndexed(cpu.Y)
+}
+
+// (indirect, X), X is added to a zero page pointer which holds the address
+func (cpu *CPU) indexIndirect() {
+	switch cpu.cycle {
+	case 2:
+		cpu.pointer = cpu.fetch()
+	case 3:
+		cpu.read(uint16(cpu.pointer))
+		cpu.pointer += cpu.X
+	case 4:
+		cpu.OperandAddr = uint16(cpu.read(uint16(cpu.pointer)))
+	case 5:
+		cpu.OperandAddr |= uint16(cpu.read(uint16(cpu.pointer+1))) << 8 //pointer wraps in the zero page
+	default:
+		cpu.memoryAccess(cpu.cycle - 6)
+	}
+}
+
+// (indirect), Y, a zero page pointer holds an address which is indexed by Y
+func (cpu *CPU) indirectIndex() {
+	switch cpu.cycle {
+	case 2:
+		cpu.pointer = cpu.fetch()
+	case 3:
+		cpu.baseAddr = uint16(cpu.read(uint16(cpu.pointer)))
+	case 4:
+		cpu.baseAddr |= uint16(cpu.read(uint16(cpu.pointer+1))) << 8
+		cpu.addIndex(cpu.Y)
+	case 5:
+		cpu.fixAddress()
+	default:
+		cpu.memoryAccess(cpu.cycle - 6)
+	}
+}
+
+// relative, used by branches.
+// a taken branch takes a cycle to add the offset and another if it crosses a page
+func (cpu *CPU) relative() {
+	switch cpu.cycle {
+	case 2:
+		offset := cpu.fetch()
+		cpu.OperandAddr = cpu.PC + uint16(int8(offset))
+		cpu.instruction.instr()
+		if !cpu.takeBranch {
+			cpu.finished = true
+			return
+		}
+		cpu.expectedCycles++
+	case 3:
+		cpu.read(cpu.PC)
+		newPC := cpu.PC&0xFF00 | cpu.OperandAddr&0x00FF
+		if newPC == cpu.OperandAddr {
+			cpu.PC = newPC
+			cpu.finished = true
+			cpu.interruptPending = cpu.lastPoll //a taken branch without a page cross doesn't poll interrupts
+			return
+		}
+		cpu.PC = newPC
+		cpu.expectedCycles++
+	case 4:
+		cpu.read(cpu.PC)
+		cpu.PC = cpu.OperandAddr
+		cpu.finished = true
+	}
+}
+
+// indirect, only used by JMP
+// the high byte of the target is read without carrying into the pointer's high byte
+func (cpu *CPU) indirect() {
+	switch cpu.cycle {
+	case 2:
+		cpu.baseAddr = uint16(cpu.fetch())
+	case 3:
+		cpu.baseAddr |= uint16(cpu.fetch()) << 8
+	case 4:
+		cpu.OperandAddr = uint16(cpu.read(cpu.baseAddr))
+	case 5:
+		highAddr := cpu.baseAddr&0xFF00 | uint16(uint8(cpu.baseAddr)+1)
+		cpu.OperandAddr |= uint16(cpu.read(highAddr)) << 8
+		cpu.instruction.instr()
+		cpu.finished = true
+	}
+}
+
+// push, used by PHA and PHP, the instruction puts the value to push in cpu.value
+func (cpu *CPU) push() {
+	switch cpu.cycle {
+	case 2:
+		cpu.read(cpu.PC)
+	case 3:
+		cpu.instruction.instr()
+		cpu.pushByte(cpu.value)
+		cpu.finished = true
+	}
+}
+
+// pull, used by PLA and PLP, the instruction uses the value pulled in cpu.value
+func (cpu *CPU) pull() {
+	switch cpu.cycle {
+	case 2:
+		cpu.read(cpu.PC)
+	case 3:
+		cpu.read(0x100 + uint16(cpu.SP))
+	case 4:
+		cpu.value = cpu.popByte()
+		cpu.instruction.instr()
+		cpu.finished = true
+	}
+}
+
+// jump to subroutine, pushes the address of the last byte of the JSR
+func (cpu *CPU) jumpSubroutine() {
+	switch cpu.cycle {
+	case 2:
+		cpu.OperandAddr = uint16(cpu.fetch())
+	case 3:
+		cpu.read(0x100 + uint16(cpu.SP))
+	case 4:
+		cpu.pushByte(uint8(cpu.PC >> 8))
+	case 5:
+		cpu.pushByte(uint8(cpu.PC))
+	case 6:
+		cpu.OperandAddr |= uint16(cpu.read(cpu.PC)) << 8
+		cpu.PC = cpu.OperandAddr
+		cpu.finished = true
+	}
+}
+
+// return from subroutine, pulls PC and adds one
+func (cpu *CPU) returnSubroutine() {
+	switch cpu.cycle {
+	case 2:
+		cpu.read(cpu.PC)
+	case 3:
+		cpu.read(0x100 + uint16(cpu.SP))
+	case 4:
+		cpu.PC = uint16(cpu.popByte())
+	case 5:
+		cpu.PC |= uint16(cpu.popByte()) << 8
+	case 6:
+		cpu.fetch()
+		cpu.finished = true
+	}
+}
+
+// return from interrupt, pulls SR (through the instruction) then PC
+func (cpu *CPU) returnInterrupt() {
+	switch cpu.cycle {
+	case 2:
+		cpu.read(cpu.PC)
+	case 3:
+		cpu.read(0x100 + uint16(cpu.SP))
+	case 4:
+		cpu.value = cpu.popByte()
+		cpu.instruction.instr()
+	case 5:
+		cpu.PC = uint16(cpu.popByte())
+	case 6:
+		cpu.PC |= uint16(cpu.popByte()) << 8
+		cpu.finished = true
+	}
+}
+
+// interruptSequence is BRK, IRQ and NMI.
+// BRK skips its padding byte and pushes SR with the B flag set, hardware interrupts don't.
+// An NMI that arrives before the vector is picked takes over the sequence
+func (cpu *CPU) interruptSequence() {
+	switch cpu.cycle {
+	case 2:
+		cpu.read(cpu.PC)
+		if !cpu.hardwareIRQ {
+			cpu.PC++
+		}
+	case 3:
+		cpu.pushByte(uint8(cpu.PC >> 8))
+	case 4:
+		cpu.pushByte(uint8(cpu.PC))
+	case 5:
+		status := cpu.SR | 0b00100000
+		if !cpu.hardwareIRQ {
+			status |= 0b00010000
+		}
+		cpu.pushByte(status)
+		cpu.baseAddr = 0xFFFE
+		if cpu.nmiPending {
+			cpu.nmiPending = false
+			cpu.baseAddr = 0xFFFA
+		}
+	case 6:
+		cpu.PC = uint16(cpu.read(cpu.baseAddr))
+		cpu.setFlag(IF, true)
+		if cpu.Variant == CMOS65C02 {
+			cpu.setFlag(DF, false) //the 65C02 leaves decimal mode for interrupt handlers
+		}
+	case 7:
+		cpu.PC |= uint16(cpu.read(cpu.baseAddr+1)) << 8
+		cpu.finished = true
+	}
+}
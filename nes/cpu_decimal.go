@@ -0,0 +1,93 @@
+package nes
+
+/*
+Decimal (BCD) mode of ADC and SBC
+the 2A03 had the decimal circuit disconnected, the stock NMOS 6502 still has it.
+On the NMOS chip only the accumulator and C are valid BCD results,
+N, V and Z come from the intermediate steps of the adder.
+The 65C02 fixes N and Z at the cost of an extra cycle
+*/
+
+// decimalMode returns true if ADC and SBC should do BCD arithmetic
+func (cpu *CPU) decimalMode() bool {
+	return cpu.Variant != NES2A03 && cpu.GetFlag(DF)
+}
+
+// BCD add with carry
+func (cpu *CPU) adcDecimal(value uint8) {
+	carry := uint16(0)
+	if cpu.GetFlag(CF) {
+		carry = 1
+	}
+	ac := uint16(cpu.AC)
+	operand := uint16(value)
+	low := ac&0x0F + operand&0x0F + carry
+	if low > 0x09 {
+		low += 0x06 //decimal adjust the low digit
+	}
+	high := ac&0xF0 + operand&0xF0
+	if low > 0x0F {
+		high += 0x10
+	}
+	cpu.setFlag(ZF, uint8(ac+operand+carry) == 0) //Z is from the binary sum
+	cpu.setFlag(NF, high&0x80 > 0)                //N and V are from before the high digit is adjusted
+	cpu.setFlag(OF, ^(ac^operand)&(ac^high)&0x80 > 0)
+	if high > 0x9F {
+		high += 0x60 //decimal adjust the high digit
+	}
+	cpu.setFlag(CF, high > 0xFF)
+	cpu.AC = uint8(high&0xF0 | low&0x0F)
+	if cpu.Variant == CMOS65C02 {
+		cpu.setNZFlags(cpu.AC)
+		cpu.addDecimalCycle()
+	}
+}
+
+// BCD subtract with borrow
+// flags are the same as binary SBC, only the result is adjusted
+func (cpu *CPU) sbcDecimal(value uint8) {
+	borrow := 1
+	if cpu.GetFlag(CF) {
+		borrow = 0
+	}
+	ac := int(cpu.AC)
+	operand := int(value)
+	if cpu.Variant == CMOS65C02 {
+		cpu.sbcDecimalCMOS(ac, operand, borrow)
+		return
+	}
+	low := ac&0x0F - operand&0x0F - borrow
+	high := ac&0xF0 - operand&0xF0
+	if low&0x10 != 0 { //low digit borrowed
+		low -= 0x06
+		high -= 0x10
+	}
+	if high&0x100 != 0 { //high digit borrowed
+		high -= 0x60
+	}
+	cpu.adcValue(^value) //sets the flags
+	cpu.AC = uint8(high&0xF0 | low&0x0F)
+}
+
+// the 65C02 adjusts the binary difference instead of each digit,
+// N and Z are from the adjusted result
+func (cpu *CPU) sbcDecimalCMOS(ac int, operand int, borrow int) {
+	low := ac&0x0F - operand&0x0F - borrow
+	result := ac - operand - borrow
+	if result < 0 {
+		result -= 0x60
+	}
+	if low < 0 {
+		result -= 0x06
+	}
+	cpu.adcValue(^uint8(operand)) //sets C and V
+	cpu.AC = uint8(result)
+	cpu.setNZFlags(cpu.AC)
+	cpu.addDecimalCycle()
+}
+
+// addDecimalCycle adds the 65C02's decimal correction cycle after the current one
+func (cpu *CPU) addDecimalCycle() {
+	cpu.decimalCycle = true
+	cpu.expectedCycles++
+}
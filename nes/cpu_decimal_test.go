@@ -0,0 +1,67 @@
+package nes
+
+import "testing"
+
+func TestDecimalMode(t *testing.T) {
+	const adc, sbc = 0x69, 0xE9 //immediate
+	tests := []struct {
+		variant CPUVariant
+		opcode  uint8
+		a, b    uint8
+		carry   bool
+		result  uint8
+		flags   string //NVZC set after the instruction
+		cycles  int
+	}{
+		{NMOS6502, adc, 0x12, 0x34, false, 0x46, "", 2},
+		{NMOS6502, adc, 0x58, 0x46, true, 0x05, "NVC", 2},
+		{NMOS6502, adc, 0x99, 0x01, false, 0x00, "NC", 2}, //N from the unadjusted high digit, Z from the binary sum
+		{NMOS6502, adc, 0x80, 0x80, false, 0x60, "VZC", 2},
+		{NMOS6502, sbc, 0x46, 0x12, true, 0x34, "C", 2},
+		{NMOS6502, sbc, 0x40, 0x13, true, 0x27, "C", 2},
+		{NMOS6502, sbc, 0x00, 0x01, true, 0x99, "N", 2},
+		{NMOS6502, sbc, 0x21, 0x20, false, 0x00, "ZC", 2},
+		{CMOS65C02, adc, 0x12, 0x34, false, 0x46, "", 3},
+		{CMOS65C02, adc, 0x58, 0x46, true, 0x05, "VC", 3},
+		{CMOS65C02, adc, 0x99, 0x01, false, 0x00, "ZC", 3}, //N and Z from the adjusted result
+		{CMOS65C02, adc, 0x80, 0x80, false, 0x60, "VC", 3},
+		{CMOS65C02, sbc, 0x46, 0x12, true, 0x34, "C", 3},
+		{CMOS65C02, sbc, 0x40, 0x13, true, 0x27, "C", 3},
+		{CMOS65C02, sbc, 0x00, 0x01, true, 0x99, "N", 3},
+		{CMOS65C02, sbc, 0x21, 0x20, false, 0x00, "ZC", 3},
+		{NES2A03, adc, 0x58, 0x46, true, 0x9F, "NV", 2}, //the 2A03 ignores the decimal flag
+		{NES2A03, sbc, 0x00, 0x01, true, 0xFF, "N", 2},
+	}
+	flagBits := map[byte]uint8{'N': 1 << NF, 'V': 1 << OF, 'Z': 1 << ZF, 'C': 1 << CF}
+	for _, test := range tests {
+		carry := uint8(0x18) //CLC
+		if test.carry {
+			carry = 0x38 //SEC
+		}
+		bus := CreateFlatBus(test.variant)
+		bus.Load([]byte{0xF8, carry, 0xA9, test.a, test.opcode, test.b}, 0x0200) //SED, CLC/SEC, LDA #a, ADC/SBC #b
+		bus.CPU.PC = 0x0200
+		var step StepInfo
+		var err error
+		for i := 0; i < 4; i++ {
+			if step, err = bus.Step(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var flags uint8
+		for _, flag := range []byte(test.flags) {
+			flags |= flagBits[flag]
+		}
+		name := "ADC"
+		if test.opcode == sbc {
+			name = "SBC"
+		}
+		if bus.CPU.AC != test.result || bus.CPU.SR&0xC3 != flags {
+			t.Errorf("%v: $%02X %s $%02X C=%t gave $%02X flags %08b, expected $%02X %q", test.variant, test.a, name, test.b, test.carry, bus.CPU.AC, bus.CPU.SR&0xC3, test.result, test.flags)
+		}
+		if step.Cycles != test.cycles {
+			t.Errorf("%v: %s took %d cycles, expected %d", test.variant, name, step.Cycles, test.cycles)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package nes
+
+/*
+Undocumented (illegal) instructions
+Most are two documented instructions sharing one opcode, EX: SLO is ASL then ORA.
+The unstable ones (XAA, LXA, SHA, SHX, SHY, TAS) depend on analog effects, these
+implement the behavior most chips show
+*/
+
+// magic constant ORed into A by XAA and LXA, varies by chip and temperature
+const unstableMagic = 0xEE
+
+// KIL/JAM, locks up the cpu until it is reset
+func (cpu *CPU) kil() {
+	cpu.PC-- //stay on the opcode
+	cpu.Halted = true
+	cpu.Fault = &InvalidOpcodeError{PC: cpu.PC, Opcode: cpu.opcode}
+}
+
+// multi-byte NOP, reads its operand and does nothing with it
+// the abs,X variants take an extra cycle on a page cross like a real read
+func (cpu *CPU) nopRead() {
+}
+
+// ASL memory then ORA with the result
+func (cpu *CPU) slo() {
+	cpu.asl()
+	cpu.ora()
+}
+
+// ROL memory then AND with the result
+func (cpu *CPU) rla() {
+	cpu.rol()
+	cpu.and()
+}
+
+// LSR memory then EOR with the result
+func (cpu *CPU) sre() {
+	cpu.lsr()
+	cpu.eor()
+}
+
+// ROR memory then ADC with the result
+func (cpu *CPU) rra() {
+	cpu.ror()
+	cpu.adc()
+}
+
+// store A & X
+func (cpu *CPU) sax() {
+	cpu.value = cpu.AC & cpu.X
+}
+
+// load memory into A and X
+func (cpu *CPU) lax() {
+	cpu.AC = cpu.value
+	cpu.X = cpu.AC
+	cpu.setNZFlags(cpu.AC)
+}
+
+// DEC memory then CMP with the result
+func (cpu *CPU) dcp() {
+	cpu.dec()
+	cpu.cmp()
+}
+
+// INC memory then SBC with the result
+func (cpu *CPU) isc() {
+	cpu.inc()
+	cpu.sbc()
+}
+
+// AND immediate then copy N into C
+func (cpu *CPU) anc() {
+	cpu.and()
+	cpu.setFlag(CF, cpu.GetFlag(NF))
+}
+
+// AND immediate then LSR A
+func (cpu *CPU) alr() {
+	cpu.and()
+	cpu.lsrA()
+}
+
+// AND immediate then ROR A, C is bit 6 of the result and V is bit 6 xor bit 5
+func (cpu *CPU) arr() {
+	cpu.and()
+	cpu.rorA()
+	cpu.setFlag(CF, cpu.AC&0x40 > 0)
+	cpu.setFlag(OF, (cpu.AC>>6^cpu.AC>>5)&0x1 > 0)
+}
+
+// X = (A & X) - immediate, sets flags like CMP
+func (cpu *CPU) axs() {
+	andValue := cpu.AC & cpu.X
+	cpu.compareFunc(andValue, cpu.value)
+	cpu.X = andValue - cpu.value
+}
+
+// A = (A | magic) & X & immediate (ANE)
+func (cpu *CPU) xaa() {
+	cpu.AC = (cpu.AC | unstableMagic) & cpu.X & cpu.value
+	cpu.setNZFlags(cpu.AC)
+}
+
+// A = X = (A | magic) & immediate (LXA/LAX immediate)
+func (cpu *CPU) lxa() {
+	cpu.AC = (cpu.AC | unstableMagic) & cpu.value
+	cpu.X = cpu.AC
+	cpu.setNZFlags(cpu.AC)
+}
+
+// A = X = SP = memory & SP
+func (cpu *CPU) las() {
+	value := cpu.value & cpu.SP
+	cpu.AC = value
+	cpu.X = value
+	cpu.SP = value
+	cpu.setNZFlags(value)
+}
+
+// storeHighAnd is the shared behavior of SHA, SHX, SHY and TAS.
+// they store value & (high byte of the base address + 1), and when indexing crosses a page
+// the stored value also replaces the high byte of the address
+func (cpu *CPU) storeHighAnd(value uint8) {
+	cpu.value = value & (uint8(cpu.baseAddr>>8) + 1)
+	if cpu.pageCrossed {
+		cpu.OperandAddr = uint16(cpu.value)<<8 | cpu.OperandAddr&0x00FF
+	}
+}
+
+// store A & X & (H + 1) (AHX)
+func (cpu *CPU) sha() {
+	cpu.storeHighAnd(cpu.AC & cpu.X)
+}
+
+// store X & (H + 1)
+func (cpu *CPU) shx() {
+	cpu.storeHighAnd(cpu.X)
+}
+
+// store Y & (H + 1)
+func (cpu *CPU) shy() {
+	cpu.storeHighAnd(cpu.Y)
+}
+
+// SP = A & X then store SP & (H + 1)
+func (cpu *CPU) tas() {
+	cpu.SP = cpu.AC & cpu.X
+	cpu.storeHighAnd(cpu.SP)
+}
@@ -0,0 +1,69 @@
+package nes
+
+// Registers is a copy of the cpu's registers
+type Registers struct {
+	PC uint16
+	AC uint8
+	X  uint8
+	Y  uint8
+	SR uint8
+	SP uint8
+}
+
+// StepInfo describes an instruction run by Step
+type StepInfo struct {
+	PC            uint16   //address of the opcode
+	Opcode        uint8    //when Interrupt is set this opcode was fetched but not run
+	Size          int      //size of the instruction in bytes, opcode included
+	Operands      [2]uint8 //bytes after the opcode, Size-1 of them are used
+	EffectiveAddr uint16   //address the instruction read, wrote or jumped to, 0 if it has none
+	Cycles        int      //cycles taken, page cross and branch penalties included
+	PageCrossed   bool     //indexing carried into the high byte of the address
+	BranchTaken   bool
+	Interrupt     bool //an IRQ or NMI sequence ran instead of the instruction at PC
+	Before        Registers
+	After         Registers
+}
+
+// Registers returns a copy of the cpu's registers
+func (cpu *CPU) Registers() Registers {
+	return Registers{cpu.PC, cpu.AC, cpu.X, cpu.Y, cpu.SR, cpu.SP}
+}
+
+// Step clocks only the cpu until it finishes an instruction and describes what ran.
+// Systems have their own Step that clocks the rest of the hardware alongside the cpu.
+// Returns cpu.Fault if the cpu halted
+func (cpu *CPU) Step() (StepInfo, error) {
+	return cpu.stepWith(cpu.Clock)
+}
+
+// stepWith calls clock until the cpu finishes an instruction,
+// if the cpu is in the middle of an instruction that one is finished and described from the opcode it already fetched.
+// Before is the registers when stepWith was called, part way through the instruction in that case
+func (cpu *CPU) stepWith(clock func() error) (StepInfo, error) {
+	bus := peekBus{cpu.Bus}
+	info := StepInfo{PC: cpu.PC, Before: cpu.Registers()}
+	if cpu.RemCycles > 0 {
+		info.PC = cpu.opcodeAddr
+	}
+	info.Opcode = bus.GetCPUByte(info.PC)
+	if cpu.RemCycles > 0 && !cpu.hardwareIRQ {
+		info.Opcode = cpu.opcode //the instruction could have overwritten its own opcode since
+	}
+	info.Size = variantNameTable(cpu.Variant)[info.Opcode].addrMode.size()
+	for i := 1; i < info.Size; i++ {
+		info.Operands[i-1] = bus.GetCPUByte(info.PC + uint16(i))
+	}
+	err := clock()
+	info.Cycles++
+	for err == nil && cpu.RemCycles > 0 {
+		err = clock()
+		info.Cycles++
+	}
+	info.Interrupt = cpu.hardwareIRQ
+	info.EffectiveAddr = cpu.OperandAddr
+	info.PageCrossed = cpu.pageCrossed
+	info.BranchTaken = cpu.takeBranch
+	info.After = cpu.Registers()
+	return info, err
+}
@@ -0,0 +1,30 @@
+package nes
+
+import "testing"
+
+func TestStepMidInstruction(t *testing.T) {
+	bus := CreateFlatBus(NES2A03)
+	bus.Load([]byte{0x4C, 0x00, 0x03}, 0x0200) //JMP $0300
+	bus.Load([]byte{0xEA}, 0x0300)             //NOP
+	bus.CPU.PC = 0x0200
+	bus.Clock()
+	bus.Clock() //PC has moved past the opcode and the low byte of the address
+	step, err := bus.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if step.PC != 0x0200 || step.Opcode != 0x4C || step.Size != 3 || step.Operands != [2]uint8{0x00, 0x03} {
+		t.Errorf("finishing the JMP was described as opcode %02X %v at $%04X", step.Opcode, step.Operands, step.PC)
+	}
+	if step.Cycles != 1 || step.Before.PC != 0x0202 || step.After.PC != 0x0300 {
+		t.Errorf("took %d cycles from $%04X to $%04X", step.Cycles, step.Before.PC, step.After.PC)
+	}
+
+	//back on an instruction boundary the next step starts at PC
+	if step, err = bus.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if step.PC != 0x0300 || step.Opcode != 0xEA || step.Cycles != 2 {
+		t.Errorf("stepped opcode %02X at $%04X in %d cycles", step.Opcode, step.PC, step.Cycles)
+	}
+}
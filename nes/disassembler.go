@@ -5,8 +5,9 @@ import (
 )
 
 type opCodeAndAddrMode struct {
-	name     string                                          //opcode mnemonics
-	addrMode func(addr uint16, bus *NesSystem) (int, string) //address mode function returns the size and menomic of the instruction
+	name         string      //opcode mnemonics
+	addrMode     addressMode //formats the operand and gives the size of the instruction
+	undocumented bool        //illegal opcode, not in the official instruction set
 }
 
 // addressing mode instruction sizes
@@ -23,75 +24,212 @@ type opCodeAndAddrMode struct {
 // indirect indexed (Y): 2 bytes
 
 var opcodeNameTable = [256]opCodeAndAddrMode{
-	{"BRK", implied}, {"ORA", indexIndirect}, {"XXX", implied}, {"XXX", indexIndirect}, {"XXX", zeroPage}, {"ORA", zeroPage}, {"ASL", zeroPage}, {"XXX", zeroPage}, {"PHP", implied}, {"ORA", immediate}, {"ASL", accumulator}, {"XXX", immediate}, {"XXX", absolute}, {"ORA", absolute}, {"ASL", absolute}, {"XXX", absolute},
-	{"BPL", relative}, {"ORA", indirectIndex}, {"XXX", implied}, {"XXX", indirectIndex}, {"XXX", zeroPageX}, {"ORA", zeroPageX}, {"ASL", zeroPageX}, {"XXX", zeroPageX}, {"CLC", implied}, {"ORA", absoluteY}, {"XXX", implied}, {"XXX", indirectIndex}, {"XXX", absoluteX}, {"ORA", absoluteX}, {"ASL", absoluteX}, {"XXX", absoluteX},
-	{"JSR", absolute}, {"AND", indexIndirect}, {"XXX", implied}, {"XXX", indexIndirect}, {"BIT", zeroPage}, {"AND", zeroPage}, {"ROL", zeroPage}, {"XXX", zeroPage}, {"PLP", implied}, {"AND", immediate}, {"ROL", accumulator}, {"XXX", immediate}, {"BIT", absolute}, {"AND", absolute}, {"ROL", absolute}, {"XXX", absolute},
-	{"BMI", relative}, {"AND", indirectIndex}, {"XXX", implied}, {"XXX", indirectIndex}, {"XXX", zeroPageX}, {"AND", zeroPageX}, {"ROL", zeroPageX}, {"XXX", zeroPageX}, {"SEC", implied}, {"AND", absoluteY}, {"XXX", implied}, {"XXX", indirectIndex}, {"XXX", absoluteX}, {"AND", absoluteX}, {"ROL", absoluteX}, {"XXX", absoluteX},
-	{"RTI", implied}, {"EOR", indexIndirect}, {"XXX", implied}, {"XXX", indexIndirect}, {"XXX", zeroPage}, {"EOR", zeroPage}, {"LSR", zeroPage}, {"XXX", zeroPage}, {"PHA", implied}, {"EOR", immediate}, {"LSR", accumulator}, {"XXX", immediate}, {"JMP", absolute}, {"EOR", absolute}, {"LSR", absolute}, {"XXX", absolute},
-	{"BVC", relative}, {"EOR", indirectIndex}, {"XXX", implied}, {"XXX", indirectIndex}, {"XXX", zeroPageX}, {"EOR", zeroPageX}, {"LSR", zeroPageX}, {"XXX", zeroPageX}, {"CLI", implied}, {"EOR", absoluteY}, {"XXX", implied}, {"XXX", indirectIndex}, {"XXX", absoluteX}, {"EOR", absoluteX}, {"LSR", absoluteX}, {"XXX", absoluteX},
-	{"RTS", implied}, {"ADC", indexIndirect}, {"XXX", implied}, {"XXX", indexIndirect}, {"XXX", zeroPage}, {"ADC", zeroPage}, {"ROR", zeroPage}, {"XXX", zeroPage}, {"PLA", implied}, {"ADC", immediate}, {"ROR", accumulator}, {"XXX", immediate}, {"JMP", indirect}, {"ADC", absolute}, {"ROR", absolute}, {"XXX", absolute},
-	{"BVS", relative}, {"ADC", indirectIndex}, {"XXX", implied}, {"XXX", indirectIndex}, {"XXX", zeroPageX}, {"ADC", zeroPageX}, {"ROR", zeroPageX}, {"XXX", zeroPageX}, {"SEI", implied}, {"ADC", absoluteY}, {"XXX", implied}, {"XXX", indexIndirect}, {"XXX", absoluteX}, {"ADC", absoluteX}, {"ROR", absoluteX}, {"XXX", absoluteX},
-	{"XXX", immediate}, {"STA", indexIndirect}, {"XXX", immediate}, {"XXX", indexIndirect}, {"STY", zeroPage}, {"STA", zeroPage}, {"STX", zeroPage}, {"XXX", zeroPage}, {"DEY", implied}, {"XXX", immediate}, {"TXA", implied}, {"XXX", immediate}, {"STY", absolute}, {"STA", absolute}, {"STX", absolute}, {"XXX", absolute},
-	{"BCC", relative}, {"STA", indirectIndex}, {"XXX", implied}, {"XXX", indirectIndex}, {"STY", zeroPageX}, {"STA", zeroPageX}, {"STX", zeroPageY}, {"XXX", zeroPageY}, {"TYA", implied}, {"STA", absoluteY}, {"TXS", implied}, {"XXX", absoluteY}, {"XXX", absoluteX}, {"STA", absoluteX}, {"XXX", absoluteY}, {"XXX", absoluteY},
-	{"LDY", immediate}, {"LDA", indexIndirect}, {"LDX", immediate}, {"XXX", indexIndirect}, {"LDY", zeroPage}, {"LDA", zeroPage}, {"LDX", zeroPage}, {"XXX", zeroPage}, {"TAY", implied}, {"LDA", immediate}, {"TAX", implied}, {"XXX", immediate}, {"LDY", absolute}, {"LDA", absolute}, {"LDX", absolute}, {"XXX", absolute},
-	{"BCS", relative}, {"LDA", indirectIndex}, {"XXX", implied}, {"XXX", indirectIndex}, {"LDY", zeroPageX}, {"LDA", zeroPageX}, {"LDX", zeroPageY}, {"XXX", zeroPageY}, {"CLV", implied}, {"LDA", absoluteY}, {"TSX", implied}, {"XXX", absoluteY}, {"LDY", absoluteX}, {"LDA", absoluteX}, {"LDX", absoluteY}, {"XXX", absoluteY},
-	{"CPY", immediate}, {"CMP", indexIndirect}, {"XXX", immediate}, {"XXX", indexIndirect}, {"CPY", zeroPage}, {"CMP", zeroPage}, {"DEC", zeroPage}, {"XXX", zeroPage}, {"INY", implied}, {"CMP", immediate}, {"DEX", implied}, {"XXX", immediate}, {"CPY", absolute}, {"CMP", absolute}, {"DEC", absolute}, {"XXX", absolute},
-	{"BNE", relative}, {"CMP", indirectIndex}, {"XXX", implied}, {"XXX", indirectIndex}, {"XXX", zeroPageX}, {"CMP", zeroPageX}, {"DEC", zeroPageX}, {"XXX", zeroPageX}, {"CLD", implied}, {"CMP", absoluteY}, {"XXX", implied}, {"XXX", absoluteY}, {"XXX", absoluteX}, {"CMP", absoluteX}, {"DEC", absoluteX}, {"XXX", absoluteX},
-	{"CPX", immediate}, {"SBC", indexIndirect}, {"XXX", immediate}, {"XXX", indexIndirect}, {"CPX", zeroPage}, {"SBC", zeroPage}, {"INC", zeroPage}, {"XXX", zeroPage}, {"INX", implied}, {"SBC", immediate}, {"NOP", implied}, {"XXX", immediate}, {"CPX", absolute}, {"SBC", absolute}, {"INC", absolute}, {"XXX", absolute},
-	{"BEQ", relative}, {"SBC", indirectIndex}, {"XXX", implied}, {"XXX", indirectIndex}, {"XXX", zeroPageX}, {"SBC", zeroPageX}, {"INC", zeroPageX}, {"XXX", zeroPageX}, {"SED", implied}, {"SBC", absoluteY}, {"XXX", implied}, {"XXX", absoluteY}, {"XXX", absoluteX}, {"SBC", absoluteX}, {"INC", absoluteX}, {"XXX", absoluteX},
+	{"BRK", implied, false}, {"ORA", indexIndirect, false}, {"KIL", implied, true}, {"SLO", indexIndirect, true}, {"NOP", zeroPage, true}, {"ORA", zeroPage, false}, {"ASL", zeroPage, false}, {"SLO", zeroPage, true}, {"PHP", implied, false}, {"ORA", immediate, false}, {"ASL", accumulator, false}, {"ANC", immediate, true}, {"NOP", absolute, true}, {"ORA", absolute, false}, {"ASL", absolute, false}, {"SLO", absolute, true},
+	{"BPL", relative, false}, {"ORA", indirectIndex, false}, {"KIL", implied, true}, {"SLO", indirectIndex, true}, {"NOP", zeroPageX, true}, {"ORA", zeroPageX, false}, {"ASL", zeroPageX, false}, {"SLO", zeroPageX, true}, {"CLC", implied, false}, {"ORA", absoluteY, false}, {"NOP", implied, true}, {"SLO", absoluteY, true}, {"NOP", absoluteX, true}, {"ORA", absoluteX, false}, {"ASL", absoluteX, false}, {"SLO", absoluteX, true},
+	{"JSR", absolute, false}, {"AND", indexIndirect, false}, {"KIL", implied, true}, {"RLA", indexIndirect, true}, {"BIT", zeroPage, false}, {"AND", zeroPage, false}, {"ROL", zeroPage, false}, {"RLA", zeroPage, true}, {"PLP", implied, false}, {"AND", immediate, false}, {"ROL", accumulator, false}, {"ANC", immediate, true}, {"BIT", absolute, false}, {"AND", absolute, false}, {"ROL", absolute, false}, {"RLA", absolute, true},
+	{"BMI", relative, false}, {"AND", indirectIndex, false}, {"KIL", implied, true}, {"RLA", indirectIndex, true}, {"NOP", zeroPageX, true}, {"AND", zeroPageX, false}, {"ROL", zeroPageX, false}, {"RLA", zeroPageX, true}, {"SEC", implied, false}, {"AND", absoluteY, false}, {"NOP", implied, true}, {"RLA", absoluteY, true}, {"NOP", absoluteX, true}, {"AND", absoluteX, false}, {"ROL", absoluteX, false}, {"RLA", absoluteX, true},
+	{"RTI", implied, false}, {"EOR", indexIndirect, false}, {"KIL", implied, true}, {"SRE", indexIndirect, true}, {"NOP", zeroPage, true}, {"EOR", zeroPage, false}, {"LSR", zeroPage, false}, {"SRE", zeroPage, true}, {"PHA", implied, false}, {"EOR", immediate, false}, {"LSR", accumulator, false}, {"ALR", immediate, true}, {"JMP", absolute, false}, {"EOR", absolute, false}, {"LSR", absolute, false}, {"SRE", absolute, true},
+	{"BVC", relative, false}, {"EOR", indirectIndex, false}, {"KIL", implied, true}, {"SRE", indirectIndex, true}, {"NOP", zeroPageX, true}, {"EOR", zeroPageX, false}, {"LSR", zeroPageX, false}, {"SRE", zeroPageX, true}, {"CLI", implied, false}, {"EOR", absoluteY, false}, {"NOP", implied, true}, {"SRE", absoluteY, true}, {"NOP", absoluteX, true}, {"EOR", absoluteX, false}, {"LSR", absoluteX, false}, {"SRE", absoluteX, true},
+	{"RTS", implied, false}, {"ADC", indexIndirect, false}, {"KIL", implied, true}, {"RRA", indexIndirect, true}, {"NOP", zeroPage, true}, {"ADC", zeroPage, false}, {"ROR", zeroPage, false}, {"RRA", zeroPage, true}, {"PLA", implied, false}, {"ADC", immediate, false}, {"ROR", accumulator, false}, {"ARR", immediate, true}, {"JMP", indirect, false}, {"ADC", absolute, false}, {"ROR", absolute, false}, {"RRA", absolute, true},
+	{"BVS", relative, false}, {"ADC", indirectIndex, false}, {"KIL", implied, true}, {"RRA", indirectIndex, true}, {"NOP", zeroPageX, true}, {"ADC", zeroPageX, false}, {"ROR", zeroPageX, false}, {"RRA", zeroPageX, true}, {"SEI", implied, false}, {"ADC", absoluteY, false}, {"NOP", implied, true}, {"RRA", absoluteY, true}, {"NOP", absoluteX, true}, {"ADC", absoluteX, false}, {"ROR", absoluteX, false}, {"RRA", absoluteX, true},
+	{"NOP", immediate, true}, {"STA", indexIndirect, false}, {"NOP", immediate, true}, {"SAX", indexIndirect, true}, {"STY", zeroPage, false}, {"STA", zeroPage, false}, {"STX", zeroPage, false}, {"SAX", zeroPage, true}, {"DEY", implied, false}, {"NOP", immediate, true}, {"TXA", implied, false}, {"XAA", immediate, true}, {"STY", absolute, false}, {"STA", absolute, false}, {"STX", absolute, false}, {"SAX", absolute, true},
+	{"BCC", relative, false}, {"STA", indirectIndex, false}, {"KIL", implied, true}, {"SHA", indirectIndex, true}, {"STY", zeroPageX, false}, {"STA", zeroPageX, false}, {"STX", zeroPageY, false}, {"SAX", zeroPageY, true}, {"TYA", implied, false}, {"STA", absoluteY, false}, {"TXS", implied, false}, {"TAS", absoluteY, true}, {"SHY", absoluteX, true}, {"STA", absoluteX, false}, {"SHX", absoluteY, true}, {"SHA", absoluteY, true},
+	{"LDY", immediate, false}, {"LDA", indexIndirect, false}, {"LDX", immediate, false}, {"LAX", indexIndirect, true}, {"LDY", zeroPage, false}, {"LDA", zeroPage, false}, {"LDX", zeroPage, false}, {"LAX", zeroPage, true}, {"TAY", implied, false}, {"LDA", immediate, false}, {"TAX", implied, false}, {"LXA", immediate, true}, {"LDY", absolute, false}, {"LDA", absolute, false}, {"LDX", absolute, false}, {"LAX", absolute, true},
+	{"BCS", relative, false}, {"LDA", indirectIndex, false}, {"KIL", implied, true}, {"LAX", indirectIndex, true}, {"LDY", zeroPageX, false}, {"LDA", zeroPageX, false}, {"LDX", zeroPageY, false}, {"LAX", zeroPageY, true}, {"CLV", implied, false}, {"LDA", absoluteY, false}, {"TSX", implied, false}, {"LAS", absoluteY, true}, {"LDY", absoluteX, false}, {"LDA", absoluteX, false}, {"LDX", absoluteY, false}, {"LAX", absoluteY, true},
+	{"CPY", immediate, false}, {"CMP", indexIndirect, false}, {"NOP", immediate, true}, {"DCP", indexIndirect, true}, {"CPY", zeroPage, false}, {"CMP", zeroPage, false}, {"DEC", zeroPage, false}, {"DCP", zeroPage, true}, {"INY", implied, false}, {"CMP", immediate, false}, {"DEX", implied, false}, {"AXS", immediate, true}, {"CPY", absolute, false}, {"CMP", absolute, false}, {"DEC", absolute, false}, {"DCP", absolute, true},
+	{"BNE", relative, false}, {"CMP", indirectIndex, false}, {"KIL", implied, true}, {"DCP", indirectIndex, true}, {"NOP", zeroPageX, true}, {"CMP", zeroPageX, false}, {"DEC", zeroPageX, false}, {"DCP", zeroPageX, true}, {"CLD", implied, false}, {"CMP", absoluteY, false}, {"NOP", implied, true}, {"DCP", absoluteY, true}, {"NOP", absoluteX, true}, {"CMP", absoluteX, false}, {"DEC", absoluteX, false}, {"DCP", absoluteX, true},
+	{"CPX", immediate, false}, {"SBC", indexIndirect, false}, {"NOP", immediate, true}, {"ISC", indexIndirect, true}, {"CPX", zeroPage, false}, {"SBC", zeroPage, false}, {"INC", zeroPage, false}, {"ISC", zeroPage, true}, {"INX", implied, false}, {"SBC", immediate, false}, {"NOP", implied, false}, {"SBC", immediate, true}, {"CPX", absolute, false}, {"SBC", absolute, false}, {"INC", absolute, false}, {"ISC", absolute, true},
+	{"BEQ", relative, false}, {"SBC", indirectIndex, false}, {"KIL", implied, true}, {"ISC", indirectIndex, true}, {"NOP", zeroPageX, true}, {"SBC", zeroPageX, false}, {"INC", zeroPageX, false}, {"ISC", zeroPageX, true}, {"SED", implied, false}, {"SBC", absoluteY, false}, {"NOP", implied, true}, {"ISC", absoluteY, true}, {"NOP", absoluteX, true}, {"SBC", absoluteX, false}, {"INC", absoluteX, false}, {"ISC", absoluteX, true},
+}
+
+// cmosOpcodeNameTable is the 65C02's instruction set, the NMOS table with the 65C02's changes
+var cmosOpcodeNameTable = createCMOSNameTable()
+
+func createCMOSNameTable() [256]opCodeAndAddrMode {
+	table := opcodeNameTable
+	//unused opcodes are NOPs
+	for high := 0; high < 0x100; high += 0x10 {
+		table[high|0x03] = opCodeAndAddrMode{"NOP", implied, true}
+		table[high|0x0B] = opCodeAndAddrMode{"NOP", implied, true}
+	}
+	for _, opcode := range []uint8{0x02, 0x22, 0x42, 0x62, 0x82, 0xC2, 0xE2} {
+		table[opcode] = opCodeAndAddrMode{"NOP", immediate, true}
+	}
+	for bit := 0; bit < 8; bit++ {
+		table[bit<<4|0x07] = opCodeAndAddrMode{fmt.Sprintf("RMB%d", bit), zeroPage, false}
+		table[bit<<4|0x87] = opCodeAndAddrMode{fmt.Sprintf("SMB%d", bit), zeroPage, false}
+		table[bit<<4|0x0F] = opCodeAndAddrMode{fmt.Sprintf("BBR%d", bit), zeroPageRelative, false}
+		table[bit<<4|0x8F] = opCodeAndAddrMode{fmt.Sprintf("BBS%d", bit), zeroPageRelative, false}
+	}
+	cmos := map[uint8]opCodeAndAddrMode{
+		0x04: {"TSB", zeroPage, false}, 0x0C: {"TSB", absolute, false}, 0x12: {"ORA", zeroPageIndirect, false},
+		0x14: {"TRB", zeroPage, false}, 0x1A: {"INC", accumulator, false}, 0x1C: {"TRB", absolute, false},
+		0x32: {"AND", zeroPageIndirect, false}, 0x34: {"BIT", zeroPageX, false}, 0x3A: {"DEC", accumulator, false},
+		0x3C: {"BIT", absoluteX, false}, 0x44: {"NOP", zeroPage, true}, 0x52: {"EOR", zeroPageIndirect, false},
+		0x54: {"NOP", zeroPageX, true}, 0x5A: {"PHY", implied, false}, 0x5C: {"NOP", absolute, true},
+		0x64: {"STZ", zeroPage, false}, 0x72: {"ADC", zeroPageIndirect, false}, 0x74: {"STZ", zeroPageX, false},
+		0x7A: {"PLY", implied, false}, 0x7C: {"JMP", absoluteIndexedIndirect, false}, 0x80: {"BRA", relative, false},
+		0x89: {"BIT", immediate, false}, 0x92: {"STA", zeroPageIndirect, false}, 0x9C: {"STZ", absolute, false},
+		0x9E: {"STZ", absoluteX, false}, 0xB2: {"LDA", zeroPageIndirect, false}, 0xCB: {"WAI", implied, false},
+		0xD2: {"CMP", zeroPageIndirect, false}, 0xD4: {"NOP", zeroPageX, true}, 0xDA: {"PHX", implied, false},
+		0xDB: {"STP", implied, false}, 0xDC: {"NOP", absolute, true}, 0xF2: {"SBC", zeroPageIndirect, false},
+		0xF4: {"NOP", zeroPageX, true}, 0xFA: {"PLX", implied, false}, 0xFC: {"NOP", absolute, true},
+	}
+	for opcode, instr := range cmos {
+		table[opcode] = instr
+	}
+	return table
+}
+
+// DisassemblyStyle controls how undocumented opcodes are written
+type DisassemblyStyle uint8
+
+const (
+	StyleDefault DisassemblyStyle = iota //conventional mnemonics, EX: ISC $10
+	StyleNestest                         //nestest.log style, prefixed with * and nestest's names, EX: *ISB $10
+)
+
+// nestest.log uses different names for some undocumented opcodes
+var nestestNames = map[string]string{
+	"ISC": "ISB",
 }
 
 // DisassembleInstruction takes a BUS and address and returns
 // the string representation of the instruction and the size of that instruction
-func DiassembleInstruction(bus *NesSystem, addr uint16) (string, int) {
-	instr := opcodeNameTable[bus.GetCPUByte(addr)]
-	size, operand := instr.addrMode(addr+1, bus)
-	return fmt.Sprintf("%s %s", instr.name, operand), size
+func DiassembleInstruction(bus Bus, addr uint16) (string, int) {
+	return DisassembleInstructionStyle(bus, addr, StyleDefault)
+}
+
+// DisassembleInstructionStyle is DiassembleInstruction with control over how undocumented opcodes are written.
+// The instruction set follows the variant of the bus's cpu, memory is peeked so disassembling doesn't disturb the system
+func DisassembleInstructionStyle(bus Bus, addr uint16, style DisassemblyStyle) (string, int) {
+	table := nameTable(bus)
+	bus = peekBus{bus}
+	instr := table[bus.GetCPUByte(addr)]
+	size, operand := instr.addrMode.format(addr+1, bus)
+	return fmt.Sprintf("%s %s", instr.mnemonic(style), operand), size
 }
 
-// Address Mode functions return the operand and the addr of the next instruction in memory
-func implied(addr uint16, bus *NesSystem) (int, string) {
-	return 1, ""
+// nameTable returns the opcode table of the bus's cpu variant
+func nameTable(bus Bus) *[256]opCodeAndAddrMode {
+	switch bus := bus.(type) {
+	case *NesSystem:
+		return variantNameTable(bus.CPU.Variant)
+	case *FlatBus:
+		return variantNameTable(bus.CPU.Variant)
+	case *Console:
+		return variantNameTable(bus.System.CPU.Variant)
+	}
+	return &opcodeNameTable
+}
+
+// variantNameTable returns the opcode table of a cpu variant
+func variantNameTable(variant CPUVariant) *[256]opCodeAndAddrMode {
+	if variant == CMOS65C02 {
+		return &cmosOpcodeNameTable
+	}
+	return &opcodeNameTable
 }
-func indexIndirect(addr uint16, bus *NesSystem) (int, string) {
-	return 2, fmt.Sprintf("($%02X, X)", bus.GetCPUByte(addr))
+
+// mnemonic returns the opcode's name written in style
+func (instr opCodeAndAddrMode) mnemonic(style DisassemblyStyle) string {
+	if !instr.undocumented || style != StyleNestest {
+		return instr.name
+	}
+	if name, ok := nestestNames[instr.name]; ok {
+		return "*" + name
+	}
+	return "*" + instr.name
 }
-func zeroPage(addr uint16, bus *NesSystem) (int, string) {
-	return 2, fmt.Sprintf("$%02X", bus.GetCPUByte(addr))
+
+// IsUndocumented returns true if opcode isn't part of the official 6502 instruction set
+func IsUndocumented(opcode uint8) bool {
+	return opcodeNameTable[opcode].undocumented
 }
-func immediate(addr uint16, bus *NesSystem) (int, string) {
-	return 2, fmt.Sprintf("#$%02X", bus.GetCPUByte(addr))
+
+// addressMode is how an instruction's operand is written
+type addressMode uint8
+
+const (
+	implied addressMode = iota
+	accumulator
+	immediate
+	zeroPage
+	zeroPageX
+	zeroPageY
+	absolute
+	absoluteX
+	absoluteY
+	indirect
+	indexIndirect
+	indirectIndex
+	relative
+	//65C02 address modes
+	zeroPageIndirect
+	absoluteIndexedIndirect
+	zeroPageRelative
+)
+
+// format returns the size of the instruction and its operand, addr is the address after the opcode
+func (mode addressMode) format(addr uint16, bus Bus) (int, string) {
+	switch mode {
+	case indexIndirect:
+		return 2, fmt.Sprintf("($%02X, X)", bus.GetCPUByte(addr))
+	case zeroPage:
+		return 2, fmt.Sprintf("$%02X", bus.GetCPUByte(addr))
+	case immediate:
+		return 2, fmt.Sprintf("#$%02X", bus.GetCPUByte(addr))
+	case accumulator:
+		return 1, "A"
+	case absolute:
+		return 3, fmt.Sprintf("$%04X", readWord(bus, addr))
+	case relative:
+		//outputs absolute address instead of relative offset to match output of
+		// a disassembler I used as a reference for correct output
+		return 2, fmt.Sprintf("$%04X", branchTarget(bus, addr))
+	case indirectIndex:
+		return 2, fmt.Sprintf("($%02X), Y", bus.GetCPUByte(addr))
+	case zeroPageX:
+		return 2, fmt.Sprintf("$%02X, X", bus.GetCPUByte(addr))
+	case zeroPageY:
+		return 2, fmt.Sprintf("$%02X, Y", bus.GetCPUByte(addr))
+	case absoluteX:
+		return 3, fmt.Sprintf("$%04X, X", readWord(bus, addr))
+	case absoluteY:
+		return 3, fmt.Sprintf("$%04X, Y", readWord(bus, addr))
+	case indirect:
+		return 3, fmt.Sprintf("($%04X)", readWord(bus, addr))
+	case zeroPageIndirect:
+		return 2, fmt.Sprintf("($%02X)", bus.GetCPUByte(addr))
+	case absoluteIndexedIndirect:
+		return 3, fmt.Sprintf("($%04X, X)", readWord(bus, addr))
+	case zeroPageRelative:
+		return 3, fmt.Sprintf("$%02X, $%04X", bus.GetCPUByte(addr), branchTarget(bus, addr+1))
+	}
+	return 1, "" //implied
 }
-func accumulator(addr uint16, bus *NesSystem) (int, string) {
-	return 1, "A"
+
+// size returns the size of an instruction using the address mode, opcode included
+func (mode addressMode) size() int {
+	switch mode {
+	case implied, accumulator:
+		return 1
+	case absolute, absoluteX, absoluteY, indirect, absoluteIndexedIndirect, zeroPageRelative:
+		return 3
+	}
+	return 2
 }
-func absolute(addr uint16, bus *NesSystem) (int, string) {
-	return 3, fmt.Sprintf("$%02X%02X", bus.GetCPUByte(addr+1), bus.GetCPUByte(addr))
+
+// readWord reads a little endian address from the bus
+func readWord(bus Bus, addr uint16) uint16 {
+	return uint16(bus.GetCPUByte(addr+1))<<8 | uint16(bus.GetCPUByte(addr))
 }
-func relative(addr uint16, bus *NesSystem) (int, string) {
-	//outputs absolute address instead of relative offset to match output of
-	// a disassembler I used as a reference for correct output
+
+// branchTarget returns where a branch whose offset is at addr goes
+func branchTarget(bus Bus, addr uint16) uint16 {
 	offset := uint16(bus.GetCPUByte(addr))
 	if offset&0x80 > 0 {
 		offset |= 0xFF00
 	}
-	return 2, fmt.Sprintf("$%04X", (addr+1)+offset)
-}
-func indirectIndex(addr uint16, bus *NesSystem) (int, string) {
-	return 2, fmt.Sprintf("($%02X), Y", bus.GetCPUByte(addr))
-}
-func zeroPageX(addr uint16, bus *NesSystem) (int, string) {
-	return 2, fmt.Sprintf("$%02X, X", bus.GetCPUByte(addr))
-}
-func zeroPageY(addr uint16, bus *NesSystem) (int, string) {
-	return 2, fmt.Sprintf("$%02X, Y", bus.GetCPUByte(addr))
-}
-func absoluteX(addr uint16, bus *NesSystem) (int, string) {
-	return 3, fmt.Sprintf("$%02X%02X, X", bus.GetCPUByte(addr+1), bus.GetCPUByte(addr))
-}
-func absoluteY(addr uint16, bus *NesSystem) (int, string) {
-	return 3, fmt.Sprintf("$%02X%02X, Y", bus.GetCPUByte(addr+1), bus.GetCPUByte(addr))
-}
-func indirect(addr uint16, bus *NesSystem) (int, string) {
-	return 3, fmt.Sprintf("($%02X%02X)", bus.GetCPUByte(addr+1), bus.GetCPUByte(addr))
+	return (addr + 1) + offset
 }
@@ -0,0 +1,26 @@
+package nes
+
+import "testing"
+
+// readCountingBus is a flat bus that counts the reads that would have side effects on real hardware
+type readCountingBus struct {
+	*FlatBus
+	reads int
+}
+
+func (bus *readCountingBus) GetCPUByte(addr uint16) uint8 {
+	bus.reads++
+	return bus.FlatBus.GetCPUByte(addr)
+}
+
+func TestDisassemblePeeks(t *testing.T) {
+	bus := &readCountingBus{FlatBus: CreateFlatBus(NMOS6502)}
+	bus.Load([]byte{0xAD, 0x15, 0x40}, 0x0200) //LDA $4015
+	instr, size := DisassembleInstructionStyle(bus, 0x0200, StyleDefault)
+	if instr != "LDA $4015" || size != 3 {
+		t.Errorf("disassembled %q size %d", instr, size)
+	}
+	if bus.reads != 0 {
+		t.Errorf("disassembling read the bus %d times instead of peeking", bus.reads)
+	}
+}
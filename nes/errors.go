@@ -0,0 +1,23 @@
+package nes
+
+import "fmt"
+
+// InvalidOpcodeError is returned once the cpu runs an opcode that locks it up (KIL/JAM).
+// The cpu stays halted on the opcode until it is reset
+type InvalidOpcodeError struct {
+	PC     uint16 //address of the opcode
+	Opcode uint8
+}
+
+func (err *InvalidOpcodeError) Error() string {
+	return fmt.Sprintf("invalid opcode $%02X at $%04X, cpu halted", err.Opcode, err.PC)
+}
+
+// StoppedError is returned once a 65C02 runs STP, the clock stays stopped until the cpu is reset
+type StoppedError struct {
+	PC uint16 //address of the STP opcode
+}
+
+func (err *StoppedError) Error() string {
+	return fmt.Sprintf("STP at $%04X, cpu stopped", err.PC)
+}
@@ -0,0 +1,461 @@
+package nes
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	FDSSideSize  = 65500 // size of one disk side in a .fds image
+	FDSBIOSSize  = 8192  // size of the FDS BIOS (disksys.rom)
+	fdsRAMSize   = 32768 // RAM adapter PRG Ram ($6000-$DFFF)
+	fdsNoDisk    = -1
+	fdsLeadIn    = 28300 / 8 // gap before the first block, in bytes
+	fdsBlockGap  = 976 / 8   // gap between blocks, in bytes
+	fdsByteDelay = 149       // cpu cycles it takes the drive to transfer one byte (96.4khz bit rate)
+	fdsSpinUp    = 50000     // cpu cycles between the head returning to the start and data being read
+	fdsMixLevel  = 0.6       // FDS sound relative to the APU's full scale output
+)
+
+var (
+	fdsMagic     = []byte("FDS\x1A")            // fwNES header magic
+	fdsDiskMagic = []byte("\x01*NINTENDO-HVC*") // first block of every disk side
+)
+
+// isFDSImage returns true if romBuffer is a .fds disk image, with or without the fwNES header
+func isFDSImage(romBuffer []byte) bool {
+	return bytes.HasPrefix(romBuffer, fdsMagic) || bytes.HasPrefix(romBuffer, fdsDiskMagic)
+}
+
+// parseFDS splits a .fds image into its disk sides
+// the 16 byte fwNES header is optional
+func (cart *Cartridge) parseFDS(romBuffer []byte) error {
+	if bytes.HasPrefix(romBuffer, fdsMagic) {
+		if len(romBuffer) < 16 {
+			return fmt.Errorf("FDS image is smaller than its 16 byte header")
+		}
+		romBuffer = romBuffer[16:]
+	}
+	if len(romBuffer) < FDSSideSize {
+		return fmt.Errorf("FDS image is smaller than one disk side")
+	}
+	for offset := 0; offset+FDSSideSize <= len(romBuffer); offset += FDSSideSize {
+		side := romBuffer[offset : offset+FDSSideSize]
+		if !bytes.HasPrefix(side, fdsDiskMagic) {
+			return fmt.Errorf("FDS disk side %d has no disk info block", offset/FDSSideSize)
+		}
+		cart.DiskSides = append(cart.DiskSides, side)
+	}
+	cart.Format = FormatFDS
+	cart.MapperNumber = 20 //mapper number reserved for the FDS
+	cart.PRGRamSize = fdsRAMSize
+	cart.CHRRamSize = 8192
+	cart.MirrorVertically = true
+	for _, side := range cart.DiskSides {
+		cart.PRGRom = append(cart.PRGRom, side...) //so the disk is hashed like any other rom
+	}
+	return nil
+}
+
+// CreateFDSCart loads a .fds disk image and attaches an FDS RAM adapter
+// running the provided BIOS (disksys.rom). The first disk side is inserted
+func CreateFDSCart(image []byte, bios []byte) (*Cartridge, error) {
+	if len(bios) != FDSBIOSSize {
+		return nil, fmt.Errorf("couldn't create cartridge, FDS BIOS must be %d bytes, got %d", FDSBIOSSize, len(bios))
+	}
+	if !isFDSImage(image) {
+		return nil, fmt.Errorf("couldn't create cartridge, not an FDS disk image")
+	}
+	cart, err := parseRom(image)
+	if err != nil {
+		return nil, err
+	}
+	cart.PRGRom = make([]byte, FDSBIOSSize)
+	copy(cart.PRGRom, bios)
+	cart.PRGRomSize = FDSBIOSSize
+	cart.mapper = createFDSAdapter(cart)
+	return cart, nil
+}
+
+// FDS returns the cartridge's FDS RAM adapter or nil if the cartridge isn't an FDS disk
+func (cart *Cartridge) FDS() *FDSAdapter {
+	fds, _ := cart.mapper.(*FDSAdapter)
+	return fds
+}
+
+// addGaps converts a .fds side into what the drive head actually sees:
+// a lead in gap, then each block preceded by a start mark (0x80) and followed by
+// its CRC and the gap to the next block
+func addGaps(side []byte) []byte {
+	out := make([]byte, 0, FDSSideSize+4096)
+	out = append(out, make([]byte, fdsLeadIn)...)
+	fileSize := 0
+	for pos := 0; pos < len(side); {
+		var blockSize int
+		switch side[pos] {
+		case 1: //disk info
+			blockSize = 56
+		case 2: //file amount
+			blockSize = 2
+		case 3: //file header, size of the following file block is stored in bytes 13-14
+			blockSize = 16
+			if pos+15 <= len(side) {
+				fileSize = int(side[pos+13]) | int(side[pos+14])<<8
+			}
+		case 4: //file data
+			blockSize = 1 + fileSize
+		default: //unused space at the end of the side
+			blockSize = 0
+		}
+		if blockSize == 0 || pos+blockSize > len(side) {
+			break
+		}
+		out = append(out, 0x80)
+		out = append(out, side[pos:pos+blockSize]...)
+		out = append(out, fdsCRC(side[pos:pos+blockSize])...)
+		out = append(out, make([]byte, fdsBlockGap)...)
+		pos += blockSize
+	}
+	//pad the rest of the side with gap so the head takes the same time to reach the end
+	if len(out) < FDSSideSize+fdsLeadIn {
+		out = append(out, make([]byte, FDSSideSize+fdsLeadIn-len(out))...)
+	}
+	return out
+}
+
+// fdsCRC computes the CRC-16 stored after each block on disk
+// (polynomial 0x8408, the 0x8000 initial value accounts for the 0x80 start mark)
+func fdsCRC(block []byte) []byte {
+	crc := uint16(0x8000)
+	update := func(value uint8) {
+		for bit := 0; bit < 8; bit++ {
+			carry := crc&1 > 0
+			crc = crc>>1 | uint16(value>>bit&1)<<15
+			if carry {
+				crc ^= 0x8408
+			}
+		}
+	}
+	for _, value := range block {
+		update(value)
+	}
+	update(0)
+	update(0)
+	return []byte{uint8(crc), uint8(crc >> 8)}
+}
+
+// FDSAdapter is the Famicom Disk System RAM adapter
+// $4020-$4026 (write) and $4030-$4033 (read) control the disk drive and IRQ timer,
+// $4040-$4092 are the wavetable sound channel,
+// $6000-$DFFF is 32kb of PRG Ram and $E000-$FFFF is the BIOS
+type FDSAdapter struct {
+	cart  *Cartridge
+	sides [][]byte // each disk side with gaps and CRCs added
+	side  int      // inserted side, fdsNoDisk if ejected
+	Audio *FDSAudio
+
+	//IRQ timer
+	irqReload    uint16
+	irqCounter   uint16
+	irqRepeat    bool
+	irqEnabled   bool
+	timerIRQ     bool
+	diskRegsOn   bool // $4023 bit 0
+	soundRegsOn  bool // $4023 bit 1
+	transferIRQ  bool // $4025 bit 7
+	diskIRQ      bool
+	writeData    uint8
+	readData     uint8
+	motorOn      bool
+	resetXfer    bool
+	readMode     bool
+	crcControl   bool
+	diskReady    bool // $4025 bit 6, set by the BIOS once it is waiting for a block
+	xferComplete bool
+	gapEnded     bool
+	endOfHead    bool
+	scanning     bool
+	position     int
+	delay        int
+}
+
+// createFDSAdapter attaches a RAM adapter to a cartridge loaded from a .fds image
+func createFDSAdapter(cart *Cartridge) *FDSAdapter {
+	fds := new(FDSAdapter)
+	fds.cart = cart
+	for _, side := range cart.DiskSides {
+		fds.sides = append(fds.sides, addGaps(side))
+	}
+	fds.Audio = createFDSAudio()
+	fds.side = 0
+	fds.endOfHead = true
+	return fds
+}
+
+// PowerOn clears the adapter's registers and stops the drive, the inserted disk stays in
+func (fds *FDSAdapter) PowerOn() {
+	*fds = FDSAdapter{cart: fds.cart, sides: fds.sides, side: fds.side, Audio: createFDSAudio(), endOfHead: true}
+}
+
+// DiskSides returns the number of disk sides in the image
+func (fds *FDSAdapter) DiskSides() int {
+	return len(fds.sides)
+}
+
+// InsertedSide returns the inserted disk side or -1 if no disk is inserted
+func (fds *FDSAdapter) InsertedSide() int {
+	return fds.side
+}
+
+// InsertDisk inserts side (0 = disk 1 side A, 1 = disk 1 side B, ...)
+// games expect the disk to be ejected for a while before a new side is inserted
+func (fds *FDSAdapter) InsertDisk(side int) error {
+	if side < 0 || side >= len(fds.sides) {
+		return fmt.Errorf("disk side %d doesn't exist, image has %d sides", side, len(fds.sides))
+	}
+	fds.side = side
+	fds.endOfHead = true
+	return nil
+}
+
+// EjectDisk removes the inserted disk
+func (fds *FDSAdapter) EjectDisk() {
+	fds.side = fdsNoDisk
+	fds.scanning = false
+	fds.endOfHead = true
+}
+
+// CPUGetMapAddr maps the BIOS, every other address is handled by CPURead and CPUWrite
+func (fds *FDSAdapter) CPUGetMapAddr(addr uint16) uint32 {
+	return uint32(addr-0xE000) & (FDSBIOSSize - 1)
+}
+
+// PPUGetMapAddr maps the 8kb of CHR Ram
+func (fds *FDSAdapter) PPUGetMapAddr(addr uint16) uint32 {
+	return uint32(addr) & 0x1FFF
+}
+
+// CPURead handles reads from the adapter's registers and RAM
+func (fds *FDSAdapter) CPURead(addr uint16) (uint8, bool) {
+	switch {
+	case addr >= 0x6000 && addr <= 0xDFFF:
+		return fds.cart.PRGRam[addr-0x6000], true
+	case addr == 0x4030 && fds.diskRegsOn:
+		var value uint8
+		if fds.timerIRQ {
+			value |= 0x01
+		}
+		if fds.xferComplete {
+			value |= 0x02
+		}
+		if fds.endOfHead {
+			value |= 0x40
+		}
+		value |= 0x80 //disk data read/write enable
+		//reading acknowledges both IRQs
+		fds.xferComplete = false
+		fds.timerIRQ = false
+		fds.diskIRQ = false
+		return value, true
+	case addr == 0x4031 && fds.diskRegsOn:
+		fds.xferComplete = false
+		fds.diskIRQ = false
+		return fds.readData, true
+	case addr == 0x4032 && fds.diskRegsOn:
+		var value uint8
+		if fds.side == fdsNoDisk {
+			value |= 0x07 //no disk, not ready, write protected
+		} else if !fds.scanning {
+			value |= 0x02 //not ready
+		}
+		return value, true
+	case addr == 0x4033 && fds.diskRegsOn:
+		return 0x80, true //battery is good
+	case addr >= 0x4040 && addr <= 0x4092 && fds.soundRegsOn:
+		return fds.Audio.readRegister(addr), true
+	}
+	return 0, false //nothing else on the adapter drives the bus, the cpu reads open bus
+}
+
+// CPUWrite handles writes to the adapter's registers and RAM
+func (fds *FDSAdapter) CPUWrite(addr uint16, value uint8) bool {
+	switch {
+	case addr >= 0x6000 && addr <= 0xDFFF:
+		fds.cart.PRGRam[addr-0x6000] = value
+	case addr >= 0xE000:
+		//the BIOS is rom
+	case addr == 0x4020 && fds.diskRegsOn:
+		fds.irqReload = fds.irqReload&0xFF00 | uint16(value)
+	case addr == 0x4021 && fds.diskRegsOn:
+		fds.irqReload = fds.irqReload&0x00FF | uint16(value)<<8
+	case addr == 0x4022 && fds.diskRegsOn:
+		fds.irqRepeat = getBit(0, value)
+		fds.irqEnabled = getBit(1, value)
+		if fds.irqEnabled {
+			fds.irqCounter = fds.irqReload
+		} else {
+			fds.timerIRQ = false
+		}
+	case addr == 0x4023:
+		fds.diskRegsOn = getBit(0, value)
+		fds.soundRegsOn = getBit(1, value)
+		if !fds.diskRegsOn {
+			fds.irqEnabled = false
+			fds.timerIRQ = false
+			fds.diskIRQ = false
+		}
+	case addr == 0x4024 && fds.diskRegsOn:
+		fds.writeData = value
+		fds.xferComplete = false
+		fds.diskIRQ = false
+	case addr == 0x4025 && fds.diskRegsOn:
+		fds.motorOn = getBit(0, value)
+		fds.resetXfer = getBit(1, value)
+		fds.readMode = getBit(2, value)
+		fds.cart.MirrorVertically = !getBit(3, value)
+		fds.crcControl = getBit(4, value)
+		fds.diskReady = getBit(6, value)
+		fds.transferIRQ = getBit(7, value)
+		fds.diskIRQ = false
+	case addr >= 0x4040 && addr <= 0x408A && fds.soundRegsOn:
+		fds.Audio.writeRegister(addr, value)
+	}
+	return addr >= 0x4020
+}
+
+// Clock advances the IRQ timer, the disk drive and the sound channel by one cpu cycle
+func (fds *FDSAdapter) Clock() {
+	fds.clockIRQ()
+	fds.clockDrive()
+	fds.Audio.clock()
+}
+
+// AudioOutput returns the sound channel's level, scaled to roughly match the APU
+func (fds *FDSAdapter) AudioOutput() float32 {
+	return fds.Audio.Output() * fdsMixLevel
+}
+
+// IRQ returns true while the IRQ timer or a byte transfer is requesting an interrupt
+func (fds *FDSAdapter) IRQ() bool {
+	return fds.timerIRQ || fds.diskIRQ
+}
+
+// clockIRQ counts the IRQ timer down, firing and reloading at 0
+func (fds *FDSAdapter) clockIRQ() {
+	if !fds.irqEnabled {
+		return
+	}
+	if fds.irqCounter > 0 {
+		fds.irqCounter--
+		return
+	}
+	fds.timerIRQ = true
+	fds.irqCounter = fds.irqReload
+	if !fds.irqRepeat {
+		fds.irqEnabled = false
+	}
+}
+
+// clockDrive moves the disk under the head, transferring one byte every fdsByteDelay cycles.
+// when the head reaches the end of the side it returns to the start, which takes fdsSpinUp cycles
+func (fds *FDSAdapter) clockDrive() {
+	if fds.side == fdsNoDisk || !fds.motorOn {
+		fds.endOfHead = true
+		fds.scanning = false
+		return
+	}
+	if fds.resetXfer && !fds.scanning {
+		return
+	}
+	if fds.endOfHead {
+		fds.delay = fdsSpinUp
+		fds.endOfHead = false
+		fds.position = 0
+		fds.gapEnded = false
+		return
+	}
+	if fds.delay > 0 {
+		fds.delay--
+		return
+	}
+	fds.scanning = true
+	disk := fds.sides[fds.side]
+	needIRQ := fds.transferIRQ
+	if fds.readMode {
+		value := disk[fds.position]
+		if !fds.diskReady {
+			fds.gapEnded = false
+		} else if value != 0 && !fds.gapEnded {
+			//the start mark ends the gap, it doesn't raise an IRQ
+			fds.gapEnded = true
+			needIRQ = false
+		}
+		if fds.gapEnded {
+			fds.xferComplete = true
+			fds.readData = value
+			if needIRQ {
+				fds.diskIRQ = true
+			}
+		}
+	} else {
+		value := uint8(0)
+		if !fds.crcControl {
+			fds.xferComplete = true
+			value = fds.writeData
+			if needIRQ {
+				fds.diskIRQ = true
+			}
+		} else {
+			//the adapter writes the CRC itself, the placeholder keeps the gapped layout intact
+			value = disk[fds.position]
+		}
+		if fds.diskReady {
+			disk[fds.position] = value
+		}
+		fds.gapEnded = false
+	}
+	fds.position++
+	if fds.position >= len(disk) {
+		fds.motorOn = false
+		fds.endOfHead = true
+	} else {
+		fds.delay = fdsByteDelay
+	}
+}
+
+// saveState writes the adapter's registers, the disk sides (the BIOS can write to them) and the sound channel
+func (fds *FDSAdapter) saveState(w *stateWriter) {
+	w.write(fds.stateFields()...)
+	for _, side := range fds.sides {
+		w.write(side)
+	}
+	w.write(fds.Audio.stateFields()...)
+}
+
+func (fds *FDSAdapter) loadState(r *stateReader) {
+	r.read(fds.stateFields()...)
+	for _, side := range fds.sides {
+		r.read(side)
+	}
+	r.read(fds.Audio.stateFields()...)
+}
+
+func (fds *FDSAdapter) stateFields() []interface{} {
+	return []interface{}{
+		&fds.side, &fds.irqReload, &fds.irqCounter, &fds.irqRepeat, &fds.irqEnabled, &fds.timerIRQ,
+		&fds.diskRegsOn, &fds.soundRegsOn, &fds.transferIRQ, &fds.diskIRQ, &fds.writeData, &fds.readData,
+		&fds.motorOn, &fds.resetXfer, &fds.readMode, &fds.crcControl, &fds.diskReady, &fds.xferComplete,
+		&fds.gapEnded, &fds.endOfHead, &fds.scanning, &fds.position, &fds.delay,
+	}
+}
+
+func (audio *FDSAudio) stateFields() []interface{} {
+	return []interface{}{
+		&audio.wave, &audio.waveWrite, &audio.masterVolume,
+		&audio.volume.disabled, &audio.volume.increase, &audio.volume.speed, &audio.volume.gain, &audio.volume.counter,
+		&audio.mod.disabled, &audio.mod.increase, &audio.mod.speed, &audio.mod.gain, &audio.mod.counter,
+		&audio.envHalt, &audio.waveHalt, &audio.frequency, &audio.waveAcc, &audio.modTable, &audio.modPos,
+		&audio.modHalt, &audio.modFrequency, &audio.modAcc, &audio.modCounter, &audio.masterEnv,
+		&audio.output, &audio.outputVolume, &audio.lastWavePos,
+	}
+}
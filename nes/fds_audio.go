@@ -0,0 +1,220 @@
+package nes
+
+// modulation table values, how far each entry moves the modulation counter
+// 4 (-128) resets the counter to 0
+var fdsModAdjust = [8]int{0, 1, 2, 4, -128, -4, -2, -1}
+
+// master volume multipliers set by $4089, 2/2, 2/3, 2/4 and 2/5
+var fdsMasterVolume = [4]float32{2.0 / 2, 2.0 / 3, 2.0 / 4, 2.0 / 5}
+
+// fdsEnvelope is the volume or modulation envelope
+type fdsEnvelope struct {
+	disabled bool  // gain is set directly from speed
+	increase bool  // direction the gain moves
+	speed    uint8 // 6 bits
+	gain     uint8 // 0-32 (can be set higher directly, but is clamped when output)
+	counter  int
+}
+
+// write sets the envelope from $4080 or $4084
+func (env *fdsEnvelope) write(value uint8) {
+	env.disabled = getBit(7, value)
+	env.increase = getBit(6, value)
+	env.speed = value & 0x3F
+	if env.disabled {
+		env.gain = env.speed
+	}
+	env.counter = 0
+}
+
+// clock moves the gain one step every 8 * (speed + 1) * master speed cpu cycles
+func (env *fdsEnvelope) clock(masterSpeed uint8) {
+	if env.disabled {
+		return
+	}
+	env.counter++
+	if env.counter < 8*(int(env.speed)+1)*int(masterSpeed) {
+		return
+	}
+	env.counter = 0
+	if env.increase && env.gain < 32 {
+		env.gain++
+	} else if !env.increase && env.gain > 0 {
+		env.gain--
+	}
+}
+
+// FDSAudio is the RAM adapter's wavetable sound channel
+// a 64 step, 6 bit wavetable played back at a frequency that can be
+// bent by a 64 step modulation table
+type FDSAudio struct {
+	wave         [64]uint8 // $4040-$407F
+	waveWrite    bool      // $4089 bit 7, wavetable can be written and output holds
+	masterVolume uint8     // $4089 bits 0-1
+	volume       fdsEnvelope
+	mod          fdsEnvelope
+	envHalt      bool   // $4083 bit 6
+	waveHalt     bool   // $4083 bit 7
+	frequency    uint16 // 12 bits
+	waveAcc      uint32 // position in the wavetable, 6 bits of position above 16 fraction bits
+	modTable     [64]uint8
+	modPos       uint8
+	modHalt      bool   // $4087 bit 7
+	modFrequency uint16 // 12 bits
+	modAcc       uint16
+	modCounter   int8  // 7 bit signed
+	masterEnv    uint8 // $408A envelope speed multiplier
+	output       uint8 // last wavetable sample, held while the wavetable is writable
+	outputVolume uint8 // volume gain latched at the start of each wave cycle
+	lastWavePos  uint8
+}
+
+func createFDSAudio() *FDSAudio {
+	audio := new(FDSAudio)
+	audio.masterEnv = 0xE8
+	audio.waveHalt = true
+	audio.modHalt = true
+	return audio
+}
+
+// readRegister handles reads of $4040-$4092
+// only the wavetable and the two envelope gains are readable,
+// the upper 2 bits are open bus (approximated by $40, the high byte of the address)
+func (audio *FDSAudio) readRegister(addr uint16) uint8 {
+	switch {
+	case addr <= 0x407F:
+		return audio.wave[addr-0x4040] | 0x40
+	case addr == 0x4090:
+		return audio.volume.gain | 0x40
+	case addr == 0x4092:
+		return audio.mod.gain | 0x40
+	}
+	return 0x40
+}
+
+// writeRegister handles writes to $4040-$408A
+func (audio *FDSAudio) writeRegister(addr uint16, value uint8) {
+	switch {
+	case addr <= 0x407F:
+		if audio.waveWrite {
+			audio.wave[addr-0x4040] = value & 0x3F
+		}
+	case addr == 0x4080:
+		audio.volume.write(value)
+	case addr == 0x4082:
+		audio.frequency = audio.frequency&0x0F00 | uint16(value)
+	case addr == 0x4083:
+		audio.frequency = audio.frequency&0x00FF | uint16(value&0x0F)<<8
+		audio.envHalt = getBit(6, value)
+		audio.waveHalt = getBit(7, value)
+		if audio.waveHalt {
+			audio.waveAcc = 0
+		}
+		if audio.envHalt {
+			audio.volume.counter = 0
+			audio.mod.counter = 0
+		}
+	case addr == 0x4084:
+		audio.mod.write(value)
+	case addr == 0x4085:
+		audio.modCounter = int8(value<<1) >> 1 //sign extend the 7 bit value
+	case addr == 0x4086:
+		audio.modFrequency = audio.modFrequency&0x0F00 | uint16(value)
+	case addr == 0x4087:
+		audio.modFrequency = audio.modFrequency&0x00FF | uint16(value&0x0F)<<8
+		audio.modHalt = getBit(7, value)
+		if audio.modHalt {
+			audio.modAcc = 0
+		}
+	case addr == 0x4088:
+		//the table can only be written while modulation is halted,
+		//each write fills two entries and advances the position
+		if audio.modHalt {
+			audio.modTable[audio.modPos&0x3F] = value & 0x7
+			audio.modTable[(audio.modPos+1)&0x3F] = value & 0x7
+			audio.modPos = (audio.modPos + 2) & 0x3F
+		}
+	case addr == 0x4089:
+		audio.waveWrite = getBit(7, value)
+		audio.masterVolume = value & 0x3
+	case addr == 0x408A:
+		audio.masterEnv = value
+	}
+}
+
+// clock advances the envelopes, modulator and wavetable by one cpu cycle
+func (audio *FDSAudio) clock() {
+	if !audio.envHalt && !audio.waveHalt && audio.masterEnv != 0 {
+		audio.volume.clock(audio.masterEnv)
+		audio.mod.clock(audio.masterEnv)
+	}
+	if !audio.modHalt && audio.modFrequency != 0 {
+		previous := audio.modAcc
+		audio.modAcc += audio.modFrequency
+		if audio.modAcc < previous { //the accumulator overflowed, step the modulation table
+			adjust := fdsModAdjust[audio.modTable[audio.modPos&0x3F]]
+			if adjust == -128 {
+				audio.modCounter = 0
+			} else {
+				audio.modCounter = int8(int(audio.modCounter)+adjust) << 1 >> 1 //wrap to 7 bits
+			}
+			audio.modPos = (audio.modPos + 1) & 0x3F
+		}
+	}
+	if audio.waveHalt {
+		return
+	}
+	pitch := audio.modulatedPitch()
+	if pitch > 0 {
+		audio.waveAcc = (audio.waveAcc + uint32(pitch)) & 0x3FFFFF
+	}
+	pos := uint8(audio.waveAcc >> 16)
+	if pos < audio.lastWavePos {
+		audio.outputVolume = audio.volume.gain //volume only changes at the start of the wave
+	}
+	audio.lastWavePos = pos
+	if !audio.waveWrite {
+		audio.output = audio.wave[pos]
+	}
+}
+
+// modulatedPitch returns the wave frequency after applying the modulator
+// (the calculation the hardware does, from the nesdev wiki)
+func (audio *FDSAudio) modulatedPitch() int {
+	pitch := int(audio.frequency)
+	temp := int(audio.modCounter) * int(audio.mod.gain)
+	remainder := temp & 0xF
+	temp >>= 4
+	if remainder > 0 && temp&0x80 == 0 {
+		if audio.modCounter < 0 {
+			temp--
+		} else {
+			temp += 2
+		}
+	}
+	if temp >= 192 {
+		temp -= 256
+	} else if temp < -64 {
+		temp += 256
+	}
+	temp = pitch * temp
+	remainder = temp & 0x3F
+	temp >>= 6
+	if remainder >= 32 {
+		temp++
+	}
+	pitch += temp
+	if pitch < 0 {
+		return 0
+	}
+	return pitch
+}
+
+// Output returns the channel's current level from 0 to 1
+func (audio *FDSAudio) Output() float32 {
+	gain := audio.outputVolume
+	if gain > 32 {
+		gain = 32
+	}
+	return float32(audio.output) * float32(gain) / (63 * 32) * fdsMasterVolume[audio.masterVolume]
+}
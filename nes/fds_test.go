@@ -0,0 +1,313 @@
+package nes
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCreateFDSCartTruncated(t *testing.T) {
+	bios := make([]byte, FDSBIOSSize)
+	images := map[string][]byte{
+		"header":    []byte("FDS\x1a\x01"),
+		"disk side": append([]byte("FDS\x1a\x01"+strings.Repeat("\x00", 11)), fdsDiskMagic...),
+	}
+	for name, image := range images {
+		if _, err := CreateFDSCart(image, bios); err == nil {
+			t.Errorf("truncated %s loaded without an error", name)
+		}
+	}
+}
+
+// fdsTestFile is the data of the only file on the test disk
+var fdsTestFile = []byte{0xDE, 0xAD, 0xBE, 0xEF}
+
+// createTestFDSSide builds a disk side with a disk info block and one 4 byte file
+func createTestFDSSide() []byte {
+	side := make([]byte, 0, FDSSideSize)
+	side = append(side, fdsDiskMagic...)
+	side = append(side, make([]byte, 56-len(fdsDiskMagic))...)
+	side = append(side, 2, 1) //one file
+	header := make([]byte, 16)
+	header[0] = 3
+	header[13] = uint8(len(fdsTestFile))
+	side = append(side, header...)
+	side = append(side, 4)
+	side = append(side, fdsTestFile...)
+	return append(side, make([]byte, FDSSideSize-len(side))...)
+}
+
+// createTestFDS loads a fwNES image with sides copies of the test side and enables the disk registers
+func createTestFDS(t *testing.T, sides int) *FDSAdapter {
+	image := append([]byte(nil), fdsMagic...)
+	image = append(image, uint8(sides))
+	image = append(image, make([]byte, 11)...)
+	for i := 0; i < sides; i++ {
+		image = append(image, createTestFDSSide()...)
+	}
+	cart, err := CreateFDSCart(image, make([]byte, FDSBIOSSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fds := cart.FDS()
+	fds.CPUWrite(0x4023, 0x01)
+	return fds
+}
+
+func readFDS(fds *FDSAdapter, addr uint16) uint8 {
+	value, _ := fds.CPURead(addr)
+	return value
+}
+
+func clockFDS(fds *FDSAdapter, cycles int) {
+	for i := 0; i < cycles; i++ {
+		fds.Clock()
+	}
+}
+
+func TestFDSCRC(t *testing.T) {
+	//CRC-16/KERMIT of the 0x80 start mark followed by the block
+	tests := []struct {
+		block []byte
+		crc   []byte
+	}{
+		{[]byte{2, 1}, []byte{0xD5, 0x2E}},
+		{fdsDiskMagic, []byte{0x1D, 0xE9}},
+	}
+	for _, test := range tests {
+		if crc := fdsCRC(test.block); !bytes.Equal(crc, test.crc) {
+			t.Errorf("CRC of % X is % X, expected % X", test.block, crc, test.crc)
+		}
+	}
+}
+
+func TestFDSAddGaps(t *testing.T) {
+	side := createTestFDSSide()
+	expected := make([]byte, fdsLeadIn)
+	for _, block := range [][]byte{side[:56], side[56:58], side[58:74], side[74:79]} {
+		expected = append(expected, 0x80)
+		expected = append(expected, block...)
+		expected = append(expected, fdsCRC(block)...)
+		expected = append(expected, make([]byte, fdsBlockGap)...)
+	}
+	gapped := addGaps(side)
+	if len(gapped) != FDSSideSize+fdsLeadIn {
+		t.Fatalf("gapped side is %d bytes, expected %d", len(gapped), FDSSideSize+fdsLeadIn)
+	}
+	if !bytes.Equal(gapped[:len(expected)], expected) {
+		t.Errorf("gapped side starts with % X\nexpected % X", gapped[fdsLeadIn:len(expected)], expected[fdsLeadIn:])
+	}
+	if end := bytes.IndexFunc(gapped[len(expected):], func(r rune) bool { return r != 0 }); end != -1 {
+		t.Errorf("gap after the last block has data at %d", len(expected)+end)
+	}
+}
+
+func TestFDSIRQTimer(t *testing.T) {
+	fds := createTestFDS(t, 1)
+	fds.CPUWrite(0x4020, 0x03)
+	fds.CPUWrite(0x4021, 0x00)
+	fds.CPUWrite(0x4022, 0x02) //enabled, no repeat
+	for cycle := 1; cycle <= 3; cycle++ {
+		fds.clockIRQ()
+		if fds.IRQ() {
+			t.Fatalf("IRQ fired after %d cycles, reload is 3", cycle)
+		}
+	}
+	fds.clockIRQ()
+	if !fds.IRQ() {
+		t.Fatal("IRQ didn't fire when the counter passed 0")
+	}
+	if status := readFDS(fds, 0x4030); status&0x01 == 0 {
+		t.Errorf("$4030 read %02X without the timer bit", status)
+	}
+	if fds.IRQ() || readFDS(fds, 0x4030)&0x01 != 0 {
+		t.Error("reading $4030 didn't acknowledge the IRQ")
+	}
+	for cycle := 0; cycle < 10; cycle++ {
+		fds.clockIRQ()
+	}
+	if fds.IRQ() {
+		t.Error("IRQ fired again without repeat")
+	}
+
+	fds.CPUWrite(0x4022, 0x03) //enabled, repeat
+	fires := 0
+	for cycle := 0; cycle < 12; cycle++ {
+		fds.clockIRQ()
+		if fds.IRQ() {
+			fires++
+			fds.CPURead(0x4030)
+		}
+	}
+	if fires != 3 {
+		t.Errorf("repeating timer fired %d times in 12 cycles, expected every 4", fires)
+	}
+
+	fds.clockIRQ()
+	fds.clockIRQ()
+	fds.clockIRQ()
+	fds.clockIRQ()
+	fds.CPUWrite(0x4022, 0x00)
+	if fds.IRQ() {
+		t.Error("disabling the timer didn't clear its IRQ")
+	}
+	fds.CPUWrite(0x4022, 0x03)
+	fds.CPUWrite(0x4023, 0x00)
+	clockFDS(fds, 10)
+	if fds.IRQ() {
+		t.Error("IRQ fired with the disk registers disabled")
+	}
+}
+
+func TestFDSDiskStatus(t *testing.T) {
+	fds := createTestFDS(t, 2)
+	if fds.DiskSides() != 2 || fds.InsertedSide() != 0 {
+		t.Fatalf("%d sides with side %d inserted", fds.DiskSides(), fds.InsertedSide())
+	}
+	if status := readFDS(fds, 0x4032); status != 0x02 {
+		t.Errorf("inserted disk with the motor off reads %02X, expected not ready", status)
+	}
+	fds.CPUWrite(0x4025, 0x05) //motor on, read
+	clockFDS(fds, fdsSpinUp+2)
+	if status := readFDS(fds, 0x4032); status != 0x00 {
+		t.Errorf("spinning disk reads %02X, expected ready", status)
+	}
+	fds.EjectDisk()
+	if status := readFDS(fds, 0x4032); status != 0x07 || fds.InsertedSide() != -1 {
+		t.Errorf("ejected disk reads %02X with side %d inserted", status, fds.InsertedSide())
+	}
+	if readFDS(fds, 0x4030)&0x40 == 0 {
+		t.Error("ejecting the disk didn't return the head to the start")
+	}
+	if err := fds.InsertDisk(2); err == nil {
+		t.Error("inserting side 2 of 2 didn't fail")
+	}
+	if err := fds.InsertDisk(1); err != nil {
+		t.Fatal(err)
+	}
+	if status := readFDS(fds, 0x4032); status != 0x02 || fds.InsertedSide() != 1 {
+		t.Errorf("inserted side %d reads %02X, expected not ready until the drive scans it", fds.InsertedSide(), status)
+	}
+
+	//with the disk registers off nothing answers and the cpu reads open bus
+	fds.CPUWrite(0x4023, 0x00)
+	for _, addr := range []uint16{0x4030, 0x4032, 0x4090, 0x4100, 0x5FFF} {
+		if _, ok := fds.CPURead(addr); ok {
+			t.Errorf("$%04X answered a read", addr)
+		}
+	}
+}
+
+func TestFDSDrive(t *testing.T) {
+	fds := createTestFDS(t, 1)
+	fds.CPUWrite(0x4025, 0x07) //motor on, read, transfer reset held
+	clockFDS(fds, fdsSpinUp+100)
+	if fds.scanning || !fds.endOfHead {
+		t.Fatal("drive moved while the transfer was reset")
+	}
+
+	fds.CPUWrite(0x4025, 0xC5) //motor on, read, waiting for a block, transfer IRQs
+	if !fds.cart.MirrorVertically {
+		t.Error("$4025 bit 3 clear didn't select vertical mirroring")
+	}
+	clockFDS(fds, fdsSpinUp+1)
+	if fds.scanning {
+		t.Fatal("drive read before spinning up")
+	}
+	//one byte every fdsByteDelay+1 cycles, the lead in gap doesn't transfer anything
+	clockFDS(fds, 1+(fdsLeadIn-1)*(fdsByteDelay+1))
+	if !fds.scanning || readFDS(fds, 0x4030)&0x02 != 0 {
+		t.Fatal("drive transferred a byte of the lead in gap")
+	}
+	clockFDS(fds, fdsByteDelay+1)
+	if fds.IRQ() {
+		t.Error("the start mark raised an IRQ")
+	}
+	if value := readFDS(fds, 0x4031); value != 0x80 {
+		t.Errorf("read %02X at the end of the gap, expected the start mark", value)
+	}
+	for i, expected := range fdsDiskMagic {
+		clockFDS(fds, fdsByteDelay+1)
+		if !fds.IRQ() {
+			t.Fatalf("byte %d didn't raise a transfer IRQ", i)
+		}
+		if status := readFDS(fds, 0x4030); status&0x42 != 0x02 {
+			t.Errorf("byte %d: $4030 read %02X, expected a completed transfer with the head moving", i, status)
+		}
+		if value := readFDS(fds, 0x4031); value != expected {
+			t.Errorf("byte %d read %02X, expected %02X", i, value, expected)
+		}
+		if fds.IRQ() {
+			t.Errorf("byte %d: reading didn't acknowledge the IRQ", i)
+		}
+	}
+
+	//writing replaces the byte under the head
+	position := fds.position
+	fds.CPUWrite(0x4025, 0x41) //motor on, write, waiting for a block
+	fds.CPUWrite(0x4024, 0x5A)
+	clockFDS(fds, fdsByteDelay+1)
+	if fds.sides[0][position] != 0x5A || readFDS(fds, 0x4030)&0x02 == 0 {
+		t.Errorf("wrote %02X at %d", fds.sides[0][position], position)
+	}
+
+	//reaching the end of the side stops the motor and returns the head
+	clockFDS(fds, (len(fds.sides[0])-position)*(fdsByteDelay+1))
+	if fds.motorOn || readFDS(fds, 0x4030)&0x40 == 0 {
+		t.Errorf("head at %d of %d, motor on %t", fds.position, len(fds.sides[0]), fds.motorOn)
+	}
+}
+
+func TestFDSAudioRegisters(t *testing.T) {
+	fds := createTestFDS(t, 1)
+	fds.CPUWrite(0x4040, 0x3F)
+	if _, ok := fds.CPURead(0x4040); ok || fds.Audio.wave[0] != 0 {
+		t.Fatal("sound registers answered before $4023 enabled them")
+	}
+	fds.CPUWrite(0x4023, 0x03)
+	fds.CPUWrite(0x4040, 0x3F)
+	if value := readFDS(fds, 0x4040); value != 0x40 {
+		t.Errorf("wavetable was written while $4089 protected it, read %02X", value)
+	}
+	fds.CPUWrite(0x4089, 0x80)
+	for addr := uint16(0x4040); addr <= 0x407F; addr++ {
+		fds.CPUWrite(addr, 0xFF)
+	}
+	if value := readFDS(fds, 0x407F); value != 0x7F {
+		t.Errorf("$407F read %02X, expected 6 bits of wave and open bus", value)
+	}
+
+	fds.CPUWrite(0x4080, 0xA0) //volume envelope off, gain 32
+	fds.CPUWrite(0x4084, 0x85) //modulation envelope off, gain 5
+	if volume, mod := readFDS(fds, 0x4090), readFDS(fds, 0x4092); volume != 0x60 || mod != 0x45 {
+		t.Errorf("gains read %02X and %02X, expected 60 and 45", volume, mod)
+	}
+	fds.CPUWrite(0x4085, 0x7F)
+	if fds.Audio.modCounter != -1 {
+		t.Errorf("$4085 = 7F set the modulation counter to %d, expected -1", fds.Audio.modCounter)
+	}
+	fds.CPUWrite(0x4085, 0x00)
+
+	fds.CPUWrite(0x4087, 0x80) //modulation halted, table writable
+	fds.CPUWrite(0x4088, 0x05)
+	fds.CPUWrite(0x4087, 0x00)
+	fds.CPUWrite(0x4088, 0x03)
+	if table := fds.Audio.modTable; table[0] != 5 || table[1] != 5 || table[2] != 0 || fds.Audio.modPos != 2 {
+		t.Errorf("modulation table starts % X at position %d", table[:4], fds.Audio.modPos)
+	}
+
+	fds.CPUWrite(0x4089, 0x00) //wavetable playing, full master volume
+	fds.CPUWrite(0x4082, 0xFF)
+	fds.CPUWrite(0x4083, 0x0F) //frequency $FFF, wave running
+	if fds.Audio.frequency != 0xFFF || fds.Audio.waveHalt {
+		t.Fatalf("frequency %03X, halted %t", fds.Audio.frequency, fds.Audio.waveHalt)
+	}
+	clockFDS(fds, 2000) //a wave cycle takes ~1024 cycles at this frequency, volume latches at the start of the next one
+	if output := fds.Audio.Output(); output != 1 {
+		t.Errorf("full wave at full volume output %f", output)
+	}
+	fds.CPUWrite(0x4083, 0x80)
+	if fds.Audio.waveAcc != 0 {
+		t.Error("halting the wave didn't reset its position")
+	}
+}
@@ -0,0 +1,112 @@
+package nes
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const (
+	klausBinary  = "../TestBinary/Klaus_Func_Test/6502_functional_test.bin"
+	klausListing = "../TestBinary/Klaus_Func_Test/6502_functional_test.lst"
+	klausStart   = 0x0400 //code_segment
+	klausSuccess = 0x336D //the success macro's jmp *
+	klausTestNum = 0x0200 //test_case, the number of the test that is running
+	klausMaxStep = 100_000_000
+)
+
+// listingLine is a line of a ca65 listing that assembled to code
+type listingLine struct {
+	number int
+	text   string
+}
+
+// readListing maps the address of every line of code in a ca65 listing to its line.
+// relocatable lines (before any .org) are skipped since their address isn't known
+func readListing(path string) (map[uint16]listingLine, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	lines := make(map[uint16]listingLine)
+	scanner := bufio.NewScanner(file)
+	number := 0
+	for scanner.Scan() {
+		number++
+		text := scanner.Text()
+		//"003361  1  AD 00 02             lda test_case"
+		if len(text) < 24 || text[6] != ' ' || strings.TrimSpace(text[11:23]) == "" {
+			continue
+		}
+		addr, err := strconv.ParseUint(text[:6], 16, 16)
+		if err != nil {
+			continue
+		}
+		if _, ok := lines[uint16(addr)]; !ok {
+			lines[uint16(addr)] = listingLine{number, strings.TrimSpace(text[24:])}
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// runs Klaus Dormann's 6502 functional test until it loops on a trap.
+// the TestBinary build has decimal mode disabled so it passes on every variant
+func TestKlausFunctional(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the functional test in short mode")
+	}
+	binary, err := os.ReadFile(klausBinary)
+	if err != nil {
+		t.Fatalf("couldn't read test binary: %s", err)
+	}
+	for _, variant := range []CPUVariant{NES2A03, NMOS6502, CMOS65C02} {
+		t.Run(variant.String(), func(t *testing.T) {
+			bus := CreateFlatBus(variant)
+			if err := bus.Load(binary, 0); err != nil {
+				t.Fatal(err)
+			}
+			bus.CPU.PowerOn()
+			bus.CPU.PC = klausStart
+			trap, err := runUntilTrap(bus, klausMaxStep)
+			if err != nil {
+				t.Fatalf("%s (test $%02X)%s", err, bus.Memory[klausTestNum], klausSource(t, bus.CPU.PC))
+			}
+			if trap != klausSuccess {
+				t.Fatalf("trapped at $%04X in test $%02X%s", trap, bus.Memory[klausTestNum], klausSource(t, trap))
+			}
+		})
+	}
+}
+
+// runUntilTrap steps the cpu until an instruction jumps or branches to itself,
+// returns the address of the trap
+func runUntilTrap(bus *FlatBus, maxSteps int) (uint16, error) {
+	for i := 0; i < maxSteps; i++ {
+		pc := bus.CPU.PC
+		if _, err := bus.Step(); err != nil {
+			return pc, err
+		}
+		if bus.CPU.PC == pc {
+			return pc, nil
+		}
+	}
+	return bus.CPU.PC, fmt.Errorf("no trap after %d instructions", maxSteps)
+}
+
+// klausSource finds the source line of addr in the listing
+func klausSource(t *testing.T, addr uint16) string {
+	lines, err := readListing(klausListing)
+	if err != nil {
+		t.Logf("couldn't read listing: %s", err)
+		return ""
+	}
+	line, ok := lines[addr]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(", %s:%d: %s", klausListing, line.number, line.text)
+}
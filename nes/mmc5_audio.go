@@ -0,0 +1,91 @@
+package nes
+
+// MMC5 pulses mix linearly, about as loud as the APU's pulses
+const (
+	mmc5PulseLevel = 0.00996
+	mmc5PCMLevel   = 0.0017
+	mmc5FrameRate  = 7457 // cpu cycles between the envelope and length counter clocks (240hz)
+)
+
+// MMC5Audio is the MMC5's expansion sound, two pulse channels that work like
+// the APU's (minus the sweep unit) and a raw 8 bit PCM channel
+type MMC5Audio struct {
+	pulse1     pulseChannel
+	pulse2     pulseChannel
+	pcm        uint8
+	pcmRead    bool // $5010 bit 0, PCM is loaded by reading $8000-$BFFF instead of writing $5011
+	pcmIRQ     bool
+	frameTimer int
+	evenCycle  bool
+}
+
+func createMMC5Audio() *MMC5Audio {
+	audio := new(MMC5Audio)
+	audio.pulse1.noSweep = true
+	audio.pulse2.noSweep = true
+	return audio
+}
+
+// readRegister handles reads of $5010 and $5015
+func (audio *MMC5Audio) readRegister(addr uint16) uint8 {
+	var value uint8
+	switch addr {
+	case 0x5010:
+		value = setBit(value, 0, audio.pcmRead)
+		value = setBit(value, 7, audio.pcmIRQ)
+		audio.pcmIRQ = false
+	case 0x5015:
+		value = setBit(value, 0, audio.pulse1.length > 0)
+		value = setBit(value, 1, audio.pulse2.length > 0)
+	}
+	return value
+}
+
+// writeRegister handles writes to $5000-$5015
+func (audio *MMC5Audio) writeRegister(addr uint16, value uint8) {
+	switch {
+	case addr <= 0x5003:
+		audio.pulse1.writeRegister(addr-0x5000, value)
+	case addr <= 0x5007:
+		audio.pulse2.writeRegister(addr-0x5004, value)
+	case addr == 0x5010:
+		audio.pcmRead = getBit(0, value)
+	case addr == 0x5011:
+		if !audio.pcmRead && value != 0 { //writing 0 has no effect
+			audio.pcm = value
+		}
+	case addr == 0x5015:
+		audio.pulse1.enabled = getBit(0, value)
+		audio.pulse2.enabled = getBit(1, value)
+		if !audio.pulse1.enabled {
+			audio.pulse1.length = 0
+		}
+		if !audio.pulse2.enabled {
+			audio.pulse2.length = 0
+		}
+	}
+}
+
+// clock advances the channels by one cpu cycle
+// the MMC5 has no frame counter, envelopes and length counters are clocked at a fixed 240hz
+func (audio *MMC5Audio) clock() {
+	if audio.evenCycle {
+		audio.pulse1.clockTimer()
+		audio.pulse2.clockTimer()
+	}
+	audio.evenCycle = !audio.evenCycle
+	audio.frameTimer++
+	if audio.frameTimer >= mmc5FrameRate {
+		audio.frameTimer = 0
+		audio.pulse1.env.clock()
+		audio.pulse2.env.clock()
+		audio.pulse1.clockLength()
+		audio.pulse2.clockLength()
+	}
+}
+
+// Output returns the mixed level of the channels, scaled to the APU's output
+func (audio *MMC5Audio) Output() float32 {
+	pulses := float32(audio.pulse1.output()) + float32(audio.pulse2.output())
+	return pulses*mmc5PulseLevel + float32(audio.pcm)*mmc5PCMLevel
+}
@@ -8,21 +8,87 @@ type NesSystem struct {
 	Memory []uint8    // 2 kilobyte internal ram
 	Cart   *Cartridge //cartridge
 	CPU    *CPU
+	APU    *APU
+
+	RAMPattern RAMPattern //what ram holds at power on
+	RAMSeed    int64      //seed for RAMRandom
+
+	openBus uint8 //last value on the cpu data bus, reads nothing responds to return it
 }
 
 func CreateBus(romPath string) (*NesSystem, error) {
-	bus := new(NesSystem)
 	cart, err := CreateCart(romPath)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't create bus, %s", err)
 	}
+	return CreateBusFromCart(cart), nil
+}
+
+// CreateBusFromCart creates a system around an already loaded cartridge
+// (EX: one created with CreatePatchedCart)
+func CreateBusFromCart(cart *Cartridge) *NesSystem {
+	bus := new(NesSystem)
 	bus.Cart = cart
 	bus.CPU = CreateCPU(bus)
+	bus.APU = CreateAPU(bus.GetCPUByte)
 	bus.Memory = make([]uint8, MemorySize) //initalize ram
-	return bus, nil
+	return bus
+}
+
+// PowerOn turns the system on, ram is filled with RAMPattern
+// and the cpu, APU and mapper start from their power up state
+func (bus *NesSystem) PowerOn() {
+	ramInit := createRAMInit(bus.RAMPattern, bus.RAMSeed)
+	ramInit.fill(bus.Memory)
+	bus.openBus = 0
+	bus.APU.PowerOn()
+	bus.Cart.PowerOn(ramInit)
+	bus.CPU.PowerOn()
+}
+
+// Reset presses the reset button, ram is left alone
+func (bus *NesSystem) Reset() {
+	bus.APU.Reset()
+	bus.Cart.Reset()
+	bus.CPU.Reset()
+}
+
+// Clock advances the system by one cpu cycle
+// the cartridge's and APU's IRQ outputs drive the cpu's IRQ line.
+// Returns the cpu's fault (*InvalidOpcodeError) once it has halted, the rest of the system keeps running
+func (bus *NesSystem) Clock() error {
+	err := bus.CPU.Clock()
+	bus.APU.Clock()
+	bus.Cart.Clock()
+	bus.CPU.SetIRQ(bus.Cart.IRQ() || bus.APU.IRQ())
+	return err
+}
+
+// Step clocks the system until the cpu finishes the current instruction
+func (bus *NesSystem) Step() (StepInfo, error) {
+	return bus.CPU.stepWith(bus.Clock)
+}
+
+// AudioOutput returns the mixed level of the APU and any expansion audio on the cartridge
+func (bus *NesSystem) AudioOutput() float32 {
+	return bus.APU.Output() + bus.Cart.AudioOutput()
 }
 
 func (bus *NesSystem) GetCPUByte(addr uint16) uint8 {
+	bus.openBus = bus.readCPUByte(addr)
+	return bus.openBus
+}
+
+// PeekCPUByte reads memory without side effects, used by debuggers and traces.
+// The PPU and APU registers change when read so they show $FF like Nintendulator's debugger
+func (bus *NesSystem) PeekCPUByte(addr uint16) uint8 {
+	if addr >= 0x2000 && addr <= 0x401F {
+		return 0xFF
+	}
+	return bus.readCPUByte(addr)
+}
+
+func (bus *NesSystem) readCPUByte(addr uint16) uint8 {
 	//internal RAM
 	if addr <= 0x1FFF {
 		//0x0000-0x07FF internal RAM
@@ -36,23 +102,26 @@ func (bus *NesSystem) GetCPUByte(addr uint16) uint8 {
 	}
 	//NES APU and I/O registers
 	if addr <= 0x4017 {
+		if addr == 0x4015 {
+			return bus.APU.ReadStatus()
+		}
 		// TODO
-		return 0
+		return bus.openBus
 	}
 	//APU and I/O functionality that is normally disabled
 	if addr <= 0x401f {
 		// TODO
-		return 0
+		return bus.openBus
 	}
 	//cartridge space
-	if addr <= 0xFFFF {
-		// TODO
-		return bus.Cart.GetCPUByte(addr)
+	if value, ok := bus.Cart.GetCPUByte(addr); ok {
+		return value
 	}
-	panic("Unsporrted Address")
+	return bus.openBus //nothing on the cartridge answered
 }
 
 func (bus *NesSystem) SetCPUByte(addr uint16, value uint8) {
+	bus.openBus = value
 	//internal RAM
 	if addr <= 0x1FFF {
 		//0x0000-0x07FF internal RAM
@@ -66,6 +135,9 @@ func (bus *NesSystem) SetCPUByte(addr uint16, value uint8) {
 	}
 	//NES APU and I/O registers
 	if addr <= 0x4017 {
+		if addr != 0x4014 && addr != 0x4016 {
+			bus.APU.WriteRegister(addr, value)
+		}
 		// TODO
 		return
 	}
@@ -75,11 +147,5 @@ func (bus *NesSystem) SetCPUByte(addr uint16, value uint8) {
 		return
 	}
 	//cartridge space
-	if addr <= 0xFFFF {
-
-		// TODO
-		bus.Cart.SetCPUByte(addr, value)
-		return
-	}
-	panic("Unsporrted Address")
+	bus.Cart.SetCPUByte(addr, value)
 }
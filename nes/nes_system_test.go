@@ -0,0 +1,45 @@
+package nes
+
+import "testing"
+
+func TestPowerOnRegisters(t *testing.T) {
+	system := createTestConsole(t, stateTestProgram).System
+	cpu := system.CPU
+	cpu.AC, cpu.X, cpu.Y, cpu.SP, cpu.SR = 1, 2, 3, 4, 0xFF
+	system.PowerOn()
+	if registers := cpu.Registers(); registers != (Registers{PC: 0x8000, SP: 0xFD, SR: 0x24}) {
+		t.Errorf("powered on with %+v", registers)
+	}
+}
+
+func TestReset(t *testing.T) {
+	system := createTestConsole(t, stateTestProgram).System
+	for i := 0; i < 100; i++ {
+		if err := system.Clock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	system.Memory[0x10] = 0x42
+	for _, variant := range []CPUVariant{NES2A03, CMOS65C02} {
+		cpu := system.CPU
+		cpu.Variant = variant
+		for cpu.RemCycles > 0 {
+			system.Clock()
+		}
+		cpu.AC, cpu.X, cpu.Y, cpu.SP = 0x11, 0x22, 0x33, 0x80
+		cpu.SR = 1<<DF | 0x20
+		system.Reset()
+		if cpu.AC != 0x11 || cpu.X != 0x22 || cpu.Y != 0x33 {
+			t.Errorf("%v: reset changed A, X and Y to %02X %02X %02X", variant, cpu.AC, cpu.X, cpu.Y)
+		}
+		if cpu.SP != 0x7D || !cpu.GetFlag(IF) || cpu.PC != 0x8000 {
+			t.Errorf("%v: reset to SP $%02X, I %t, PC $%04X", variant, cpu.SP, cpu.GetFlag(IF), cpu.PC)
+		}
+		if cpu.GetFlag(DF) != (variant != CMOS65C02) {
+			t.Errorf("%v: decimal flag is %t after reset, only the 65C02 clears it", variant, cpu.GetFlag(DF))
+		}
+	}
+	if system.Memory[0x10] != 0x42 {
+		t.Error("reset changed ram")
+	}
+}
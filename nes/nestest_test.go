@@ -0,0 +1,62 @@
+package nes
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+runs nestest.nes in automation mode (from $C000) and compares every instruction against nestest.log.
+nestest isn't in the repo, put nestest.nes and the Nintendulator nestest.log in roms/
+or point NESTEST_DIR at the directory holding them
+*/
+
+const nestestStart = 0xC000 //automation mode entry point, runs without a PPU
+
+func TestNestest(t *testing.T) {
+	dir := os.Getenv("NESTEST_DIR")
+	if dir == "" {
+		dir = "../roms"
+	}
+	romPath := filepath.Join(dir, "nestest.nes")
+	logPath := filepath.Join(dir, "nestest.log")
+	if _, err := os.Stat(romPath); err != nil {
+		t.Skipf("%s not found", romPath)
+	}
+	logFile, err := os.Open(logPath)
+	if err != nil {
+		t.Skipf("golden log not found: %s", err)
+	}
+	defer logFile.Close()
+
+	console, err := CreateBus(romPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	console.PowerOn()
+	cpu := console.CPU
+	cpu.PC = nestestStart
+
+	golden := bufio.NewScanner(logFile)
+	line := 0
+	for golden.Scan() {
+		line++
+		expected := strings.TrimRight(golden.Text(), " \r")
+		if got := TraceLine(cpu); got != expected {
+			t.Fatalf("nestest.log:%d differs\nexpected: %s\n     got: %s", line, expected, got)
+		}
+		if _, err := console.Step(); err != nil {
+			t.Fatalf("nestest.log:%d: %s", line, err)
+		}
+	}
+	if err := golden.Err(); err != nil {
+		t.Fatal(err)
+	}
+	//automation mode leaves the result codes in $02 and $03, 0 means every test passed
+	if result := console.Memory[2:4]; result[0] != 0 || result[1] != 0 {
+		t.Errorf("nestest reported error codes $%02X $%02X", result[0], result[1])
+	}
+}
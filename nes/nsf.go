@@ -0,0 +1,305 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+var (
+	nsfMagic  = []byte("NESM\x1A")
+	nsfeMagic = []byte("NSFE")
+)
+
+const (
+	nsfHeaderSize  = 0x80
+	nsfDefaultNTSC = 16639 // default PLAY period in microseconds (60.1hz)
+	nsfDefaultPAL  = 19997 // (50.0hz)
+	nsfUnknownTime = -1    // NSFe track time meaning "not specified"
+)
+
+// NSFChip is a bit in the NSF expansion chip flags
+type NSFChip uint8
+
+const (
+	ChipVRC6 NSFChip = 1 << iota
+	ChipVRC7
+	ChipFDS
+	ChipMMC5
+	ChipN163
+	ChipSunsoft5B
+)
+
+// supportedChips are the expansion chips the player can emulate
+const supportedChips = ChipVRC6 | ChipFDS | ChipMMC5
+
+var chipNames = []struct {
+	chip NSFChip
+	name string
+}{
+	{ChipVRC6, "VRC6"},
+	{ChipVRC7, "VRC7"},
+	{ChipFDS, "FDS"},
+	{ChipMMC5, "MMC5"},
+	{ChipN163, "Namco 163"},
+	{ChipSunsoft5B, "Sunsoft 5B"},
+}
+
+// String lists the chips set in the flags
+func (chips NSFChip) String() string {
+	var names []string
+	for _, chip := range chipNames {
+		if chips&chip.chip > 0 {
+			names = append(names, chip.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// NSF is a parsed NSF or NSFe music file
+type NSF struct {
+	Title       string
+	Artist      string
+	Copyright   string
+	Ripper      string // NSFe only
+	Songs       int
+	StartSong   int // 1 based
+	LoadAddr    uint16
+	InitAddr    uint16
+	PlayAddr    uint16
+	NTSCSpeed   uint16 // microseconds between PLAY calls
+	PALSpeed    uint16
+	Region      Region // RegionNTSC, RegionPAL or RegionMulti
+	Banks       [8]uint8
+	Banked      bool // true if any initial bank is non zero (or an NSFe has a BANK chunk)
+	Chips       NSFChip
+	Data        []byte
+	TrackLabels []string // NSFe only, may be shorter than Songs
+	TrackTimes  []int    // NSFe only, milliseconds, -1 if unknown
+	IsNSFe      bool
+}
+
+// ParseNSF parses an NSF or NSFe file
+func ParseNSF(data []byte) (*NSF, error) {
+	switch {
+	case bytes.HasPrefix(data, nsfMagic):
+		return parseNSFHeader(data)
+	case bytes.HasPrefix(data, nsfeMagic):
+		nsf := new(NSF)
+		nsf.IsNSFe = true
+		if err := nsf.parseChunks(data[len(nsfeMagic):], true); err != nil {
+			return nil, fmt.Errorf("couldn't parse NSFe: %s", err)
+		}
+		if err := nsf.validate(); err != nil {
+			return nil, err
+		}
+		return nsf, nil
+	}
+	return nil, fmt.Errorf("couldn't parse NSF: not an NSF or NSFe file")
+}
+
+// nsfString reads a fixed size, null padded string
+func nsfString(field []byte) string {
+	if end := bytes.IndexByte(field, 0); end >= 0 {
+		field = field[:end]
+	}
+	return string(field)
+}
+
+// parseNSFHeader reads a classic NSF (and the NSF2 extensions to it)
+func parseNSFHeader(data []byte) (*NSF, error) {
+	if len(data) < nsfHeaderSize {
+		return nil, fmt.Errorf("couldn't parse NSF: file is smaller than the header")
+	}
+	nsf := new(NSF)
+	version := data[0x05]
+	nsf.Songs = int(data[0x06])
+	nsf.StartSong = int(data[0x07])
+	nsf.LoadAddr = binary.LittleEndian.Uint16(data[0x08:])
+	nsf.InitAddr = binary.LittleEndian.Uint16(data[0x0A:])
+	nsf.PlayAddr = binary.LittleEndian.Uint16(data[0x0C:])
+	nsf.Title = nsfString(data[0x0E:0x2E])
+	nsf.Artist = nsfString(data[0x2E:0x4E])
+	nsf.Copyright = nsfString(data[0x4E:0x6E])
+	nsf.NTSCSpeed = binary.LittleEndian.Uint16(data[0x6E:])
+	copy(nsf.Banks[:], data[0x70:0x78])
+	nsf.PALSpeed = binary.LittleEndian.Uint16(data[0x78:])
+	nsf.setRegion(data[0x7A])
+	nsf.Chips = NSFChip(data[0x7B])
+	for _, bank := range nsf.Banks {
+		if bank != 0 {
+			nsf.Banked = true
+		}
+	}
+	nsf.Data = data[nsfHeaderSize:]
+	//NSF2 can give the length of the program data, NSFe chunks with metadata follow it
+	if version >= 2 {
+		length := int(data[0x7D]) | int(data[0x7E])<<8 | int(data[0x7F])<<16
+		if length > 0 && length < len(nsf.Data) {
+			metadata := nsf.Data[length:]
+			nsf.Data = nsf.Data[:length]
+			if err := nsf.parseChunks(metadata, false); err != nil {
+				return nil, fmt.Errorf("couldn't parse NSF2 metadata: %s", err)
+			}
+		}
+	}
+	if err := nsf.validate(); err != nil {
+		return nil, err
+	}
+	return nsf, nil
+}
+
+// setRegion reads the PAL/NTSC flags byte
+func (nsf *NSF) setRegion(flags uint8) {
+	switch {
+	case getBit(1, flags):
+		nsf.Region = RegionMulti
+	case getBit(0, flags):
+		nsf.Region = RegionPAL
+	default:
+		nsf.Region = RegionNTSC
+	}
+}
+
+// parseChunks reads NSFe chunks, a 4 byte length, a 4 byte id then the data.
+// full is false for NSF2 metadata, where INFO, DATA and BANK come from the header instead
+func (nsf *NSF) parseChunks(data []byte, full bool) error {
+	hasInfo, hasData := false, false
+	for len(data) >= 8 {
+		length := int(binary.LittleEndian.Uint32(data))
+		id := string(data[4:8])
+		data = data[8:]
+		if length > len(data) {
+			return fmt.Errorf("chunk %q is longer than the file", id)
+		}
+		chunk := data[:length]
+		data = data[length:]
+		switch id {
+		case "INFO":
+			if !full {
+				continue
+			}
+			if len(chunk) < 8 {
+				return fmt.Errorf("INFO chunk is too short")
+			}
+			hasInfo = true
+			nsf.LoadAddr = binary.LittleEndian.Uint16(chunk[0:])
+			nsf.InitAddr = binary.LittleEndian.Uint16(chunk[2:])
+			nsf.PlayAddr = binary.LittleEndian.Uint16(chunk[4:])
+			nsf.setRegion(chunk[6])
+			nsf.Chips = NSFChip(chunk[7])
+			nsf.Songs = 1
+			nsf.StartSong = 1
+			if len(chunk) > 8 {
+				nsf.Songs = int(chunk[8])
+			}
+			if len(chunk) > 9 {
+				nsf.StartSong = int(chunk[9]) + 1 //NSFe stores the starting song 0 based
+			}
+		case "DATA":
+			if !full {
+				continue
+			}
+			hasData = true
+			nsf.Data = chunk
+		case "BANK":
+			if !full {
+				continue
+			}
+			nsf.Banked = true
+			copy(nsf.Banks[:], chunk)
+		case "RATE":
+			if len(chunk) >= 2 {
+				nsf.NTSCSpeed = binary.LittleEndian.Uint16(chunk)
+			}
+			if len(chunk) >= 4 {
+				nsf.PALSpeed = binary.LittleEndian.Uint16(chunk[2:])
+			}
+		case "auth":
+			fields := strings.Split(string(chunk), "\x00")
+			for i, field := range fields {
+				switch i {
+				case 0:
+					nsf.Title = field
+				case 1:
+					nsf.Artist = field
+				case 2:
+					nsf.Copyright = field
+				case 3:
+					nsf.Ripper = field
+				}
+			}
+		case "tlbl":
+			nsf.TrackLabels = strings.Split(strings.TrimSuffix(string(chunk), "\x00"), "\x00")
+		case "time":
+			nsf.TrackTimes = nil
+			for i := 0; i+4 <= len(chunk); i += 4 {
+				nsf.TrackTimes = append(nsf.TrackTimes, int(int32(binary.LittleEndian.Uint32(chunk[i:]))))
+			}
+		case "NEND":
+			data = nil
+		default:
+			//chunks starting with an uppercase letter can't be skipped
+			if id[0] >= 'A' && id[0] <= 'Z' {
+				return fmt.Errorf("unsupported required chunk %q", id)
+			}
+		}
+	}
+	if full && (!hasInfo || !hasData) {
+		return fmt.Errorf("missing INFO or DATA chunk")
+	}
+	return nil
+}
+
+// validate checks the values the player depends on and fills in defaults
+func (nsf *NSF) validate() error {
+	if nsf.Songs < 1 {
+		return fmt.Errorf("couldn't parse NSF: no songs")
+	}
+	if len(nsf.Data) == 0 {
+		return fmt.Errorf("couldn't parse NSF: no program data")
+	}
+	if nsf.StartSong < 1 || nsf.StartSong > nsf.Songs {
+		nsf.StartSong = 1
+	}
+	if nsf.NTSCSpeed == 0 {
+		nsf.NTSCSpeed = nsfDefaultNTSC
+	}
+	if nsf.PALSpeed == 0 {
+		nsf.PALSpeed = nsfDefaultPAL
+	}
+	minLoad := uint16(0x8000)
+	if nsf.Chips&ChipFDS > 0 {
+		minLoad = 0x6000 //FDS NSFs can load into the RAM at $6000-$7FFF
+	}
+	if nsf.LoadAddr < minLoad {
+		return fmt.Errorf("couldn't parse NSF: load address $%04X is below $%04X", nsf.LoadAddr, minLoad)
+	}
+	return nil
+}
+
+// UnsupportedChips returns the expansion chips the file uses that the player can't emulate,
+// their registers are ignored so those parts will be silent
+func (nsf *NSF) UnsupportedChips() NSFChip {
+	return nsf.Chips &^ supportedChips
+}
+
+// TrackLabel returns the NSFe label of a track (1 based) or "" if it has none
+func (nsf *NSF) TrackLabel(track int) string {
+	if track < 1 || track > len(nsf.TrackLabels) {
+		return ""
+	}
+	return nsf.TrackLabels[track-1]
+}
+
+// TrackTime returns the NSFe length of a track (1 based) in milliseconds or -1 if unknown
+func (nsf *NSF) TrackTime(track int) int {
+	if track < 1 || track > len(nsf.TrackTimes) {
+		return nsfUnknownTime
+	}
+	return nsf.TrackTimes[track-1]
+}
@@ -0,0 +1,351 @@
+package nes
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	nsfBankSize    = 4096
+	nsfReturnAddr  = 0x5FF0 // INIT and PLAY return here, the player stops the cpu when it's reached
+	nsfFDSRAMSize  = 0xA000 // $6000-$FFFF is all RAM on FDS NSFs
+	nsfRAMSize     = 0x2000 // $6000-$7FFF
+	nsfExRAMSize   = 0x0400 // MMC5 ExRAM at $5C00-$5FF5
+	ntscClockRate  = 1789773.0
+	palClockRate   = 1662607.0
+	highPassCutoff = 90.0 // hz, the NES's output has a high pass filter around 90hz
+	maxSampleRate  = 192000
+)
+
+// nsfMapper is the synthetic cartridge NSFs are played from.
+// $5FF8-$5FFF switch 4kb banks of the program data into $8000-$FFFF,
+// FDS NSFs also switch $6000-$7FFF with $5FF6-$5FF7 and treat everything as RAM
+type nsfMapper struct {
+	cart       *Cartridge
+	nsf        *NSF
+	banks      [8]uint32 // offsets into PRGRom of the banks at $8000-$FFFF
+	fds        *FDSAudio
+	vrc6       *VRC6Audio
+	mmc5       *MMC5Audio
+	exRAM      []byte
+	multiplier [2]uint8 // MMC5 $5205/$5206
+}
+
+// createNSFCart lays the program data out in PRG Rom and attaches an nsfMapper
+func createNSFCart(nsf *NSF) *Cartridge {
+	cart := new(Cartridge)
+	cart.Format = FormatNSF
+	cart.Region = nsf.Region
+	cart.BoardName = "NSF"
+	if nsf.Banked {
+		//banked data starts at the load address's offset in its 4kb bank
+		padding := int(nsf.LoadAddr & 0x0FFF)
+		size := (padding + len(nsf.Data) + nsfBankSize - 1) / nsfBankSize * nsfBankSize
+		cart.PRGRom = make([]byte, size)
+		copy(cart.PRGRom[padding:], nsf.Data)
+	} else {
+		//unbanked data is loaded at the load address ($6000 for FDS NSFs, $8000 otherwise)
+		cart.PRGRom = make([]byte, 0x10000-0x6000)
+		copy(cart.PRGRom[nsf.LoadAddr-0x6000:], nsf.Data)
+	}
+	cart.PRGRomSize = len(cart.PRGRom)
+	cart.PRGRamSize = nsfRAMSize
+	if nsf.Chips&ChipFDS > 0 {
+		cart.PRGRamSize = nsfFDSRAMSize
+	}
+	cart.PRGRam = make([]byte, cart.PRGRamSize)
+	cart.hashRoms()
+
+	mapper := new(nsfMapper)
+	mapper.cart = cart
+	mapper.nsf = nsf
+	if nsf.Chips&ChipFDS > 0 {
+		mapper.fds = createFDSAudio()
+	}
+	if nsf.Chips&ChipVRC6 > 0 {
+		mapper.vrc6 = createVRC6Audio()
+	}
+	if nsf.Chips&ChipMMC5 > 0 {
+		mapper.mmc5 = createMMC5Audio()
+		mapper.exRAM = make([]byte, nsfExRAMSize)
+	}
+	cart.mapper = mapper
+	mapper.reset()
+	return cart
+}
+
+// reset clears the RAM and loads the initial banks
+func (mapper *nsfMapper) reset() {
+	for i := range mapper.cart.PRGRam {
+		mapper.cart.PRGRam[i] = 0
+	}
+	for i := range mapper.exRAM {
+		mapper.exRAM[i] = 0
+	}
+	nsf := mapper.nsf
+	if !nsf.Banked {
+		for i := range mapper.banks {
+			mapper.banks[i] = uint32(0x2000 + i*nsfBankSize)
+		}
+		if mapper.fds != nil {
+			copy(mapper.cart.PRGRam, mapper.cart.PRGRom)
+		}
+		return
+	}
+	if mapper.fds != nil {
+		mapper.switchBank(0x5FF6, nsf.Banks[6])
+		mapper.switchBank(0x5FF7, nsf.Banks[7])
+	}
+	for i, bank := range nsf.Banks {
+		mapper.switchBank(0x5FF8+uint16(i), bank)
+	}
+}
+
+// switchBank handles a write to the bank registers at $5FF6-$5FFF
+func (mapper *nsfMapper) switchBank(addr uint16, bank uint8) {
+	rom := mapper.cart.PRGRom
+	offset := uint32(int(bank)*nsfBankSize) % uint32(len(rom))
+	if mapper.fds != nil {
+		//FDS NSFs run out of RAM, switching a bank copies it in
+		window := int(addr-0x5FF6) * nsfBankSize
+		copy(mapper.cart.PRGRam[window:window+nsfBankSize], rom[offset:])
+		return
+	}
+	if addr >= 0x5FF8 {
+		mapper.banks[addr-0x5FF8] = offset
+	}
+}
+
+// CPUGetMapAddr maps $8000-$FFFF through the bank registers
+func (mapper *nsfMapper) CPUGetMapAddr(addr uint16) uint32 {
+	return mapper.banks[(addr-0x8000)/nsfBankSize] + uint32(addr&0x0FFF)
+}
+
+// PPUGetMapAddr NSFs have no graphics
+func (mapper *nsfMapper) PPUGetMapAddr(addr uint16) uint32 {
+	return 0
+}
+
+// CPURead handles expansion audio registers and RAM, reads from
+// $8000-$FFFF are left to the cartridge unless this is an FDS NSF
+func (mapper *nsfMapper) CPURead(addr uint16) (uint8, bool) {
+	switch {
+	case addr >= 0x6000 && mapper.fds != nil:
+		return mapper.cart.PRGRam[addr-0x6000], true
+	case addr >= 0x6000:
+		return 0, false
+	case addr >= 0x4040 && addr <= 0x4092 && mapper.fds != nil:
+		return mapper.fds.readRegister(addr), true
+	case mapper.mmc5 != nil && (addr == 0x5010 || addr == 0x5015):
+		return mapper.mmc5.readRegister(addr), true
+	case mapper.mmc5 != nil && addr == 0x5205:
+		return uint8(uint16(mapper.multiplier[0]) * uint16(mapper.multiplier[1])), true
+	case mapper.mmc5 != nil && addr == 0x5206:
+		return uint8(uint16(mapper.multiplier[0]) * uint16(mapper.multiplier[1]) >> 8), true
+	case mapper.mmc5 != nil && addr >= 0x5C00 && addr <= 0x5FF5:
+		return mapper.exRAM[addr-0x5C00], true
+	}
+	return uint8(addr >> 8), true //open bus
+}
+
+// CPUWrite handles the bank registers, expansion audio and RAM,
+// writes to rom are ignored
+func (mapper *nsfMapper) CPUWrite(addr uint16, value uint8) bool {
+	switch {
+	case addr >= 0x5FF6 && addr <= 0x5FFF:
+		if mapper.nsf.Banked {
+			mapper.switchBank(addr, value)
+		}
+	case addr >= 0x6000 && mapper.fds != nil:
+		mapper.cart.PRGRam[addr-0x6000] = value
+	case addr >= 0x6000 && addr <= 0x7FFF:
+		return false
+	case addr >= 0x4040 && addr <= 0x408A && mapper.fds != nil:
+		mapper.fds.writeRegister(addr, value)
+	case addr >= 0x9000 && addr <= 0xB002 && mapper.vrc6 != nil:
+		mapper.vrc6.writeRegister(addr, value)
+	case addr >= 0x5000 && addr <= 0x5015 && mapper.mmc5 != nil:
+		mapper.mmc5.writeRegister(addr, value)
+	case (addr == 0x5205 || addr == 0x5206) && mapper.mmc5 != nil:
+		mapper.multiplier[addr-0x5205] = value
+	case addr >= 0x5C00 && addr <= 0x5FF5 && mapper.mmc5 != nil:
+		mapper.exRAM[addr-0x5C00] = value
+	}
+	return true
+}
+
+// Clock advances the expansion audio by one cpu cycle
+func (mapper *nsfMapper) Clock() {
+	if mapper.fds != nil {
+		mapper.fds.clock()
+	}
+	if mapper.vrc6 != nil {
+		mapper.vrc6.clock()
+	}
+	if mapper.mmc5 != nil {
+		mapper.mmc5.clock()
+	}
+}
+
+// IRQ NSFs don't use interrupts
+func (mapper *nsfMapper) IRQ() bool {
+	return false
+}
+
+// AudioOutput mixes the expansion audio
+func (mapper *nsfMapper) AudioOutput() float32 {
+	var out float32
+	if mapper.fds != nil {
+		out += mapper.fds.Output() * fdsMixLevel
+	}
+	if mapper.vrc6 != nil {
+		out += mapper.vrc6.Output()
+	}
+	if mapper.mmc5 != nil {
+		out += mapper.mmc5.Output()
+	}
+	return out
+}
+
+// NSFPlayer plays an NSF by calling its INIT routine once per track
+// and its PLAY routine at the rate the file specifies, sampling the audio output
+type NSFPlayer struct {
+	NSF        *NSF
+	Bus        *NesSystem
+	SampleRate int
+	Region     Region // RegionNTSC or RegionPAL, the timing the file is played with
+
+	track         int
+	running       bool    // the cpu is inside INIT or PLAY
+	playPeriod    float64 // cpu cycles between PLAY calls
+	playTimer     float64
+	cyclesPerSamp float64
+	sampleTimer   float64
+	highPass      float32 // filter coefficient
+	lastIn        float32
+	lastOut       float32
+}
+
+// CreateNSFPlayer creates a player for nsf rendering samples at sampleRate
+// and selects the file's starting track
+func CreateNSFPlayer(nsf *NSF, sampleRate int) (*NSFPlayer, error) {
+	if sampleRate <= 0 || sampleRate > maxSampleRate {
+		return nil, fmt.Errorf("couldn't create NSF player, invalid sample rate %d", sampleRate)
+	}
+	player := new(NSFPlayer)
+	player.NSF = nsf
+	player.SampleRate = sampleRate
+	player.Bus = CreateBusFromCart(createNSFCart(nsf))
+	player.Region = RegionNTSC
+	if nsf.Region == RegionPAL {
+		player.Region = RegionPAL
+	}
+	if err := player.SelectTrack(nsf.StartSong); err != nil {
+		return nil, err
+	}
+	return player, nil
+}
+
+// Track returns the playing track (1 based)
+func (player *NSFPlayer) Track() int {
+	return player.track
+}
+
+// SelectTrack resets the system and runs the INIT routine for track (1 based)
+func (player *NSFPlayer) SelectTrack(track int) error {
+	nsf := player.NSF
+	if track < 1 || track > nsf.Songs {
+		return fmt.Errorf("track %d doesn't exist, the file has %d tracks", track, nsf.Songs)
+	}
+	player.track = track
+	bus := player.Bus
+
+	//clear RAM, reset the banks and the APU
+	for i := range bus.Memory {
+		bus.Memory[i] = 0
+	}
+	bus.Cart.mapper.(*nsfMapper).reset()
+	bus.APU = CreateAPU(bus.GetCPUByte)
+	for addr := uint16(0x4000); addr <= 0x4013; addr++ {
+		bus.SetCPUByte(addr, 0)
+	}
+	bus.SetCPUByte(0x4015, 0x0F)
+	bus.SetCPUByte(0x4017, 0x40) //frame IRQ off
+
+	clockRate, speed := ntscClockRate, nsf.NTSCSpeed
+	if player.Region == RegionPAL {
+		clockRate, speed = palClockRate, nsf.PALSpeed
+	}
+	player.playPeriod = float64(speed) * clockRate / 1000000
+	player.playTimer = player.playPeriod
+	player.cyclesPerSamp = clockRate / float64(player.SampleRate)
+	player.sampleTimer = 0
+	rc := 1 / (2 * math.Pi * highPassCutoff)
+	player.highPass = float32(rc / (rc + 1/float64(player.SampleRate)))
+	player.lastIn, player.lastOut = 0, 0
+
+	//A = song number (0 based), X = 0 for NTSC, 1 for PAL
+	cpu := bus.CPU
+	cpu.PowerOn()
+	cpu.AC = uint8(track - 1)
+	cpu.X = 0
+	if player.Region == RegionPAL {
+		cpu.X = 1
+	}
+	cpu.RemCycles = 0
+	player.call(nsf.InitAddr)
+	return nil
+}
+
+// call jumps to a routine that returns to nsfReturnAddr with RTS
+func (player *NSFPlayer) call(addr uint16) {
+	cpu := player.Bus.CPU
+	cpu.pushWord(nsfReturnAddr - 1) //RTS adds one to the address it pulls
+	cpu.PC = addr
+	player.running = true
+}
+
+// clock advances the player by one cpu cycle, starting PLAY when it's due.
+// If PLAY is still running when the next call is due that call is skipped
+func (player *NSFPlayer) clock() {
+	bus := player.Bus
+	if player.running {
+		if err := bus.CPU.Clock(); err != nil {
+			player.running = false //the routine halted the cpu, nothing more can be called
+		} else if bus.CPU.RemCycles == 0 && bus.CPU.PC == nsfReturnAddr {
+			player.running = false
+		}
+	}
+	bus.APU.Clock()
+	bus.Cart.Clock()
+	player.playTimer--
+	if player.playTimer <= 0 {
+		player.playTimer += player.playPeriod
+		if !player.running && !bus.CPU.Halted {
+			player.call(player.NSF.PlayAddr)
+		}
+	}
+}
+
+// Render fills samples with mono audio from -1 to 1.
+// Each sample is the average output over its cpu cycles, high pass filtered to remove the DC offset.
+// If the file's code halts the cpu the rest of the samples are still rendered
+// from the APU's state and the cpu's fault is returned
+func (player *NSFPlayer) Render(samples []float32) error {
+	for i := range samples {
+		var sum float32
+		cycles := 0
+		player.sampleTimer += player.cyclesPerSamp
+		for player.sampleTimer >= 1 {
+			player.clock()
+			sum += player.Bus.AudioOutput()
+			cycles++
+			player.sampleTimer--
+		}
+		in := sum / float32(cycles)
+		out := player.highPass * (player.lastOut + in - player.lastIn)
+		player.lastIn, player.lastOut = in, out
+		samples[i] = out
+	}
+	return player.Bus.CPU.Fault
+}
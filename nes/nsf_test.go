@@ -0,0 +1,236 @@
+package nes
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// createTestNSF builds an NSF file with program loaded at $8000, INIT at $8000 and PLAY at play
+func createTestNSF(songs, startSong int, play uint16, program []byte) []byte {
+	data := make([]byte, nsfHeaderSize, nsfHeaderSize+len(program))
+	copy(data, nsfMagic)
+	data[0x05] = 1 //version
+	data[0x06] = uint8(songs)
+	data[0x07] = uint8(startSong)
+	binary.LittleEndian.PutUint16(data[0x08:], 0x8000)
+	binary.LittleEndian.PutUint16(data[0x0A:], 0x8000)
+	binary.LittleEndian.PutUint16(data[0x0C:], play)
+	copy(data[0x0E:], "Title")
+	copy(data[0x2E:], "Artist")
+	copy(data[0x4E:], "2024 Copyright")
+	return append(data, program...)
+}
+
+// nsfeChunk builds an NSFe chunk, a 4 byte length, the id then the data
+func nsfeChunk(id string, data []byte) []byte {
+	chunk := binary.LittleEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, id...)
+	return append(chunk, data...)
+}
+
+func createTestNSFe(chunks ...[]byte) []byte {
+	data := append([]byte(nil), nsfeMagic...)
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	return data
+}
+
+// INFO for a 3 song NSFe loading at $8000 and starting on song 2
+var testNSFeInfo = nsfeChunk("INFO", []byte{0x00, 0x80, 0x00, 0x80, 0x03, 0x80, 0x01, byte(ChipVRC6), 3, 1})
+
+func TestParseNSF(t *testing.T) {
+	nsf, err := ParseNSF(createTestNSF(4, 3, 0x8003, []byte{0x60, 0xEA, 0xEA, 0x60}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nsf.Title != "Title" || nsf.Artist != "Artist" || nsf.Copyright != "2024 Copyright" {
+		t.Errorf("strings are %q, %q, %q", nsf.Title, nsf.Artist, nsf.Copyright)
+	}
+	if nsf.Songs != 4 || nsf.StartSong != 3 || nsf.LoadAddr != 0x8000 || nsf.PlayAddr != 0x8003 {
+		t.Errorf("parsed %+v", nsf)
+	}
+	if nsf.NTSCSpeed != nsfDefaultNTSC || nsf.PALSpeed != nsfDefaultPAL {
+		t.Errorf("speeds %d and %d, expected the defaults", nsf.NTSCSpeed, nsf.PALSpeed)
+	}
+	if len(nsf.Data) != 4 || nsf.Banked || nsf.IsNSFe {
+		t.Errorf("%d bytes of data, banked %t, NSFe %t", len(nsf.Data), nsf.Banked, nsf.IsNSFe)
+	}
+}
+
+func TestParseNSFErrors(t *testing.T) {
+	lowLoad := createTestNSF(1, 1, 0x8000, []byte{0x60})
+	lowLoad[0x09] = 0x60 //$6000 without the FDS chip
+	bankedEmpty := createTestNSF(1, 1, 0x8000, nil)
+	bankedEmpty[0x71] = 1 //a bank switched file with no banks to switch to
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"not an NSF", []byte("NES\x1A"), "not an NSF or NSFe"},
+		{"truncated header", createTestNSF(1, 1, 0x8000, nil)[:nsfHeaderSize-1], "smaller than the header"},
+		{"no songs", createTestNSF(0, 1, 0x8000, []byte{0x60}), "no songs"},
+		{"no data", createTestNSF(1, 1, 0x8000, nil), "no program data"},
+		{"banked without data", bankedEmpty, "no program data"},
+		{"load address", lowLoad, "below $8000"},
+	}
+	for _, test := range tests {
+		_, err := ParseNSF(test.data)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: returned %v, expected %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestParseNSFe(t *testing.T) {
+	data := createTestNSFe(
+		testNSFeInfo,
+		nsfeChunk("DATA", []byte{0x60, 0xEA, 0xEA, 0x60}),
+		nsfeChunk("BANK", []byte{0, 1, 2}),
+		nsfeChunk("RATE", []byte{0x10, 0x27, 0x20, 0x4E}),
+		nsfeChunk("auth", []byte("Title\x00Artist\x00Copyright\x00Ripper")),
+		nsfeChunk("tlbl", []byte("One\x00Two\x00")),
+		nsfeChunk("time", []byte{0xE8, 0x03, 0, 0, 0xFF, 0xFF, 0xFF, 0xFF}),
+		nsfeChunk("skip", []byte{1, 2, 3}), //unknown lowercase chunks are skipped
+		nsfeChunk("NEND", nil),
+		nsfeChunk("ABCD", nil), //nothing after NEND is read
+	)
+	nsf, err := ParseNSF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nsf.IsNSFe || nsf.Songs != 3 || nsf.StartSong != 2 || nsf.PlayAddr != 0x8003 || nsf.Chips != ChipVRC6 {
+		t.Errorf("parsed %+v", nsf)
+	}
+	if nsf.Region != RegionPAL || nsf.NTSCSpeed != 10000 || nsf.PALSpeed != 20000 {
+		t.Errorf("region %v with speeds %d and %d", nsf.Region, nsf.NTSCSpeed, nsf.PALSpeed)
+	}
+	if !nsf.Banked || nsf.Banks != [8]uint8{0, 1, 2} || len(nsf.Data) != 4 {
+		t.Errorf("banks %v, %d bytes of data", nsf.Banks, len(nsf.Data))
+	}
+	if nsf.Title != "Title" || nsf.Ripper != "Ripper" {
+		t.Errorf("title %q ripper %q", nsf.Title, nsf.Ripper)
+	}
+	if nsf.TrackLabel(2) != "Two" || nsf.TrackLabel(3) != "" {
+		t.Errorf("track labels %q", nsf.TrackLabels)
+	}
+	if nsf.TrackTime(1) != 1000 || nsf.TrackTime(2) != nsfUnknownTime || nsf.TrackTime(3) != nsfUnknownTime {
+		t.Errorf("track times %v", nsf.TrackTimes)
+	}
+}
+
+func TestParseNSFeErrors(t *testing.T) {
+	program := nsfeChunk("DATA", []byte{0x60})
+	truncated := createTestNSFe(testNSFeInfo, program)
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"truncated chunk", truncated[:len(truncated)-1], "longer than the file"},
+		{"short INFO", createTestNSFe(nsfeChunk("INFO", []byte{0, 0x80}), program), "INFO chunk is too short"},
+		{"missing DATA", createTestNSFe(testNSFeInfo), "missing INFO or DATA"},
+		{"missing INFO", createTestNSFe(program), "missing INFO or DATA"},
+		{"empty DATA", createTestNSFe(testNSFeInfo, nsfeChunk("DATA", nil)), "no program data"},
+		{"required chunk", createTestNSFe(testNSFeInfo, program, nsfeChunk("ABCD", nil)), "unsupported required chunk"},
+	}
+	for _, test := range tests {
+		_, err := ParseNSF(test.data)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: returned %v, expected %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestNSF2Metadata(t *testing.T) {
+	data := createTestNSF(2, 1, 0x8000, []byte{0x60, 0xEA})
+	data[0x05] = 2
+	data[0x7D] = 2 //2 bytes of program, the metadata chunks follow
+	data = append(data, nsfeChunk("tlbl", []byte("Intro\x00Outro"))...)
+	data = append(data, nsfeChunk("DATA", []byte{0xFF})...) //INFO, DATA and BANK come from the header
+	nsf, err := ParseNSF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nsf.Data) != 2 || nsf.TrackLabel(2) != "Outro" {
+		t.Errorf("%d bytes of data, labels %q", len(nsf.Data), nsf.TrackLabels)
+	}
+}
+
+func TestNSFPlayerCalls(t *testing.T) {
+	program := []byte{
+		0x85, 0x00, //INIT: STA $00
+		0x86, 0x02, //STX $02
+		0x60,       //RTS
+		0xE6, 0x01, //PLAY: INC $01
+		0x60, //RTS
+	}
+	nsf, err := ParseNSF(createTestNSF(3, 2, 0x8005, program))
+	if err != nil {
+		t.Fatal(err)
+	}
+	player, err := CreateNSFPlayer(nsf, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := player.Render(make([]float32, 2205)); err != nil { //~89500 cycles, 3 PLAY periods
+		t.Fatal(err)
+	}
+	memory := player.Bus.Memory
+	if memory[0x00] != 1 || memory[0x02] != 0 {
+		t.Errorf("INIT got A=%d X=%d, expected song 1 (0 based) and NTSC", memory[0x00], memory[0x02])
+	}
+	if memory[0x01] != 3 {
+		t.Errorf("PLAY was called %d times, expected 3", memory[0x01])
+	}
+	if player.running || player.Bus.CPU.PC != nsfReturnAddr {
+		t.Errorf("player is still in a routine at $%04X", player.Bus.CPU.PC)
+	}
+
+	if err := player.SelectTrack(4); err == nil {
+		t.Error("selecting track 4 of 3 didn't fail")
+	}
+	if err := player.SelectTrack(3); err != nil {
+		t.Fatal(err)
+	}
+	player.Render(make([]float32, 10))
+	if player.Bus.Memory[0x00] != 2 || player.Bus.Memory[0x01] != 0 {
+		t.Errorf("track 3 INIT got A=%d and RAM wasn't cleared", player.Bus.Memory[0x00])
+	}
+}
+
+func TestNSFPlayerSkipsPlayCalls(t *testing.T) {
+	program := []byte{
+		0x60,       //INIT: RTS
+		0xE6, 0x01, //PLAY: INC $01
+		0x4C, 0x03, 0x80, //JMP * never returns
+	}
+	nsf, err := ParseNSF(createTestNSF(1, 1, 0x8001, program))
+	if err != nil {
+		t.Fatal(err)
+	}
+	player, err := CreateNSFPlayer(nsf, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	player.Render(make([]float32, 2205))
+	if calls := player.Bus.Memory[0x01]; calls != 1 {
+		t.Errorf("PLAY was called %d times while it was still running", calls)
+	}
+}
+
+func TestNSFPlayerFault(t *testing.T) {
+	nsf, err := ParseNSF(createTestNSF(1, 1, 0x8000, []byte{0x02})) //KIL
+	if err != nil {
+		t.Fatal(err)
+	}
+	player, err := CreateNSFPlayer(nsf, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := player.Render(make([]float32, 100)); err == nil {
+		t.Error("rendering after INIT halted the cpu didn't return the fault")
+	}
+}
@@ -0,0 +1,329 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// patch file magic numbers
+var (
+	ipsMagic    = []byte("PATCH")
+	ipsEOF      = []byte("EOF")
+	upsMagic    = []byte("UPS1")
+	bpsMagic    = []byte("BPS1")
+	patchSuffix = []string{".ips", ".ups", ".bps"} // extensions searched for by FindPatches
+)
+
+// maxPatchTarget is the largest rom a UPS or BPS patch can produce,
+// the sizes come from the patch so a corrupt one could ask for any amount of memory
+const maxPatchTarget = 16 << 20
+
+// ApplyPatch detects the format of patch from its magic number
+// and applies it to rom, returning the patched rom.
+// rom is never modified, a new buffer is always returned
+func ApplyPatch(rom []byte, patch []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(patch, ipsMagic):
+		return ApplyIPS(rom, patch)
+	case bytes.HasPrefix(patch, upsMagic):
+		return ApplyUPS(rom, patch)
+	case bytes.HasPrefix(patch, bpsMagic):
+		return ApplyBPS(rom, patch)
+	}
+	return nil, fmt.Errorf("unknown patch format")
+}
+
+// FindPatches returns the paths of any .ips, .ups or .bps files
+// sitting alongside romPath with the same base name.
+// EX: roms/game.nes -> roms/game.ips
+func FindPatches(romPath string) []string {
+	base := strings.TrimSuffix(romPath, filepath.Ext(romPath))
+	var found []string
+	for _, suffix := range patchSuffix {
+		if info, err := os.Stat(base + suffix); err == nil && !info.IsDir() {
+			found = append(found, base+suffix)
+		}
+	}
+	return found
+}
+
+// ApplyIPS applies an IPS patch to rom
+// records are a 3 byte big endian offset followed by a 2 byte big endian size
+// and size bytes of data. A size of 0 marks an RLE record, which is followed
+// by a 2 byte run length and the single byte to repeat.
+// The records end with "EOF", optionally followed by a 3 byte
+// offset to truncate the output to (truncate extension)
+func ApplyIPS(rom []byte, patch []byte) ([]byte, error) {
+	if !bytes.HasPrefix(patch, ipsMagic) {
+		return nil, fmt.Errorf("not an IPS patch")
+	}
+	out := make([]byte, len(rom))
+	copy(out, rom)
+	pos := len(ipsMagic)
+	for {
+		if pos+3 > len(patch) {
+			return nil, fmt.Errorf("IPS patch is missing EOF marker")
+		}
+		if bytes.Equal(patch[pos:pos+3], ipsEOF) {
+			pos += 3
+			break
+		}
+		if pos+5 > len(patch) {
+			return nil, fmt.Errorf("IPS record at 0x%X is truncated", pos)
+		}
+		offset := int(patch[pos])<<16 | int(patch[pos+1])<<8 | int(patch[pos+2])
+		size := int(binary.BigEndian.Uint16(patch[pos+3:]))
+		pos += 5
+		if size == 0 { //RLE record
+			if pos+3 > len(patch) {
+				return nil, fmt.Errorf("IPS RLE record at 0x%X is truncated", pos-5)
+			}
+			runLength := int(binary.BigEndian.Uint16(patch[pos:]))
+			value := patch[pos+2]
+			pos += 3
+			out = growTo(out, offset+runLength)
+			for i := 0; i < runLength; i++ {
+				out[offset+i] = value
+			}
+			continue
+		}
+		if pos+size > len(patch) {
+			return nil, fmt.Errorf("IPS record at 0x%X is truncated", pos-5)
+		}
+		out = growTo(out, offset+size)
+		copy(out[offset:], patch[pos:pos+size])
+		pos += size
+	}
+	//truncate extension
+	if pos+3 <= len(patch) {
+		truncateTo := int(patch[pos])<<16 | int(patch[pos+1])<<8 | int(patch[pos+2])
+		if truncateTo < len(out) {
+			out = out[:truncateTo]
+		}
+	}
+	return out, nil
+}
+
+// growTo extends buf with zeros so it is at least size bytes long
+func growTo(buf []byte, size int) []byte {
+	if size <= len(buf) {
+		return buf
+	}
+	return append(buf, make([]byte, size-len(buf))...)
+}
+
+// patchReader walks the variable length encoded fields shared by UPS and BPS patches
+type patchReader struct {
+	data []byte
+	pos  int
+	end  int // position of the footer, reading past it is an error
+	err  error
+}
+
+// readByte returns the next byte of the patch
+func (r *patchReader) readByte() uint8 {
+	if r.pos >= r.end {
+		if r.err == nil {
+			r.err = fmt.Errorf("patch data is truncated")
+		}
+		return 0
+	}
+	value := r.data[r.pos]
+	r.pos++
+	return value
+}
+
+// readNumber decodes a beat style variable length number.
+// each byte holds 7 bits, the high bit marks the last byte, and every continuation
+// adds an implicit offset so there is only one encoding for each value
+func (r *patchReader) readNumber() int {
+	value, shift := 0, 1
+	for r.err == nil {
+		x := int(r.readByte())
+		value += (x & 0x7F) * shift
+		if x&0x80 > 0 {
+			break
+		}
+		shift <<= 7
+		value += shift
+		if shift > 1<<42 {
+			r.err = fmt.Errorf("patch number is too large")
+		}
+	}
+	return value
+}
+
+// patchFooter holds the three CRC32 checksums at the end of UPS and BPS patches
+type patchFooter struct {
+	sourceCRC uint32
+	targetCRC uint32
+	patchCRC  uint32
+}
+
+// readFooter validates the patch's own checksum and returns the footer
+func readFooter(patch []byte, format string) (patchFooter, error) {
+	if len(patch) < 4+12 {
+		return patchFooter{}, fmt.Errorf("%s patch is too short", format)
+	}
+	footer := patch[len(patch)-12:]
+	result := patchFooter{
+		sourceCRC: binary.LittleEndian.Uint32(footer[0:]),
+		targetCRC: binary.LittleEndian.Uint32(footer[4:]),
+		patchCRC:  binary.LittleEndian.Uint32(footer[8:]),
+	}
+	if crc := crc32.ChecksumIEEE(patch[:len(patch)-4]); crc != result.patchCRC {
+		return result, fmt.Errorf("%s patch checksum mismatch (expected %08X, got %08X)", format, result.patchCRC, crc)
+	}
+	return result, nil
+}
+
+// ApplyUPS applies a UPS patch to rom
+// the patch is a list of (relative offset, xor data) hunks, each hunk
+// terminated by a zero byte. Source, target and patch CRC32s are checked
+func ApplyUPS(rom []byte, patch []byte) ([]byte, error) {
+	if !bytes.HasPrefix(patch, upsMagic) {
+		return nil, fmt.Errorf("not a UPS patch")
+	}
+	footer, err := readFooter(patch, "UPS")
+	if err != nil {
+		return nil, err
+	}
+	r := &patchReader{data: patch, pos: len(upsMagic), end: len(patch) - 12}
+	sourceSize := r.readNumber()
+	targetSize := r.readNumber()
+	if r.err != nil {
+		return nil, fmt.Errorf("UPS header: %s", r.err)
+	}
+	if targetSize > maxPatchTarget {
+		return nil, fmt.Errorf("UPS patch target of %d bytes is too large", targetSize)
+	}
+	if sourceSize != len(rom) {
+		return nil, fmt.Errorf("UPS patch expects a %d byte rom, got %d bytes", sourceSize, len(rom))
+	}
+	if crc := crc32.ChecksumIEEE(rom); crc != footer.sourceCRC {
+		return nil, fmt.Errorf("UPS patch is for a different rom (expected CRC32 %08X, got %08X)", footer.sourceCRC, crc)
+	}
+	out := make([]byte, targetSize)
+	copy(out, rom)
+	offset := 0
+	for r.pos < r.end && r.err == nil {
+		offset += r.readNumber()
+		for r.err == nil {
+			x := r.readByte()
+			if x == 0 {
+				offset++ //the terminating zero also advances the output
+				break
+			}
+			if offset < len(out) {
+				out[offset] ^= x
+			}
+			offset++
+		}
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("UPS hunk: %s", r.err)
+	}
+	if crc := crc32.ChecksumIEEE(out); crc != footer.targetCRC {
+		return nil, fmt.Errorf("UPS patched rom checksum mismatch (expected %08X, got %08X)", footer.targetCRC, crc)
+	}
+	return out, nil
+}
+
+// bps action types, stored in the low 2 bits of each action
+const (
+	bpsSourceRead = iota
+	bpsTargetRead
+	bpsSourceCopy
+	bpsTargetCopy
+)
+
+// ApplyBPS applies a BPS patch to rom
+// the target is built from a list of actions that either copy from the
+// source rom, copy literal data from the patch, or copy from previously
+// written parts of the source or target. Source, target and patch CRC32s are checked
+func ApplyBPS(rom []byte, patch []byte) ([]byte, error) {
+	if !bytes.HasPrefix(patch, bpsMagic) {
+		return nil, fmt.Errorf("not a BPS patch")
+	}
+	footer, err := readFooter(patch, "BPS")
+	if err != nil {
+		return nil, err
+	}
+	r := &patchReader{data: patch, pos: len(bpsMagic), end: len(patch) - 12}
+	sourceSize := r.readNumber()
+	targetSize := r.readNumber()
+	metadataSize := r.readNumber()
+	r.pos += metadataSize //metadata is an xml string we have no use for
+	if r.err != nil || r.pos > r.end {
+		return nil, fmt.Errorf("BPS header is truncated")
+	}
+	if targetSize > maxPatchTarget {
+		return nil, fmt.Errorf("BPS patch target of %d bytes is too large", targetSize)
+	}
+	if sourceSize != len(rom) {
+		return nil, fmt.Errorf("BPS patch expects a %d byte rom, got %d bytes", sourceSize, len(rom))
+	}
+	if crc := crc32.ChecksumIEEE(rom); crc != footer.sourceCRC {
+		return nil, fmt.Errorf("BPS patch is for a different rom (expected CRC32 %08X, got %08X)", footer.sourceCRC, crc)
+	}
+	out := make([]byte, targetSize)
+	outputOffset, sourceRelative, targetRelative := 0, 0, 0
+	for r.pos < r.end && r.err == nil {
+		action := r.readNumber()
+		length := (action >> 2) + 1
+		if outputOffset+length > targetSize {
+			return nil, fmt.Errorf("BPS action writes past the end of the target")
+		}
+		switch action & 0x3 {
+		case bpsSourceRead:
+			if outputOffset+length > len(rom) {
+				return nil, fmt.Errorf("BPS source read past the end of the rom")
+			}
+			copy(out[outputOffset:], rom[outputOffset:outputOffset+length])
+		case bpsTargetRead:
+			if r.pos+length > r.end {
+				return nil, fmt.Errorf("BPS target read is truncated")
+			}
+			copy(out[outputOffset:], patch[r.pos:r.pos+length])
+			r.pos += length
+		case bpsSourceCopy:
+			sourceRelative += signedNumber(r.readNumber())
+			if sourceRelative < 0 || sourceRelative+length > len(rom) {
+				return nil, fmt.Errorf("BPS source copy out of range")
+			}
+			copy(out[outputOffset:], rom[sourceRelative:sourceRelative+length])
+			sourceRelative += length
+		case bpsTargetCopy:
+			targetRelative += signedNumber(r.readNumber())
+			if targetRelative < 0 || targetRelative >= outputOffset {
+				return nil, fmt.Errorf("BPS target copy out of range")
+			}
+			//copied byte by byte since the source and destination may overlap (used for RLE)
+			for i := 0; i < length; i++ {
+				out[outputOffset+i] = out[targetRelative]
+				targetRelative++
+			}
+		}
+		outputOffset += length
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("BPS action: %s", r.err)
+	}
+	if crc := crc32.ChecksumIEEE(out); crc != footer.targetCRC {
+		return nil, fmt.Errorf("BPS patched rom checksum mismatch (expected %08X, got %08X)", footer.targetCRC, crc)
+	}
+	return out, nil
+}
+
+// signedNumber converts a BPS relative offset, where the low bit is the sign, into an int
+func signedNumber(value int) int {
+	if value&1 > 0 {
+		return -(value >> 1)
+	}
+	return value >> 1
+}
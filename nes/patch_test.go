@@ -0,0 +1,214 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// patchNumber encodes a beat style variable length number
+func patchNumber(value int) []byte {
+	var out []byte
+	for {
+		x := byte(value & 0x7F)
+		value >>= 7
+		if value == 0 {
+			return append(out, 0x80|x)
+		}
+		out = append(out, x)
+		value--
+	}
+}
+
+// appendPatchFooter adds the source, target and patch CRC32s that end UPS and BPS patches
+func appendPatchFooter(patch, source, target []byte) []byte {
+	patch = binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(source))
+	patch = binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(target))
+	return binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(patch))
+}
+
+// createUPS builds a UPS patch turning source into target, bytes added past the end of source can't be 0
+func createUPS(source, target []byte) []byte {
+	patch := append([]byte(nil), upsMagic...)
+	patch = append(patch, patchNumber(len(source))...)
+	patch = append(patch, patchNumber(len(target))...)
+	sourceByte := func(i int) byte {
+		if i < len(source) {
+			return source[i]
+		}
+		return 0
+	}
+	last := 0
+	for i := 0; i < len(target); i++ {
+		if sourceByte(i) == target[i] {
+			continue
+		}
+		patch = append(patch, patchNumber(i-last)...)
+		for ; i < len(target) && sourceByte(i) != target[i]; i++ {
+			patch = append(patch, sourceByte(i)^target[i])
+		}
+		patch = append(patch, 0) //also skips the unchanged byte at i
+		last = i + 1
+	}
+	return appendPatchFooter(patch, source, target)
+}
+
+func TestApplyIPS(t *testing.T) {
+	rom := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	patch := []byte("PATCH")
+	patch = append(patch, 0, 0, 1, 0, 2, 0xAA, 0xBB) //2 bytes at 1
+	patch = append(patch, 0, 0, 5, 0, 0, 0, 5, 0xCC) //RLE, 5 0xCCs at 5, past the end of the rom
+	patch = append(patch, "EOF"...)
+	expected := []byte{0, 0xAA, 0xBB, 3, 4, 0xCC, 0xCC, 0xCC, 0xCC, 0xCC}
+	out, err := ApplyPatch(rom, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, expected) {
+		t.Errorf("patched rom is %v, expected %v", out, expected)
+	}
+	if rom[1] != 1 {
+		t.Error("patching modified the original rom")
+	}
+
+	//truncate extension
+	out, err = ApplyIPS(rom, append(append([]byte(nil), patch...), 0, 0, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, expected[:4]) {
+		t.Errorf("truncated rom is %v, expected %v", out, expected[:4])
+	}
+}
+
+func TestApplyIPSErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		err   string
+	}{
+		{"missing EOF", "PATCH\x00\x00\x01\x00\x01\xAA", "missing EOF"},
+		{"truncated record", "PATCH\x00\x00\x01\x00\x05\xAAEOF", "truncated"},
+		{"truncated RLE", "PATCH\x00\x00\x01\x00\x00\x00", "RLE record at 0x5 is truncated"},
+		{"not IPS", "PATC", "unknown patch format"},
+	}
+	for _, test := range tests {
+		_, err := ApplyPatch(make([]byte, 8), []byte(test.patch))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: returned %v, expected %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestApplyUPS(t *testing.T) {
+	source := []byte("ABCDEFGHIJKLMNOP")
+	target := []byte("ABcDEFGHijKLMNOPqr")
+	patch := createUPS(source, target)
+	out, err := ApplyPatch(source, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, target) {
+		t.Errorf("patched rom is %q, expected %q", out, target)
+	}
+
+	other := []byte("abcdefghijklmnop")
+	if _, err := ApplyUPS(other, patch); err == nil || !strings.Contains(err.Error(), "different rom") {
+		t.Errorf("patching another rom returned %v", err)
+	}
+	if _, err := ApplyUPS(source[:8], patch); err == nil || !strings.Contains(err.Error(), "expects a 16 byte rom") {
+		t.Errorf("patching a smaller rom returned %v", err)
+	}
+	corrupt := append([]byte(nil), patch...)
+	corrupt[len(upsMagic)+3] ^= 0xFF
+	if _, err := ApplyUPS(source, corrupt); err == nil || !strings.Contains(err.Error(), "patch checksum mismatch") {
+		t.Errorf("patching with a corrupt patch returned %v", err)
+	}
+	wrongTarget := appendPatchFooter(append([]byte(nil), patch[:len(patch)-12]...), source, source)
+	if _, err := ApplyUPS(source, wrongTarget); err == nil || !strings.Contains(err.Error(), "patched rom checksum mismatch") {
+		t.Errorf("patching with the wrong target checksum returned %v", err)
+	}
+
+	huge := append([]byte(nil), upsMagic...)
+	huge = append(huge, patchNumber(len(source))...)
+	huge = append(huge, patchNumber(maxPatchTarget+1)...)
+	if _, err := ApplyUPS(source, appendPatchFooter(huge, source, target)); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("patching to a %d byte rom returned %v", maxPatchTarget+1, err)
+	}
+}
+
+// bpsAction encodes an action of length bytes
+func bpsAction(action, length int) []byte {
+	return patchNumber((length-1)<<2 | action)
+}
+
+func TestApplyBPS(t *testing.T) {
+	source := []byte("ABCDEFGH")
+	target := []byte("ABxyzGHHHH")
+	patch := append([]byte(nil), bpsMagic...)
+	patch = append(patch, patchNumber(len(source))...)
+	patch = append(patch, patchNumber(len(target))...)
+	patch = append(patch, patchNumber(4)...)
+	patch = append(patch, "<x/>"...) //metadata
+	patch = append(patch, bpsAction(bpsSourceRead, 2)...)
+	patch = append(patch, bpsAction(bpsTargetRead, 3)...)
+	patch = append(patch, "xyz"...)
+	patch = append(patch, bpsAction(bpsSourceCopy, 2)...)
+	patch = append(patch, patchNumber(6<<1)...) //GH from source offset 6
+	patch = append(patch, bpsAction(bpsTargetCopy, 3)...)
+	patch = append(patch, patchNumber(6<<1)...) //H repeated from target offset 6, overlapping the output
+	patch = appendPatchFooter(patch, source, target)
+
+	out, err := ApplyPatch(source, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, target) {
+		t.Errorf("patched rom is %q, expected %q", out, target)
+	}
+	if _, err := ApplyBPS([]byte("abcdefgh"), patch); err == nil || !strings.Contains(err.Error(), "different rom") {
+		t.Errorf("patching another rom returned %v", err)
+	}
+	corrupt := append([]byte(nil), patch...)
+	corrupt[len(corrupt)-14] ^= 0xFF
+	if _, err := ApplyBPS(source, corrupt); err == nil || !strings.Contains(err.Error(), "patch checksum mismatch") {
+		t.Errorf("patching with a corrupt patch returned %v", err)
+	}
+
+	header := append([]byte(nil), bpsMagic...)
+	header = append(header, patchNumber(len(source))...)
+	tests := []struct {
+		name    string
+		size    int
+		actions []byte
+		err     string
+	}{
+		{"target too large", maxPatchTarget + 1, nil, "too large"},
+		{"write past target", 2, bpsAction(bpsSourceRead, 3), "past the end of the target"},
+		{"source read past rom", 10, bpsAction(bpsSourceRead, 9), "past the end of the rom"},
+		{"truncated target read", 4, append(bpsAction(bpsTargetRead, 4), "ab"...), "target read is truncated"},
+		{"source copy range", 4, append(bpsAction(bpsSourceCopy, 4), patchNumber(5<<1)...), "source copy out of range"},
+		{"target copy range", 4, append(bpsAction(bpsTargetCopy, 1), patchNumber(0)...), "target copy out of range"},
+	}
+	for _, test := range tests {
+		patch := append(append([]byte(nil), header...), patchNumber(test.size)...)
+		patch = append(patch, patchNumber(0)...)
+		patch = append(patch, test.actions...)
+		_, err := ApplyBPS(source, appendPatchFooter(patch, source, target))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: returned %v, expected %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestReadRomFileMissing(t *testing.T) {
+	_, err := ReadRomFile(filepath.Join(t.TempDir(), "missing.nes"), nil)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("reading a missing rom returned %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package nes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+runs the SingleStepTests/ProcessorTests 6502 json tests (github.com/SingleStepTests/ProcessorTests)
+every file (EX: a9.json) holds thousands of single instruction tests for one opcode.
+the full set isn't in the repo, testdata/processor_tests holds a few hand written tests in the same format
+that run by default. Point PROCESSOR_TESTS_DIR at a checkout's 6502/v1 (or nes6502/v1) directory to run them all:
+	PROCESSOR_TESTS_DIR=~/ProcessorTests/6502/v1 go test ./nes -run ProcessorTests
+PROCESSOR_TESTS_CPU picks the cpu variant (2a03, 6502 or 65c02), 6502 by default
+*/
+
+const processorTestsMaxErrors = 5 //mismatches printed per opcode
+
+var processorTestVariants = map[string]CPUVariant{"2a03": NES2A03, "6502": NMOS6502, "65c02": CMOS65C02}
+
+type processorState struct {
+	PC  uint16     `json:"pc"`
+	S   uint8      `json:"s"`
+	A   uint8      `json:"a"`
+	X   uint8      `json:"x"`
+	Y   uint8      `json:"y"`
+	P   uint8      `json:"p"`
+	RAM [][2]int32 `json:"ram"` //[address, value] pairs
+}
+
+type processorTest struct {
+	Name    string         `json:"name"`
+	Initial processorState `json:"initial"`
+	Final   processorState `json:"final"`
+	Cycles  []busAccess    `json:"cycles"`
+}
+
+// busAccess is one cycle of bus activity, written as [address, value, "read" or "write"]
+type busAccess struct {
+	Addr  uint16
+	Value uint8
+	Write bool
+}
+
+func (access *busAccess) UnmarshalJSON(data []byte) error {
+	var fields [3]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	addr, addrOk := fields[0].(float64)
+	value, valueOk := fields[1].(float64)
+	kind, kindOk := fields[2].(string)
+	if !addrOk || !valueOk || !kindOk {
+		return fmt.Errorf("invalid bus cycle %s", data)
+	}
+	access.Addr = uint16(addr)
+	access.Value = uint8(value)
+	access.Write = kind == "write"
+	return nil
+}
+
+func (access busAccess) String() string {
+	kind := "read"
+	if access.Write {
+		kind = "write"
+	}
+	return fmt.Sprintf("%s $%02X @ $%04X", kind, access.Value, access.Addr)
+}
+
+// recordingBus is a flat 64KB bus that records every access the cpu makes
+type recordingBus struct {
+	Memory []uint8
+	Log    []busAccess
+}
+
+func (bus *recordingBus) GetCPUByte(addr uint16) uint8 {
+	bus.Log = append(bus.Log, busAccess{addr, bus.Memory[addr], false})
+	return bus.Memory[addr]
+}
+
+// PeekCPUByte isn't recorded, Step peeks at the instruction to describe it
+func (bus *recordingBus) PeekCPUByte(addr uint16) uint8 {
+	return bus.Memory[addr]
+}
+
+func (bus *recordingBus) SetCPUByte(addr uint16, value uint8) {
+	bus.Log = append(bus.Log, busAccess{addr, value, true})
+	bus.Memory[addr] = value
+}
+
+func TestProcessorTests(t *testing.T) {
+	dir := os.Getenv("PROCESSOR_TESTS_DIR")
+	if dir == "" {
+		dir = filepath.Join("testdata", "processor_tests")
+	}
+	variant := NMOS6502
+	if name := os.Getenv("PROCESSOR_TESTS_CPU"); name != "" {
+		var ok bool
+		if variant, ok = processorTestVariants[strings.ToLower(name)]; !ok {
+			t.Fatalf("unknown cpu %q, use 2a03, 6502 or 65c02", name)
+		}
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no json tests in %s", dir)
+	}
+	for _, file := range files {
+		file := file
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".json"), func(t *testing.T) {
+			runProcessorTestFile(t, file, variant)
+		})
+	}
+}
+
+// runProcessorTestFile runs every test for one opcode and reports the mismatches
+func runProcessorTestFile(t *testing.T, file string, variant CPUVariant) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests []processorTest
+	if err := json.Unmarshal(data, &tests); err != nil {
+		t.Fatalf("couldn't parse %s: %s", file, err)
+	}
+	bus := &recordingBus{Memory: make([]uint8, FlatMemorySize)}
+	cpu := CreateCPUVariant(bus, variant)
+	failed, skipped := 0, 0
+	for _, test := range tests {
+		mismatches, err := runProcessorTest(cpu, bus, test)
+		if err != nil {
+			skipped++ //KIL jams the cpu, nothing more to compare
+			continue
+		}
+		if len(mismatches) == 0 {
+			continue
+		}
+		failed++
+		if failed <= processorTestsMaxErrors {
+			t.Errorf("%s:\n\t%s", test.Name, strings.Join(mismatches, "\n\t"))
+		}
+	}
+	if failed > processorTestsMaxErrors {
+		t.Errorf("%d of %d tests failed", failed, len(tests))
+	}
+	if skipped == len(tests) {
+		t.Skipf("all %d tests jam the cpu", skipped)
+	} else if skipped > 0 {
+		t.Logf("skipped %d of %d tests that jam the cpu", skipped, len(tests))
+	}
+}
+
+// runProcessorTest runs one instruction from the initial state and compares it against the final state.
+// Returns the error if the instruction was KIL, every other instruction is compared (STP stops the 65C02 where the test expects)
+func runProcessorTest(cpu *CPU, bus *recordingBus, test processorTest) ([]string, error) {
+	initial, final := test.Initial, test.Final
+	for _, pair := range initial.RAM {
+		bus.Memory[pair[0]] = uint8(pair[1])
+	}
+	cpu.PowerOn()
+	cpu.PC, cpu.SP, cpu.AC, cpu.X, cpu.Y, cpu.SR = initial.PC, initial.S, initial.A, initial.X, initial.Y, initial.P
+	bus.Log = bus.Log[:0]
+	defer func() {
+		//clear what the test touched instead of the whole 64KB
+		for _, pair := range initial.RAM {
+			bus.Memory[pair[0]] = 0
+		}
+		for _, access := range bus.Log {
+			bus.Memory[access.Addr] = 0
+		}
+	}()
+	step, err := cpu.Step()
+	var invalidOpcode *InvalidOpcodeError
+	if errors.As(err, &invalidOpcode) {
+		return nil, err
+	}
+	cycles := step.Cycles
+
+	var mismatches []string
+	registers := []struct {
+		name             string
+		actual, expected uint16
+	}{
+		{"PC", cpu.PC, final.PC},
+		{"SP", uint16(cpu.SP), uint16(final.S)},
+		{"A", uint16(cpu.AC), uint16(final.A)},
+		{"X", uint16(cpu.X), uint16(final.X)},
+		{"Y", uint16(cpu.Y), uint16(final.Y)},
+		{"P", uint16(cpu.SR), uint16(final.P)},
+	}
+	for _, register := range registers {
+		if register.actual != register.expected {
+			mismatches = append(mismatches, fmt.Sprintf("%s = $%02X, expected $%02X", register.name, register.actual, register.expected))
+		}
+	}
+	for _, pair := range final.RAM {
+		if value := bus.Memory[pair[0]]; value != uint8(pair[1]) {
+			mismatches = append(mismatches, fmt.Sprintf("ram $%04X = $%02X, expected $%02X", pair[0], value, pair[1]))
+		}
+	}
+	if cycles != len(test.Cycles) {
+		mismatches = append(mismatches, fmt.Sprintf("took %d cycles, expected %d", cycles, len(test.Cycles)))
+	}
+	if len(bus.Log) != len(test.Cycles) {
+		mismatches = append(mismatches, fmt.Sprintf("made %d bus accesses, expected %d", len(bus.Log), len(test.Cycles)))
+	}
+	for i := 0; i < len(bus.Log) && i < len(test.Cycles); i++ {
+		if bus.Log[i] != test.Cycles[i] {
+			mismatches = append(mismatches, fmt.Sprintf("cycle %d: %s, expected %s", i+1, bus.Log[i], test.Cycles[i]))
+			break
+		}
+	}
+	return mismatches, nil
+}
@@ -0,0 +1,69 @@
+package nes
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// RAMPattern is what ram holds at power on, real consoles differ and some games behave differently on each
+type RAMPattern int
+
+const (
+	RAMZeros  RAMPattern = iota //every byte $00
+	RAMOnes                     //every byte $FF
+	RAMRandom                   //random bytes from RAMSeed
+)
+
+func (pattern RAMPattern) String() string {
+	switch pattern {
+	case RAMOnes:
+		return "ff"
+	case RAMRandom:
+		return "random"
+	}
+	return "zeros"
+}
+
+// ParseRAMPattern parses the name of a pattern (zeros, ff or random)
+func ParseRAMPattern(name string) (RAMPattern, error) {
+	switch strings.ToLower(name) {
+	case "zeros", "00":
+		return RAMZeros, nil
+	case "ff", "ones":
+		return RAMOnes, nil
+	case "random":
+		return RAMRandom, nil
+	}
+	return RAMZeros, fmt.Errorf("unknown ram pattern %q, use zeros, ff or random", name)
+}
+
+// RAMInit fills ram with a pattern, the random pattern carries on from one fill to the next
+// so every chip gets different bytes from the same seed
+type RAMInit struct {
+	Pattern RAMPattern
+	rng     *rand.Rand
+}
+
+func createRAMInit(pattern RAMPattern, seed int64) *RAMInit {
+	ramInit := &RAMInit{Pattern: pattern}
+	if pattern == RAMRandom {
+		ramInit.rng = rand.New(rand.NewSource(seed))
+	}
+	return ramInit
+}
+
+func (ramInit *RAMInit) fill(ram []uint8) {
+	switch ramInit.Pattern {
+	case RAMRandom:
+		ramInit.rng.Read(ram)
+	case RAMOnes:
+		for i := range ram {
+			ram[i] = 0xFF
+		}
+	default:
+		for i := range ram {
+			ram[i] = 0
+		}
+	}
+}
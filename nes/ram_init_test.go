@@ -0,0 +1,66 @@
+package nes
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseRAMPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern RAMPattern
+		ok      bool
+	}{
+		{"zeros", RAMZeros, true},
+		{"00", RAMZeros, true},
+		{"FF", RAMOnes, true},
+		{"ones", RAMOnes, true},
+		{"Random", RAMRandom, true},
+		{"", RAMZeros, false},
+		{"55", RAMZeros, false},
+	}
+	for _, test := range tests {
+		pattern, err := ParseRAMPattern(test.name)
+		if pattern != test.pattern || (err == nil) != test.ok {
+			t.Errorf("%q parsed as %v, %v", test.name, pattern, err)
+		}
+		if err == nil {
+			if again, _ := ParseRAMPattern(pattern.String()); again != pattern {
+				t.Errorf("%v's name parses as %v", pattern, again)
+			}
+		}
+	}
+}
+
+// powerOnRAM powers on a system with a pattern and seed and returns its internal ram and cartridge ram
+func powerOnRAM(t *testing.T, pattern RAMPattern, seed int64) ([]byte, []byte) {
+	system := createTestConsole(t, stateTestProgram).System
+	system.RAMPattern = pattern
+	system.RAMSeed = seed
+	system.PowerOn()
+	return append([]byte(nil), system.Memory...), append([]byte(nil), system.Cart.PRGRam...)
+}
+
+func TestPowerOnRAM(t *testing.T) {
+	for _, test := range []struct {
+		pattern RAMPattern
+		value   byte
+	}{{RAMZeros, 0x00}, {RAMOnes, 0xFF}} {
+		ram, prgRAM := powerOnRAM(t, test.pattern, 1)
+		if !bytes.Equal(ram, bytes.Repeat([]byte{test.value}, len(ram))) || !bytes.Equal(prgRAM, bytes.Repeat([]byte{test.value}, len(prgRAM))) {
+			t.Errorf("%v didn't fill ram with $%02X", test.pattern, test.value)
+		}
+	}
+
+	ram, prgRAM := powerOnRAM(t, RAMRandom, 1)
+	again, prgAgain := powerOnRAM(t, RAMRandom, 1)
+	if !bytes.Equal(ram, again) || !bytes.Equal(prgRAM, prgAgain) {
+		t.Error("powering on twice with the same seed gave different ram")
+	}
+	if bytes.Equal(ram, prgRAM[:len(ram)]) {
+		t.Error("internal ram and cartridge ram got the same random bytes")
+	}
+	if other, _ := powerOnRAM(t, RAMRandom, 2); bytes.Equal(ram, other) {
+		t.Error("different seeds gave the same ram")
+	}
+}
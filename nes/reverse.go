@@ -0,0 +1,95 @@
+package nes
+
+import "fmt"
+
+/*
+Reverse Execution
+the console can't run backwards, instead it loads the closest rewind snapshot before the current cycle
+and runs forward again. The whole machine is in the snapshot so running it again does exactly the same thing.
+Snapshots are only saved once a frame so rewind has to be enabled and at least one frame run
+*/
+
+// ErrNoReverseHistory is returned when the console was rewound to its oldest snapshot without finding what it was looking for
+var ErrNoReverseHistory = fmt.Errorf("no more reverse-execution history")
+
+// ReverseStep goes back to the start of the instruction before the current one
+func (console *Console) ReverseStep() error {
+	return console.ReverseUntil(func(console *Console) bool { return true })
+}
+
+// ReverseUntil goes back to the last instruction boundary before the current cycle where predicate returns true.
+// If predicate is never true the console is left at its oldest snapshot and ErrNoReverseHistory is returned
+func (console *Console) ReverseUntil(predicate func(console *Console) bool) error {
+	buffer := console.rewind
+	if buffer == nil {
+		return fmt.Errorf("couldn't reverse, rewind isn't enabled")
+	}
+	//snapshots saved while running again would end up after the newest one
+	console.rewind = nil
+	defer func() { console.rewind = buffer }()
+
+	end := console.MasterCycles
+	oldest := len(buffer.snapshots) - 1
+	for i := len(buffer.snapshots) - 1; i >= 0; i-- {
+		if buffer.snapshots[i].cycles >= end {
+			if oldest != i {
+				break //the console was power cycled or had a state loaded, history stops here
+			}
+			oldest--
+			continue
+		}
+		oldest = i
+		hit, found, err := buffer.search(console, i, end, predicate)
+		if err != nil {
+			return err
+		}
+		if found {
+			if err := buffer.replay(console, i, hit); err != nil {
+				return err
+			}
+			buffer.truncate(i)
+			return nil
+		}
+		end = buffer.snapshots[i].cycles
+	}
+	if oldest < 0 {
+		return ErrNoReverseHistory
+	}
+	if err := buffer.load(console, oldest); err != nil {
+		return err
+	}
+	buffer.truncate(oldest)
+	return ErrNoReverseHistory
+}
+
+// search runs from snapshot i until end and returns the last instruction boundary predicate was true at
+func (buffer *rewindBuffer) search(console *Console, i int, end uint64, predicate func(console *Console) bool) (uint64, bool, error) {
+	if err := buffer.load(console, i); err != nil {
+		return 0, false, err
+	}
+	var hit uint64
+	found := false
+	for console.MasterCycles < end {
+		if predicate(console) {
+			hit = console.MasterCycles
+			found = true
+		}
+		if _, err := console.Step(); err != nil {
+			break //halted, nothing after this can be stepped to
+		}
+	}
+	return hit, found, nil
+}
+
+// replay runs from snapshot i until the master clock reaches cycles
+func (buffer *rewindBuffer) replay(console *Console, i int, cycles uint64) error {
+	if err := buffer.load(console, i); err != nil {
+		return err
+	}
+	for console.MasterCycles < cycles {
+		if _, err := console.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package nes
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestReverseStep(t *testing.T) {
+	console := createTestConsole(t, stateTestProgram)
+	console.EnableRewind(64 << 20)
+	runFrames(t, console, 5)
+
+	//save the state before each instruction, stepping back has to go through them in reverse.
+	//runs 100 instructions into frame 6 so stepping back crosses into the previous snapshot
+	var states [][]byte
+	for frame6 := 0; frame6 < 100; {
+		states = append(states, saveState(t, console))
+		if _, err := console.Step(); err != nil {
+			t.Fatal(err)
+		}
+		if console.Frame() == 6 {
+			frame6++
+		}
+	}
+	for i := len(states) - 1; i >= len(states)-300; i-- {
+		if err := console.ReverseStep(); err != nil {
+			t.Fatalf("step back to instruction %d: %s", i, err)
+		}
+		if !bytes.Equal(saveState(t, console), states[i]) {
+			t.Fatalf("stepping back to instruction %d gave a different state", i)
+		}
+	}
+}
+
+func TestReverseUntil(t *testing.T) {
+	console := createTestConsole(t, stateTestProgram)
+	console.EnableRewind(64 << 20)
+	runFrames(t, console, 5)
+	atINC := func(console *Console) bool { return console.System.CPU.PC == 0x8016 } //INC $01
+
+	var expected []byte
+	for console.Frame() < 8 {
+		if atINC(console) {
+			expected = saveState(t, console)
+		}
+		if _, err := console.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if expected == nil {
+		t.Fatal("program never reached INC $01")
+	}
+	if err := console.ReverseUntil(atINC); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(saveState(t, console), expected) {
+		t.Errorf("reversed to PC $%04X, not the last INC $01", console.System.CPU.PC)
+	}
+
+	never := func(console *Console) bool { return false }
+	if err := console.ReverseUntil(never); !errors.Is(err, ErrNoReverseHistory) {
+		t.Errorf("reversing without a hit returned %v", err)
+	}
+	if console.MasterCycles != console.rewind.snapshots[0].cycles {
+		t.Errorf("reversing without a hit didn't stop at the oldest snapshot")
+	}
+}
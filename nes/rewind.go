@@ -0,0 +1,227 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+/*
+Rewind
+the console saves its state at the start of every frame (on the first instruction boundary of the frame).
+Every rewindKeyframeInterval frames the whole state is kept (a keyframe),
+the frames in between only keep the XOR of their state with the previous frame's, run length encoded.
+Most of the machine doesn't change from one frame to the next so a delta is usually a few hundred bytes.
+When the snapshots go over the memory budget the oldest keyframe and its deltas are dropped
+*/
+
+const rewindKeyframeInterval = 60 //a keyframe every second of NTSC frames
+
+// rewindSnapshot is one frame's state, a full state for keyframes and an encoded delta otherwise
+type rewindSnapshot struct {
+	frame    uint64
+	cycles   uint64 //MasterCycles when the snapshot was saved
+	keyframe bool
+	data     []byte
+}
+
+// rewindBuffer is the console's saved frames, oldest first
+type rewindBuffer struct {
+	budget    int //bytes the snapshots can use
+	size      int //bytes the snapshots use
+	snapshots []rewindSnapshot
+	last      []byte //full state of the newest snapshot, deltas are taken against it
+	scratch   bytes.Buffer
+}
+
+// EnableRewind starts saving a snapshot every frame, budget is the bytes the snapshots can use
+func (console *Console) EnableRewind(budget int) {
+	console.rewind = &rewindBuffer{budget: budget}
+	console.saveRewindFrame()
+}
+
+// DisableRewind stops saving snapshots and frees the ones saved
+func (console *Console) DisableRewind() {
+	console.rewind = nil
+}
+
+// RewindFrames returns the number of frames that can be rewound, 0 if rewind isn't enabled
+func (console *Console) RewindFrames() int {
+	if console.rewind == nil {
+		return 0
+	}
+	first, last := console.rewind.history(console.MasterCycles)
+	return last - first + 1
+}
+
+// Rewind goes back to the start of the frame frames-1 frames before the current one, 1 is the start of the current frame.
+// Goes to the closest saved frame before that if it wasn't saved and to the oldest if there aren't enough frames saved.
+// Like ReverseUntil it doesn't go back past a power cycle or a loaded state
+func (console *Console) Rewind(frames int) error {
+	buffer := console.rewind
+	if buffer == nil {
+		return fmt.Errorf("couldn't rewind, rewind isn't enabled")
+	}
+	if frames < 1 {
+		return fmt.Errorf("couldn't rewind, invalid frame count %d", frames)
+	}
+	first, last := buffer.history(console.MasterCycles)
+	if last < 0 {
+		return fmt.Errorf("couldn't rewind, no frames were saved since the console was power cycled or had a state loaded")
+	}
+	target := first
+	if frame := console.Frame(); uint64(frames) <= frame {
+		for i := last; i >= first; i-- {
+			if buffer.snapshots[i].frame <= frame-uint64(frames-1) {
+				target = i
+				break
+			}
+		}
+	}
+	if err := buffer.load(console, target); err != nil {
+		return err
+	}
+	buffer.truncate(target)
+	return nil
+}
+
+// history returns the snapshots that lead up to cycle now, first to last, last is -1 if there are none.
+// Snapshots saved after now and the ones before a drop in cycles were saved before the console
+// was power cycled or had a state loaded, ReverseUntil stops at the same place
+func (buffer *rewindBuffer) history(now uint64) (first, last int) {
+	snapshots := buffer.snapshots
+	last = len(snapshots) - 1
+	//the newest snapshot can be the current frame's, saved on this cycle
+	if last >= 0 && snapshots[last].cycles > now {
+		for last >= 0 && snapshots[last].cycles >= now {
+			last--
+		}
+	}
+	first = last
+	for first > 0 && snapshots[first-1].cycles < snapshots[first].cycles {
+		first--
+	}
+	return first, last
+}
+
+// load loads snapshot i into console, the snapshots are left alone
+func (buffer *rewindBuffer) load(console *Console, i int) error {
+	return console.LoadState(bytes.NewReader(buffer.state(i)))
+}
+
+// truncate throws away the snapshots after snapshot i, running again saves new ones
+func (buffer *rewindBuffer) truncate(i int) {
+	if i == len(buffer.snapshots)-1 {
+		return
+	}
+	for _, snapshot := range buffer.snapshots[i+1:] {
+		buffer.size -= len(snapshot.data)
+	}
+	buffer.snapshots = buffer.snapshots[:i+1]
+	buffer.last = buffer.state(i)
+}
+
+// saveRewindFrame saves a snapshot of the console into the rewind buffer
+func (console *Console) saveRewindFrame() {
+	buffer := console.rewind
+	buffer.scratch.Reset()
+	console.SaveState(&buffer.scratch) //writing to a bytes.Buffer can't fail
+	state := buffer.scratch.Bytes()
+
+	snapshot := rewindSnapshot{frame: console.Frame(), cycles: console.MasterCycles, keyframe: len(buffer.last) != len(state) || buffer.sinceKeyframe() >= rewindKeyframeInterval-1}
+	if snapshot.keyframe {
+		snapshot.data = append([]byte(nil), state...)
+	} else {
+		snapshot.data = encodeDelta(buffer.last, state)
+	}
+	buffer.last = append(buffer.last[:0], state...)
+	buffer.snapshots = append(buffer.snapshots, snapshot)
+	buffer.size += len(snapshot.data)
+	buffer.trim()
+}
+
+// savedFrame reports if the frame the console is in has a snapshot
+func (buffer *rewindBuffer) savedFrame(frame uint64) bool {
+	return len(buffer.snapshots) > 0 && buffer.snapshots[len(buffer.snapshots)-1].frame == frame
+}
+
+// sinceKeyframe returns the number of deltas after the newest keyframe
+func (buffer *rewindBuffer) sinceKeyframe() int {
+	deltas := 0
+	for i := len(buffer.snapshots) - 1; i >= 0 && !buffer.snapshots[i].keyframe; i-- {
+		deltas++
+	}
+	return deltas
+}
+
+// trim drops the oldest keyframe and its deltas until the snapshots fit the budget,
+// the newest keyframe is always kept
+func (buffer *rewindBuffer) trim() {
+	for buffer.size > buffer.budget {
+		next := 1
+		for next < len(buffer.snapshots) && !buffer.snapshots[next].keyframe {
+			next++
+		}
+		if next == len(buffer.snapshots) {
+			return
+		}
+		for _, snapshot := range buffer.snapshots[:next] {
+			buffer.size -= len(snapshot.data)
+		}
+		buffer.snapshots = append(buffer.snapshots[:0], buffer.snapshots[next:]...)
+	}
+}
+
+// state rebuilds the full state of snapshot i from its keyframe
+func (buffer *rewindBuffer) state(i int) []byte {
+	keyframe := i
+	for !buffer.snapshots[keyframe].keyframe {
+		keyframe--
+	}
+	state := append([]byte(nil), buffer.snapshots[keyframe].data...)
+	for _, snapshot := range buffer.snapshots[keyframe+1 : i+1] {
+		applyDelta(state, snapshot.data)
+	}
+	return state
+}
+
+// encodeDelta XORs two states of the same length and run length encodes the result
+// as pairs of (unchanged byte count, changed byte count) uvarints, each followed by the changed bytes XORed
+func encodeDelta(from, to []byte) []byte {
+	var delta []byte
+	var count [binary.MaxVarintLen64]byte
+	for i := 0; i < len(to); {
+		start := i
+		for i < len(to) && from[i] == to[i] {
+			i++
+		}
+		unchanged := i - start
+		start = i
+		for i < len(to) && from[i] != to[i] {
+			i++
+		}
+		delta = append(delta, count[:binary.PutUvarint(count[:], uint64(unchanged))]...)
+		delta = append(delta, count[:binary.PutUvarint(count[:], uint64(i-start))]...)
+		for j := start; j < i; j++ {
+			delta = append(delta, from[j]^to[j])
+		}
+	}
+	return delta
+}
+
+// applyDelta turns the state a delta was taken against into the state it was taken of
+func applyDelta(state []byte, delta []byte) {
+	pos := 0
+	for len(delta) > 0 {
+		unchanged, n := binary.Uvarint(delta)
+		delta = delta[n:]
+		changed, n := binary.Uvarint(delta)
+		delta = delta[n:]
+		pos += int(unchanged)
+		for j := 0; j < int(changed); j++ {
+			state[pos+j] ^= delta[j]
+		}
+		pos += int(changed)
+		delta = delta[changed:]
+	}
+}
@@ -0,0 +1,135 @@
+package nes
+
+import (
+	"bytes"
+	"testing"
+)
+
+func runFrames(t *testing.T, console *Console, frames int) {
+	for i := 0; i < frames; i++ {
+		if err := console.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func saveState(t *testing.T, console *Console) []byte {
+	var state bytes.Buffer
+	if err := console.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	return state.Bytes()
+}
+
+func TestRewind(t *testing.T) {
+	console := createTestConsole(t, stateTestProgram)
+	console.EnableRewind(64 << 20)
+	runFrames(t, console, 150)
+	frame := console.Frame()
+
+	//back across a couple of keyframes
+	if err := console.Rewind(100); err != nil {
+		t.Fatal(err)
+	}
+	if console.Frame() != frame-99 {
+		t.Fatalf("rewound to frame %d, expected frame %d", console.Frame(), frame-99)
+	}
+	start := saveState(t, console)
+	runFrames(t, console, 3)
+	expected := saveState(t, console)
+
+	//rewinding to the same frame and running again has to end in the same state
+	if err := console.Rewind(4); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(saveState(t, console), start) {
+		t.Fatal("rewinding twice to the same frame gave different states")
+	}
+	runFrames(t, console, 3)
+	if !bytes.Equal(saveState(t, console), expected) {
+		t.Error("running again after rewinding ended in a different state")
+	}
+}
+
+func TestRewindBudget(t *testing.T) {
+	console := createTestConsole(t, stateTestProgram)
+	stateSize := len(saveState(t, console))
+	budget := 3 * stateSize
+	console.EnableRewind(budget)
+	runFrames(t, console, 600)
+	if size := console.rewind.size; size > budget {
+		t.Errorf("snapshots use %d bytes, budget is %d", size, budget)
+	}
+	frames := console.RewindFrames()
+	if frames == 0 || frames >= 600 {
+		t.Errorf("%d frames kept", frames)
+	}
+	if err := console.Rewind(frames + 10); err != nil {
+		t.Fatal(err)
+	}
+	if console.RewindFrames() != 1 {
+		t.Errorf("%d frames kept after rewinding to the oldest", console.RewindFrames())
+	}
+}
+
+func TestRewindStopsAtPowerCycle(t *testing.T) {
+	console := createTestConsole(t, stateTestProgram)
+	console.EnableRewind(64 << 20)
+	runFrames(t, console, 20)
+	saved := saveState(t, console)
+	runFrames(t, console, 80)
+
+	//loading a state from earlier on starts a new history at the loaded frame
+	if err := console.LoadState(bytes.NewReader(saved)); err != nil {
+		t.Fatal(err)
+	}
+	runFrames(t, console, 5)
+	if err := console.Rewind(3); err != nil {
+		t.Fatal(err)
+	}
+	if console.Frame() != 23 {
+		t.Errorf("rewound to frame %d after loading frame 20, expected 23", console.Frame())
+	}
+	if err := console.Rewind(50); err != nil {
+		t.Fatal(err)
+	}
+	if console.Frame() != 20 || console.RewindFrames() != 1 {
+		t.Errorf("rewound to frame %d with %d frames left, expected the loaded frame", console.Frame(), console.RewindFrames())
+	}
+	before := len(console.rewind.snapshots)
+
+	console.PowerCycle()
+	if err := console.Rewind(1); err == nil {
+		t.Error("rewinding before a frame was saved since the power cycle didn't fail")
+	}
+	runFrames(t, console, 10)
+	if frames := console.RewindFrames(); frames != 10 {
+		t.Errorf("%d frames can be rewound 10 frames after a power cycle, expected 10", frames)
+	}
+	if err := console.Rewind(50); err != nil {
+		t.Fatal(err)
+	}
+	//the oldest frame since the power cycle, the frames before it are kept but can't be rewound to
+	if console.Frame() != 0 || len(console.rewind.snapshots) != before+1 || console.RewindFrames() != 1 {
+		t.Errorf("rewound to frame %d, %d of %d snapshots left", console.Frame(), len(console.rewind.snapshots), before+1)
+	}
+}
+
+func TestDelta(t *testing.T) {
+	from := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	to := []byte{1, 9, 9, 4, 5, 6, 7, 0}
+	state := append([]byte(nil), from...)
+	applyDelta(state, encodeDelta(from, to))
+	if !bytes.Equal(state, to) {
+		t.Errorf("delta applied gives %v, expected %v", state, to)
+	}
+}
+
+func BenchmarkRewindFrame(b *testing.B) {
+	console := createTestConsole(b, stateTestProgram)
+	console.EnableRewind(64 << 20)
+	for i := 0; i < b.N; i++ {
+		console.RunCycles(100)
+		console.saveRewindFrame()
+	}
+}
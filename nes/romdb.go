@@ -0,0 +1,181 @@
+package nes
+
+import (
+	_ "embed"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// romDBXML is a stub of the NES 2.0 XML database with only a couple of games,
+// the full nes20db.xml can be dropped in its place
+//
+//go:embed romdb.xml
+var romDBXML []byte
+
+// RomDBEntry is a game from the embedded rom database
+// the values replace whatever the rom's header claims
+type RomDBEntry struct {
+	Name         string
+	CRC32        uint32   // CRC32 of PRG Rom + CHR Rom
+	SHA1         [20]byte // SHA-1 of PRG Rom + CHR Rom
+	MapperNumber uint16
+	Submapper    uint8
+	Mirroring    string // H, V or 4
+	HasBattery   bool
+	PRGRamSize   int // volatile and battery backed PRG Ram combined, in bytes
+	CHRRamSize   int // in bytes
+	Region       Region
+}
+
+// xml layout of the database, mirrors nes20db.xml
+type romDBFile struct {
+	Games []romDBGame `xml:"game"`
+}
+type romDBGame struct {
+	Comment  string     `xml:",comment"`
+	Rom      romDBChunk `xml:"rom"`
+	PRGRam   romDBChunk `xml:"prgram"`
+	PRGNVRam romDBChunk `xml:"prgnvram"`
+	CHRRam   romDBChunk `xml:"chrram"`
+	PCB      struct {
+		Mapper    uint16 `xml:"mapper,attr"`
+		Submapper uint8  `xml:"submapper,attr"`
+		Mirroring string `xml:"mirroring,attr"`
+		Battery   uint8  `xml:"battery,attr"`
+	} `xml:"pcb"`
+	Console struct {
+		Region uint8 `xml:"region,attr"`
+	} `xml:"console"`
+}
+type romDBChunk struct {
+	Size  int    `xml:"size,attr"`
+	CRC32 string `xml:"crc32,attr"`
+	SHA1  string `xml:"sha1,attr"`
+}
+
+var (
+	romDBOnce  sync.Once
+	romDB      map[uint32][]*RomDBEntry // entries keyed by CRC32, multiple entries can share a CRC32
+	romDBError error
+)
+
+// loadRomDB parses the embedded database the first time it is needed
+func loadRomDB() {
+	var file romDBFile
+	if err := xml.Unmarshal(romDBXML, &file); err != nil {
+		romDBError = fmt.Errorf("can't parse rom database, %s", err)
+		return
+	}
+	romDB = make(map[uint32][]*RomDBEntry)
+	for i, game := range file.Games {
+		crc, err := strconv.ParseUint(game.Rom.CRC32, 16, 32)
+		if err != nil {
+			romDBError = fmt.Errorf("rom database game %d has an invalid crc32 %q", i, game.Rom.CRC32)
+			return
+		}
+		entry := &RomDBEntry{
+			Name:         strings.TrimSpace(game.Comment),
+			CRC32:        uint32(crc),
+			MapperNumber: game.PCB.Mapper,
+			Submapper:    game.PCB.Submapper,
+			Mirroring:    game.PCB.Mirroring,
+			HasBattery:   game.PCB.Battery != 0,
+			PRGRamSize:   game.PRGRam.Size + game.PRGNVRam.Size,
+			CHRRamSize:   game.CHRRam.Size,
+			Region:       Region(game.Console.Region),
+		}
+		if game.Rom.SHA1 != "" {
+			sha, err := hex.DecodeString(game.Rom.SHA1)
+			if err != nil || len(sha) != len(entry.SHA1) {
+				romDBError = fmt.Errorf("rom database game %d has an invalid sha1 %q", i, game.Rom.SHA1)
+				return
+			}
+			copy(entry.SHA1[:], sha)
+		}
+		romDB[entry.CRC32] = append(romDB[entry.CRC32], entry)
+	}
+}
+
+// LookupRom finds a game in the embedded rom database by the CRC32
+// and SHA-1 of its PRG Rom + CHR Rom. The SHA-1 is used to tell apart
+// games that share a CRC32
+func LookupRom(crc uint32, sha [20]byte) (*RomDBEntry, error) {
+	romDBOnce.Do(loadRomDB)
+	if romDBError != nil {
+		return nil, romDBError
+	}
+	for _, entry := range romDB[crc] {
+		if entry.SHA1 == [20]byte{} || entry.SHA1 == sha {
+			return entry, nil
+		}
+	}
+	return nil, nil
+}
+
+// applyRomDB looks the cartridge up in the rom database and replaces any header
+// values that disagree with the database entry, recording each change in cart.Overrides
+func (cart *Cartridge) applyRomDB() error {
+	entry, err := LookupRom(cart.CRC32, cart.SHA1)
+	if err != nil || entry == nil {
+		return err
+	}
+	cart.DBEntry = entry
+	if entry.MapperNumber != cart.MapperNumber {
+		cart.override("mapper", cart.MapperNumber, entry.MapperNumber)
+		cart.MapperNumber = entry.MapperNumber
+	}
+	if entry.Submapper != cart.Submapper {
+		cart.override("submapper", cart.Submapper, entry.Submapper)
+		cart.Submapper = entry.Submapper
+	}
+	switch entry.Mirroring {
+	case "H", "V":
+		if vertical := entry.Mirroring == "V"; vertical != cart.MirrorVertically || cart.IgnoreMirrorControl {
+			cart.override("mirroring", cart.mirroringName(), entry.Mirroring)
+			cart.MirrorVertically = vertical
+			cart.IgnoreMirrorControl = false
+		}
+	case "4":
+		if !cart.IgnoreMirrorControl {
+			cart.override("mirroring", cart.mirroringName(), entry.Mirroring)
+			cart.IgnoreMirrorControl = true
+		}
+	}
+	if entry.HasBattery != cart.HasBatteryRam {
+		cart.override("battery", cart.HasBatteryRam, entry.HasBattery)
+		cart.HasBatteryRam = entry.HasBattery
+	}
+	if entry.PRGRamSize != cart.PRGRamSize {
+		cart.override("PRG Ram size", cart.PRGRamSize, entry.PRGRamSize)
+		cart.PRGRamSize = entry.PRGRamSize
+	}
+	if entry.CHRRamSize != cart.CHRRamSize && cart.CHRRomSize == 0 {
+		cart.override("CHR Ram size", cart.CHRRamSize, entry.CHRRamSize)
+		cart.CHRRamSize = entry.CHRRamSize
+	}
+	if entry.Region != cart.Region {
+		cart.override("region", cart.Region, entry.Region)
+		cart.Region = entry.Region
+	}
+	return nil
+}
+
+// override records that the rom database changed field from old to new
+func (cart *Cartridge) override(field string, old interface{}, new interface{}) {
+	cart.Overrides = append(cart.Overrides, fmt.Sprintf("%s %v -> %v", field, old, new))
+}
+
+// mirroringName returns the header mirroring using the database's letters
+func (cart *Cartridge) mirroringName() string {
+	if cart.IgnoreMirrorControl {
+		return "4"
+	}
+	if cart.MirrorVertically {
+		return "V"
+	}
+	return "H"
+}
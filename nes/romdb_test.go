@@ -0,0 +1,53 @@
+package nes
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRomDBCorrectsHeader(t *testing.T) {
+	rom, err := os.ReadFile("../roms/super_mario.nes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rom[6] = 0x32 //mapper 3, horizontal mirroring and a battery instead of NROM, vertical and no battery
+	cart, err := CreateCartFromBytes(rom)
+	if err != nil {
+		t.Fatal(err) //mapper 3 isn't supported, the database has to correct it before the mapper is loaded
+	}
+	if cart.DBEntry == nil || cart.DBEntry.Name != "Super Mario Bros. (World)" {
+		t.Fatalf("rom matched database entry %+v", cart.DBEntry)
+	}
+	if cart.MapperNumber != 0 || !cart.MirrorVertically || cart.HasBatteryRam {
+		t.Errorf("corrected header is mapper %d, vertical %t, battery %t", cart.MapperNumber, cart.MirrorVertically, cart.HasBatteryRam)
+	}
+	overrides := strings.Join(cart.Overrides, ", ")
+	for _, expected := range []string{"mapper 3 -> 0", "mirroring H -> V", "battery true -> false"} {
+		if !strings.Contains(overrides, expected) {
+			t.Errorf("overrides %q are missing %q", overrides, expected)
+		}
+	}
+
+	//with the right header only the PRG Ram changes, iNES 1.0 headers can't say the board has none
+	rom[6] = 0x01
+	if cart, err = CreateCartFromBytes(rom); err != nil {
+		t.Fatal(err)
+	}
+	if len(cart.Overrides) != 1 || cart.Overrides[0] != "PRG Ram size 8192 -> 0" {
+		t.Errorf("correct header was overridden with %q", cart.Overrides)
+	}
+}
+
+func TestLookupRomMissing(t *testing.T) {
+	entry, err := LookupRom(0x12345678, [20]byte{})
+	if err != nil || entry != nil {
+		t.Errorf("looking up an unknown rom returned %+v, %v", entry, err)
+	}
+
+	//a matching CRC32 with a different SHA-1 is another game
+	zelda := uint32(0xEAF7ED72)
+	if entry, _ := LookupRom(zelda, [20]byte{1}); entry != nil {
+		t.Errorf("SHA-1 mismatch matched %q", entry.Name)
+	}
+}
@@ -0,0 +1,276 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+/*
+Save States
+a save state is a header followed by every component's fields in a fixed order, little endian.
+header:
+	"NESS" magic
+	uint16 format version, bumped whenever the field order changes
+	[20]byte SHA-1 of the rom the state belongs to (Cartridge.SHA1)
+	uint8 cpu variant
+body: cpu, internal ram, APU, cartridge ram, mapper, master clock
+ints are saved as int64 so the format doesn't depend on the platform
+*/
+
+const (
+	stateMagic   = "NESS"
+	StateVersion = 2
+)
+
+const (
+	stateInterrupt     = 0x100  //the cpu is running the interrupt sequence
+	stateNoInstruction = 0xFFFF //the cpu hasn't fetched an instruction yet
+)
+
+// what cpu.Fault holds in a save state
+const (
+	stateNoFault uint8 = iota
+	stateInvalidOpcode
+	stateStopped
+)
+
+// stateMapper is implemented by mappers with registers that need to be saved
+type stateMapper interface {
+	saveState(w *stateWriter)
+	loadState(r *stateReader)
+}
+
+// stateWriter writes fields, after an error it writes nothing and keeps the first error
+type stateWriter struct {
+	w   io.Writer
+	err error
+}
+
+// write writes fixed size values or pointers to them, *int is written as an int64
+func (w *stateWriter) write(fields ...interface{}) {
+	for _, field := range fields {
+		if w.err != nil {
+			return
+		}
+		if n, ok := field.(*int); ok {
+			field = int64(*n)
+		}
+		w.err = binary.Write(w.w, binary.LittleEndian, field)
+	}
+}
+
+// stateReader reads fields, after an error it reads nothing and keeps the first error
+type stateReader struct {
+	r   io.Reader
+	err error
+}
+
+// read reads into pointers to fixed size values or into slices, *int is read as an int64
+func (r *stateReader) read(fields ...interface{}) {
+	for _, field := range fields {
+		if r.err != nil {
+			return
+		}
+		if n, ok := field.(*int); ok {
+			var value int64
+			r.err = binary.Read(r.r, binary.LittleEndian, &value)
+			*n = int(value)
+			continue
+		}
+		r.err = binary.Read(r.r, binary.LittleEndian, field)
+	}
+}
+
+// stateHeader starts every save state
+type stateHeader struct {
+	Magic   [4]byte
+	Version uint16
+	ROMHash [20]byte
+	Variant CPUVariant
+}
+
+// SaveState writes the whole machine's state to w
+func (console *Console) SaveState(w io.Writer) error {
+	system := console.System
+	header := stateHeader{Version: StateVersion, ROMHash: system.Cart.SHA1, Variant: system.CPU.Variant}
+	copy(header.Magic[:], stateMagic)
+	writer := &stateWriter{w: w}
+	writer.write(&header)
+	system.CPU.saveState(writer)
+	writer.write(system.Memory, &system.openBus)
+	writer.write(system.APU.stateFields()...)
+	system.Cart.saveState(writer)
+	writer.write(&console.MasterCycles)
+	if writer.err != nil {
+		return fmt.Errorf("couldn't save state: %s", writer.err)
+	}
+	return nil
+}
+
+// LoadState restores a state written by SaveState.
+// States saved for a different rom, cpu or format version are refused,
+// if the state can't be read the console is left as it was
+func (console *Console) LoadState(r io.Reader) error {
+	system := console.System
+	var header stateHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("couldn't load state: %s", err)
+	}
+	if string(header.Magic[:]) != stateMagic {
+		return fmt.Errorf("couldn't load state: not a save state")
+	}
+	if header.Version != StateVersion {
+		return fmt.Errorf("couldn't load state: format version %d, this version reads %d", header.Version, StateVersion)
+	}
+	if header.ROMHash != system.Cart.SHA1 {
+		return fmt.Errorf("couldn't load state: it was saved for a different rom (SHA-1 %X, loaded rom is %X)", header.ROMHash, system.Cart.SHA1)
+	}
+	if header.Variant != system.CPU.Variant {
+		return fmt.Errorf("couldn't load state: it was saved with a %s cpu, the console has a %s", header.Variant, system.CPU.Variant)
+	}
+
+	//keep the current state to go back to if the body is cut short
+	var backup bytes.Buffer
+	if err := console.SaveState(&backup); err != nil {
+		return err
+	}
+	if err := console.loadBody(r); err != nil {
+		backup.Next(binary.Size(header))
+		console.loadBody(&backup)
+		return fmt.Errorf("couldn't load state: %s", err)
+	}
+	return nil
+}
+
+// loadBody reads everything after the header
+func (console *Console) loadBody(r io.Reader) error {
+	system := console.System
+	reader := &stateReader{r: r}
+	system.CPU.loadState(reader)
+	reader.read(system.Memory, &system.openBus)
+	reader.read(system.APU.stateFields()...)
+	system.Cart.loadState(reader)
+	reader.read(&console.MasterCycles)
+	return reader.err
+}
+
+// stateFields returns pointers to the cpu's saved fields, the instruction being run and the fault are saved separately
+func (cpu *CPU) stateFields() []interface{} {
+	return []interface{}{
+		&cpu.AC, &cpu.X, &cpu.Y, &cpu.SR, &cpu.SP, &cpu.PC,
+		&cpu.RemCycles, &cpu.Cycles, &cpu.Halted, &cpu.Waiting, &cpu.OperandAddr,
+		&cpu.opcode, &cpu.opcodeAddr, &cpu.cycle, &cpu.expectedCycles, &cpu.finished, &cpu.decimalCycle,
+		&cpu.value, &cpu.pointer, &cpu.baseAddr, &cpu.pageCrossed, &cpu.takeBranch,
+		&cpu.irqLine, &cpu.nmiPending, &cpu.interruptPending, &cpu.lastPoll, &cpu.hardwareIRQ,
+	}
+}
+
+func (cpu *CPU) saveState(w *stateWriter) {
+	w.write(cpu.stateFields()...)
+	//the instruction is saved as its opcode
+	instruction := uint16(stateNoInstruction)
+	if cpu.instruction == &cpu.interruptEntry {
+		instruction = stateInterrupt
+	} else if cpu.instruction != nil {
+		instruction = uint16(cpu.opcode)
+	}
+	w.write(instruction)
+	var fault InvalidOpcodeError
+	faultKind := stateNoFault
+	switch err := cpu.Fault.(type) {
+	case *InvalidOpcodeError:
+		fault = *err
+		faultKind = stateInvalidOpcode
+	case *StoppedError:
+		fault.PC = err.PC
+		faultKind = stateStopped
+	}
+	w.write(faultKind, fault.PC, fault.Opcode)
+}
+
+func (cpu *CPU) loadState(r *stateReader) {
+	r.read(cpu.stateFields()...)
+	var instruction uint16
+	var faultKind uint8
+	var fault InvalidOpcodeError
+	r.read(&instruction, &faultKind, &fault.PC, &fault.Opcode)
+	switch {
+	case instruction == stateInterrupt:
+		cpu.instruction = &cpu.interruptEntry
+	case instruction <= 0xFF:
+		cpu.instruction = &cpu.instructionTable[instruction]
+	default:
+		cpu.instruction = nil
+	}
+	switch faultKind {
+	case stateInvalidOpcode:
+		cpu.Fault = &fault
+	case stateStopped:
+		cpu.Fault = &StoppedError{PC: fault.PC}
+	default:
+		cpu.Fault = nil
+	}
+}
+
+// stateFields returns pointers to the APU's saved fields
+func (apu *APU) stateFields() []interface{} {
+	fields := []interface{}{
+		&apu.frameCycle, &apu.fiveStep, &apu.irqInhibit, &apu.frameIRQ,
+		&apu.evenCycle, &apu.pendingReset, &apu.frameCounterW,
+	}
+	fields = append(fields, apu.Pulse1.stateFields()...)
+	fields = append(fields, apu.Pulse2.stateFields()...)
+	fields = append(fields, apu.Triangle.stateFields()...)
+	fields = append(fields, apu.Noise.stateFields()...)
+	return append(fields, apu.DMC.stateFields()...)
+}
+
+func (env *envelope) stateFields() []interface{} {
+	return []interface{}{&env.start, &env.loop, &env.constant, &env.volume, &env.divider, &env.decay}
+}
+
+func (pulse *pulseChannel) stateFields() []interface{} {
+	fields := []interface{}{
+		&pulse.enabled, &pulse.duty, &pulse.dutyPos, &pulse.timer, &pulse.period, &pulse.length,
+		&pulse.sweepEnabled, &pulse.sweepPeriod, &pulse.sweepNegate, &pulse.sweepShift,
+		&pulse.sweepDivider, &pulse.sweepReload, &pulse.onesComplement, &pulse.noSweep,
+	}
+	return append(fields, pulse.env.stateFields()...)
+}
+
+func (tri *triangleChannel) stateFields() []interface{} {
+	return []interface{}{
+		&tri.enabled, &tri.control, &tri.linearPeriod, &tri.linearCounter, &tri.linearReload,
+		&tri.timer, &tri.period, &tri.length, &tri.step,
+	}
+}
+
+func (noise *noiseChannel) stateFields() []interface{} {
+	fields := []interface{}{&noise.enabled, &noise.mode, &noise.period, &noise.timer, &noise.shift, &noise.length}
+	return append(fields, noise.env.stateFields()...)
+}
+
+func (dmc *dmcChannel) stateFields() []interface{} {
+	return []interface{}{
+		&dmc.enabled, &dmc.irqEnabled, &dmc.loop, &dmc.irq, &dmc.period, &dmc.timer, &dmc.level,
+		&dmc.sampleAddr, &dmc.sampleLength, &dmc.currentAddr, &dmc.bytesLeft, &dmc.buffer,
+		&dmc.bufferFull, &dmc.shift, &dmc.bitsLeft, &dmc.silence, &dmc.lastFetchAddr,
+	}
+}
+
+// saveState writes the cartridge's ram and the mapper's registers
+func (cart *Cartridge) saveState(w *stateWriter) {
+	w.write(cart.PRGRam, cart.CHRRam)
+	if mapper, ok := cart.mapper.(stateMapper); ok {
+		mapper.saveState(w)
+	}
+}
+
+func (cart *Cartridge) loadState(r *stateReader) {
+	r.read(cart.PRGRam, cart.CHRRam)
+	if mapper, ok := cart.mapper.(stateMapper); ok {
+		mapper.loadState(r)
+	}
+}
@@ -0,0 +1,108 @@
+package nes
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// createTestConsole powers on a console running program from $8000 of a 16kb NROM rom
+func createTestConsole(t testing.TB, program []byte) *Console {
+	cart, err := CreateCartFromBytes(createTestROM(program))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return CreateConsoleFromSystem(CreateBusFromCart(cart))
+}
+
+// createTestROM builds a 16kb NROM iNES file with program at $8000, the reset vector points to it
+func createTestROM(program []byte) []byte {
+	rom := make([]byte, 16+16*1024+8*1024)
+	copy(rom, inesMagic)
+	rom[4] = 1 //16kb PRG Rom
+	rom[5] = 1 //8kb CHR Rom
+	prg := rom[16 : 16+16*1024]
+	copy(prg, program)
+	prg[0x3FFC], prg[0x3FFD] = 0x00, 0x80 //reset vector $8000
+	return rom
+}
+
+// counts up $00-$01 forever while playing a square wave
+var stateTestProgram = []byte{
+	0xA9, 0x01, //LDA #$01
+	0x8D, 0x15, 0x40, //STA $4015
+	0xA9, 0xBF, //LDA #$BF
+	0x8D, 0x00, 0x40, //STA $4000
+	0xA9, 0x40, //LDA #$40
+	0x8D, 0x02, 0x40, //STA $4002
+	0x8D, 0x03, 0x40, //STA $4003
+	0xE6, 0x00, //loop: INC $00
+	0xD0, 0xFC, //BNE loop
+	0xE6, 0x01, //INC $01
+	0x4C, 0x12, 0x80, //JMP loop
+}
+
+func TestSaveStateRoundTrip(t *testing.T) {
+	console := createTestConsole(t, stateTestProgram)
+	if err := console.RunCycles(10_001); err != nil { //stop in the middle of an instruction
+		t.Fatal(err)
+	}
+	var state bytes.Buffer
+	if err := console.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	saved := state.Bytes()
+	if err := console.RunCycles(50_000); err != nil {
+		t.Fatal(err)
+	}
+	var expected bytes.Buffer
+	if err := console.SaveState(&expected); err != nil {
+		t.Fatal(err)
+	}
+
+	//running the same cycles again from the loaded state has to end in the same state
+	if err := console.LoadState(bytes.NewReader(saved)); err != nil {
+		t.Fatal(err)
+	}
+	if err := console.RunCycles(50_000); err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err := console.SaveState(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), expected.Bytes()) {
+		t.Errorf("state after loading and running differs from the original run")
+	}
+}
+
+func TestLoadStateDifferentROM(t *testing.T) {
+	console := createTestConsole(t, stateTestProgram)
+	var state bytes.Buffer
+	if err := console.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	other := createTestConsole(t, []byte{0x4C, 0x00, 0x80}) //JMP $8000
+	err := other.LoadState(&state)
+	if err == nil || !strings.Contains(err.Error(), "different rom") {
+		t.Errorf("loading a state for another rom returned %v", err)
+	}
+}
+
+func TestLoadStateTruncated(t *testing.T) {
+	console := createTestConsole(t, stateTestProgram)
+	var state bytes.Buffer
+	if err := console.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	if err := console.RunCycles(1000); err != nil {
+		t.Fatal(err)
+	}
+	before := console.System.CPU.Registers()
+	if err := console.LoadState(bytes.NewReader(state.Bytes()[:state.Len()/2])); err == nil {
+		t.Fatal("loading half a state didn't fail")
+	}
+	if after := console.System.CPU.Registers(); after != before {
+		t.Errorf("failed load changed the registers from %+v to %+v", before, after)
+	}
+}
@@ -0,0 +1,152 @@
+package nes
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+Test ROM runner
+runs accuracy test roms (blargg's instr_test-v5, ppu_vbl_nmi, apu_test, mmc3_test, cpu_interrupts...) headlessly.
+They report through PRG Ram:
+$6000 status: $80 running, $81 reset the system in 100ms, anything else is the result code (0 = passed)
+$6001-$6003: DE B0 61 marks the status as valid
+$6004: zero terminated text the rom printed
+Only NROM roms load (loadMapper only supports mapper 0) and there is no PPU yet,
+so ppu_vbl_nmi and mmc3_test report TestROMError or time out instead of passing
+*/
+
+const (
+	testROMStatusAddr = 0x6000
+	testROMTextAddr   = 0x6004
+	testROMRunning    = 0x80
+	testROMNeedsReset = 0x81
+	testROMResetDelay = 178977 //100ms of ntsc cpu cycles
+)
+
+var testROMSignature = [3]uint8{0xDE, 0xB0, 0x61}
+
+// TestROMOutcome is how a test rom finished
+type TestROMOutcome uint8
+
+const (
+	TestROMPassed   TestROMOutcome = iota //status 0
+	TestROMFailed                         //nonzero status or the cpu halted
+	TestROMTimedOut                       //still running when the time ran out
+	TestROMError                          //the rom couldn't be loaded
+)
+
+func (outcome TestROMOutcome) String() string {
+	switch outcome {
+	case TestROMPassed:
+		return "pass"
+	case TestROMFailed:
+		return "fail"
+	case TestROMTimedOut:
+		return "timeout"
+	}
+	return "error"
+}
+
+// TestROMResult is the result of running a test rom
+type TestROMResult struct {
+	Path    string
+	Outcome TestROMOutcome
+	Code    uint8  //result code the rom wrote to $6000
+	Message string //text the rom wrote at $6004, or why it couldn't run
+	Cycles  uint64 //cpu cycles run
+}
+
+// RunTestROM runs the rom at path until it reports a result through $6000 or maxCycles cpu cycles pass
+func RunTestROM(path string, maxCycles uint64) TestROMResult {
+	result := TestROMResult{Path: path}
+	console, err := CreateBus(path)
+	if err != nil {
+		result.Outcome = TestROMError
+		result.Message = err.Error()
+		return result
+	}
+	cpu := console.CPU
+	console.PowerOn()
+	var resetAt uint64 //cycle the rom asked to be reset at, 0 if it hasn't
+	for cpu.Cycles < maxCycles {
+		if _, err := console.Step(); err != nil {
+			result.Outcome = TestROMFailed
+			result.Message = err.Error()
+			result.Cycles = cpu.Cycles
+			return result
+		}
+		if !console.hasTestROMSignature() {
+			continue
+		}
+		status := console.PeekCPUByte(testROMStatusAddr)
+		if status == testROMRunning {
+			continue
+		}
+		if status == testROMNeedsReset {
+			if resetAt == 0 {
+				resetAt = cpu.Cycles + testROMResetDelay
+			} else if cpu.Cycles >= resetAt {
+				console.Reset()
+				resetAt = 0
+			}
+			continue
+		}
+		result.Code = status
+		result.Outcome = TestROMFailed
+		if status == 0 {
+			result.Outcome = TestROMPassed
+		}
+		result.Message = console.testROMText()
+		result.Cycles = cpu.Cycles
+		return result
+	}
+	result.Outcome = TestROMTimedOut
+	result.Message = console.testROMText()
+	result.Cycles = cpu.Cycles
+	return result
+}
+
+// hasTestROMSignature returns true once the rom has marked $6000 as a valid status
+func (bus *NesSystem) hasTestROMSignature() bool {
+	for i, value := range testROMSignature {
+		if bus.PeekCPUByte(testROMStatusAddr+1+uint16(i)) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// testROMText reads the zero terminated text at $6004
+func (bus *NesSystem) testROMText() string {
+	if !bus.hasTestROMSignature() {
+		return ""
+	}
+	var text []byte
+	for addr := uint16(testROMTextAddr); addr <= 0x7FFF; addr++ {
+		value := bus.PeekCPUByte(addr)
+		if value == 0 {
+			break
+		}
+		text = append(text, value)
+	}
+	return strings.TrimSpace(string(text))
+}
+
+// FindTestROMs returns every .nes file in dir and its subdirectories, sorted by path
+func FindTestROMs(dir string) ([]string, error) {
+	var roms []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(path), ".nes") {
+			roms = append(roms, path)
+		}
+		return nil
+	})
+	sort.Strings(roms)
+	return roms, err
+}
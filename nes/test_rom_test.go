@@ -0,0 +1,114 @@
+package nes
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+runs every test rom under TEST_ROMS_DIR with RunTestROM, the roms aren't in the repo:
+	TEST_ROMS_DIR=~/nes-test-roms/instr_test-v5 go test ./nes -run TestROMs
+*/
+
+const testROMTimeout = uint64(ntscClockRate * 60) //a minute of emulated time
+
+func TestROMs(t *testing.T) {
+	dir := os.Getenv("TEST_ROMS_DIR")
+	if dir == "" {
+		t.Skip("TEST_ROMS_DIR not set")
+	}
+	roms, err := FindTestROMs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roms) == 0 {
+		t.Fatalf("no .nes files in %s", dir)
+	}
+	for _, rom := range roms {
+		rom := rom
+		name, _ := filepath.Rel(dir, rom)
+		t.Run(name, func(t *testing.T) {
+			result := RunTestROM(rom, testROMTimeout)
+			if result.Outcome != TestROMPassed {
+				t.Errorf("%s (code %d): %s", result.Outcome, result.Code, result.Message)
+			}
+		})
+	}
+}
+
+// testROMStores assembles LDA #value, STA addr for each value, storing them from addr up
+func testROMStores(addr uint16, values ...uint8) []byte {
+	var code []byte
+	for i, value := range values {
+		target := addr + uint16(i)
+		code = append(code, 0xA9, value, 0x8D, uint8(target), uint8(target>>8))
+	}
+	return code
+}
+
+// testROMReport stores a status, the signature and text the way blargg's roms do
+func testROMReport(status uint8, text string) []byte {
+	code := testROMStores(testROMStatusAddr, testROMRunning)
+	code = append(code, testROMStores(testROMStatusAddr+1, testROMSignature[:]...)...)
+	code = append(code, testROMStores(testROMTextAddr, append([]byte(text), 0)...)...)
+	return append(code, testROMStores(testROMStatusAddr, status)...)
+}
+
+// testROMLoop appends JMP to itself, code starts at $8000
+func testROMLoop(code []byte) []byte {
+	addr := 0x8000 + len(code)
+	return append(code, 0x4C, uint8(addr), uint8(addr>>8))
+}
+
+// writeTestROM saves program as an NROM rom in a temporary directory
+func writeTestROM(t *testing.T, program []byte) string {
+	path := filepath.Join(t.TempDir(), "test.nes")
+	if err := os.WriteFile(path, createTestROM(program), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunTestROM(t *testing.T) {
+	//reports $81 on the first run and passes after the reset, $7000 survives it
+	resetROM := []byte{0xAD, 0x00, 0x70, 0xD0, 0x00} //LDA $7000, BNE to the second run
+	resetROM = append(resetROM, testROMStores(0x7000, 1)...)
+	resetROM = testROMLoop(append(resetROM, testROMReport(testROMNeedsReset, "")...))
+	resetROM[4] = uint8(len(resetROM) - 5)
+	resetROM = testROMLoop(append(resetROM, testROMReport(0, "Passed after reset\n")...))
+
+	tests := []struct {
+		name    string
+		program []byte
+		outcome TestROMOutcome
+		code    uint8
+		message string
+	}{
+		{"passed", testROMLoop(testROMReport(0, "\nAll 3 tests passed\n\n")), TestROMPassed, 0, "All 3 tests passed"},
+		{"failed", testROMLoop(testROMReport(2, "Failed #2")), TestROMFailed, 2, "Failed #2"},
+		{"running", testROMLoop(testROMReport(testROMRunning, "Testing")), TestROMTimedOut, 0, "Testing"},
+		{"no signature", testROMLoop(testROMStores(testROMStatusAddr, 0, 0xDE, 0xB0, 0x60)), TestROMTimedOut, 0, ""},
+		{"reset", resetROM, TestROMPassed, 0, "Passed after reset"},
+		{"halted", []byte{0x02}, TestROMFailed, 0, "invalid opcode"},
+	}
+	for _, test := range tests {
+		result := RunTestROM(writeTestROM(t, test.program), 2*testROMResetDelay)
+		if result.Outcome != test.outcome || result.Code != test.code || !strings.Contains(result.Message, test.message) {
+			t.Errorf("%s: returned %s (code %d) %q, expected %s (code %d) %q",
+				test.name, result.Outcome, result.Code, result.Message, test.outcome, test.code, test.message)
+		}
+		if test.outcome == TestROMTimedOut && result.Cycles < 2*testROMResetDelay {
+			t.Errorf("%s: timed out after %d cycles", test.name, result.Cycles)
+		}
+		if test.name == "reset" && result.Cycles < testROMResetDelay {
+			t.Errorf("reset: passed after %d cycles, before the reset was due", result.Cycles)
+		}
+	}
+
+	result := RunTestROM(filepath.Join(t.TempDir(), "missing.nes"), 1000)
+	if result.Outcome != TestROMError || result.Message == "" {
+		t.Errorf("missing rom returned %s %q", result.Outcome, result.Message)
+	}
+}
@@ -0,0 +1,126 @@
+package nes
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+const binaryTestMaxCycles = 10_000
+
+// hexNumber is a number written as a string in a manifest (EX: "0x4020")
+type hexNumber uint16
+
+func (n *hexNumber) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	value, err := strconv.ParseUint(text, 0, 16)
+	if err != nil {
+		return fmt.Errorf("invalid number %q: %s", text, err)
+	}
+	*n = hexNumber(value)
+	return nil
+}
+
+// binaryTest is an entry of a TestBinary manifest.json
+// the binary is loaded at Load and run from Start (the reset vector if left out) until PC reaches End
+type binaryTest struct {
+	Binary    string               `json:"binary"`
+	Load      hexNumber            `json:"load"`
+	Start     hexNumber            `json:"start"`
+	End       hexNumber            `json:"end"`
+	Cycles    int                  `json:"cycles"`    //cycles taken to reach End
+	Registers map[string]hexNumber `json:"registers"` //A, X, Y, SP, SR
+	Flags     map[string]bool      `json:"flags"`     //N, V, B, D, I, Z, C
+	Memory    map[string]hexNumber `json:"memory"`    //address -> byte
+}
+
+var flagBits = map[string]uint8{"N": NF, "V": OF, "B": BF, "D": DF, "I": IF, "Z": ZF, "C": CF}
+
+// runs every program listed in the TestBinary manifests
+func TestBinaries(t *testing.T) {
+	manifests, err := filepath.Glob("../TestBinary/*/manifest.json")
+	if err != nil || len(manifests) == 0 {
+		t.Fatalf("couldn't find any manifests: %v", err)
+	}
+	for _, manifest := range manifests {
+		data, err := os.ReadFile(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tests []binaryTest
+		if err := json.Unmarshal(data, &tests); err != nil {
+			t.Fatalf("couldn't parse %s: %s", manifest, err)
+		}
+		dir := filepath.Dir(manifest)
+		for _, test := range tests {
+			test := test
+			t.Run(filepath.Base(dir)+"/"+test.Binary, func(t *testing.T) {
+				runBinaryTest(t, filepath.Join(dir, test.Binary), test)
+			})
+		}
+	}
+}
+
+func runBinaryTest(t *testing.T, path string, test binaryTest) {
+	binary, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := CreateFlatBus(NES2A03)
+	if err := bus.Load(binary, uint16(test.Load)); err != nil {
+		t.Fatal(err)
+	}
+	cpu := bus.CPU
+	cpu.PowerOn()
+	if test.Start != 0 {
+		cpu.PC = uint16(test.Start)
+	}
+	cycles := 0
+	for cpu.PC != uint16(test.End) {
+		if cycles > binaryTestMaxCycles {
+			t.Fatalf("PC didn't reach $%04X after %d cycles, PC = $%04X", test.End, cycles, cpu.PC)
+		}
+		step, err := bus.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cycles += step.Cycles
+	}
+	if test.Cycles != 0 && cycles != test.Cycles {
+		t.Errorf("took %d cycles, expected %d", cycles, test.Cycles)
+	}
+	registers := map[string]uint8{"A": cpu.AC, "X": cpu.X, "Y": cpu.Y, "SP": cpu.SP, "SR": cpu.SR}
+	for name, expected := range test.Registers {
+		value, ok := registers[name]
+		if !ok {
+			t.Fatalf("unknown register %q in manifest", name)
+		}
+		if value != uint8(expected) {
+			t.Errorf("%s = $%02X, expected $%02X", name, value, expected)
+		}
+	}
+	for name, expected := range test.Flags {
+		bit, ok := flagBits[name]
+		if !ok {
+			t.Fatalf("unknown flag %q in manifest", name)
+		}
+		if cpu.GetFlag(bit) != expected {
+			t.Errorf("flag %s = %t, expected %t", name, cpu.GetFlag(bit), expected)
+		}
+	}
+	for addrText, expected := range test.Memory {
+		addr, err := strconv.ParseUint(addrText, 0, 16)
+		if err != nil {
+			t.Fatalf("invalid address %q in manifest", addrText)
+		}
+		if value := bus.Memory[addr]; value != uint8(expected) {
+			t.Errorf("memory $%04X = $%02X, expected $%02X", addr, value, expected)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package nes
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+Trace
+writes the cpu's state before every instruction in the format of nestest.log,
+the golden log of nestest.nes recorded with Nintendulator:
+C000  4C F5 C5  JMP $C5F5                       A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7
+*/
+
+const (
+	ppuDotsPerCycle    = 3
+	ppuDotsPerLine     = 341
+	ppuLinesPerFrame   = 262
+	traceInstrTextSize = 32
+)
+
+// peeker is a bus that can be read without side effects
+type peeker interface {
+	PeekCPUByte(addr uint16) uint8
+}
+
+// peekBus reads through PeekCPUByte when the bus has it so tracing doesn't disturb the system
+type peekBus struct {
+	Bus
+}
+
+func (bus peekBus) GetCPUByte(addr uint16) uint8 {
+	if peek, ok := bus.Bus.(peeker); ok {
+		return peek.PeekCPUByte(addr)
+	}
+	return bus.Bus.GetCPUByte(addr)
+}
+
+// TraceLine returns the instruction at the cpu's PC and the cpu's state as a nestest.log line.
+// The PPU dot and scanline are worked out from the cpu's cycle count
+func TraceLine(cpu *CPU) string {
+	bus := peekBus{cpu.Bus}
+	instr := variantNameTable(cpu.Variant)[bus.GetCPUByte(cpu.PC)]
+	size, _ := instr.addrMode.format(cpu.PC+1, bus)
+	var instrBytes []string
+	for i := 0; i < size; i++ {
+		instrBytes = append(instrBytes, fmt.Sprintf("%02X", bus.GetCPUByte(cpu.PC+uint16(i))))
+	}
+	text := strings.TrimSpace(instr.mnemonic(StyleNestest) + " " + traceOperand(cpu, bus, instr))
+	if !strings.HasPrefix(text, "*") {
+		text = " " + text //undocumented opcodes put their * in this column
+	}
+	dots := cpu.Cycles * ppuDotsPerCycle
+	return fmt.Sprintf("%04X  %-8s %-*s A:%02X X:%02X Y:%02X P:%02X SP:%02X PPU:%3d,%3d CYC:%d",
+		cpu.PC, strings.Join(instrBytes, " "), traceInstrTextSize, text, cpu.AC, cpu.X, cpu.Y, cpu.SR, cpu.SP,
+		dots/ppuDotsPerLine%ppuLinesPerFrame, dots%ppuDotsPerLine, cpu.Cycles)
+}
+
+// traceOperand writes the operand with the address it resolves to and the value there before the instruction runs
+func traceOperand(cpu *CPU, bus Bus, instr opCodeAndAddrMode) string {
+	addr := cpu.PC + 1
+	zp := bus.GetCPUByte(addr)
+	abs := readWord(bus, addr)
+	switch instr.addrMode {
+	case zeroPage:
+		return fmt.Sprintf("$%02X = %02X", zp, bus.GetCPUByte(uint16(zp)))
+	case zeroPageX:
+		effective := zp + cpu.X
+		return fmt.Sprintf("$%02X,X @ %02X = %02X", zp, effective, bus.GetCPUByte(uint16(effective)))
+	case zeroPageY:
+		effective := zp + cpu.Y
+		return fmt.Sprintf("$%02X,Y @ %02X = %02X", zp, effective, bus.GetCPUByte(uint16(effective)))
+	case absolute:
+		if instr.name == "JMP" || instr.name == "JSR" {
+			return fmt.Sprintf("$%04X", abs)
+		}
+		return fmt.Sprintf("$%04X = %02X", abs, bus.GetCPUByte(abs))
+	case absoluteX:
+		effective := abs + uint16(cpu.X)
+		return fmt.Sprintf("$%04X,X @ %04X = %02X", abs, effective, bus.GetCPUByte(effective))
+	case absoluteY:
+		effective := abs + uint16(cpu.Y)
+		return fmt.Sprintf("$%04X,Y @ %04X = %02X", abs, effective, bus.GetCPUByte(effective))
+	case indirect:
+		//the NMOS cpu doesn't carry into the high byte of the pointer
+		high := abs&0xFF00 | (abs+1)&0x00FF
+		if cpu.Variant == CMOS65C02 {
+			high = abs + 1
+		}
+		target := uint16(bus.GetCPUByte(high))<<8 | uint16(bus.GetCPUByte(abs))
+		return fmt.Sprintf("($%04X) = %04X", abs, target)
+	case indexIndirect:
+		pointer := zp + cpu.X
+		effective := zeroPageWord(bus, pointer)
+		return fmt.Sprintf("($%02X,X) @ %02X = %04X = %02X", zp, pointer, effective, bus.GetCPUByte(effective))
+	case indirectIndex:
+		base := zeroPageWord(bus, zp)
+		effective := base + uint16(cpu.Y)
+		return fmt.Sprintf("($%02X),Y = %04X @ %04X = %02X", zp, base, effective, bus.GetCPUByte(effective))
+	}
+	_, operand := instr.addrMode.format(addr, bus)
+	return operand
+}
+
+// zeroPageWord reads a pointer from the zero page, the high byte wraps around within the page
+func zeroPageWord(bus Bus, pointer uint8) uint16 {
+	return uint16(bus.GetCPUByte(uint16(pointer+1)))<<8 | uint16(bus.GetCPUByte(uint16(pointer)))
+}
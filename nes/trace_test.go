@@ -0,0 +1,39 @@
+package nes
+
+import "testing"
+
+func TestTraceLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		pc      uint16
+		memory  map[uint16]uint8
+		a, x, y uint8
+		sr, sp  uint8
+		cycles  uint64
+		line    string
+	}{
+		//the first instructions of nestest.log
+		{"JMP absolute", 0xC000, map[uint16]uint8{0xC000: 0x4C, 0xC001: 0xF5, 0xC002: 0xC5}, 0x00, 0x00, 0x00, 0x24, 0xFD, 7,
+			"C000  4C F5 C5  JMP $C5F5                       A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7"},
+		{"STX zero page", 0xC5F7, map[uint16]uint8{0xC5F7: 0x86, 0xC5F8: 0x00}, 0x00, 0x00, 0x00, 0x26, 0xFD, 12,
+			"C5F7  86 00     STX $00 = 00                    A:00 X:00 Y:00 P:26 SP:FD PPU:  0, 36 CYC:12"},
+		//in the same format, a pointer of $04FF plus Y crosses into page 5
+		{"LDA (zp),Y page cross", 0xD959, map[uint16]uint8{0xD959: 0xB1, 0xD95A: 0x33, 0x33: 0xFF, 0x34: 0x04, 0x0500: 0x5A}, 0x00, 0x00, 0x01, 0x24, 0xFB, 27393,
+			"D959  B1 33     LDA ($33),Y = 04FF @ 0500 = 5A  A:00 X:00 Y:01 P:24 SP:FB PPU:240,339 CYC:27393"},
+		{"undocumented NOP", 0xE000, map[uint16]uint8{0xE000: 0x04, 0xE001: 0xA9}, 0xAA, 0x97, 0x4E, 0xEF, 0xF5, 89341,
+			"E000  04 A9    *NOP $A9 = 00                    A:AA X:97 Y:4E P:EF SP:F5 PPU:261,338 CYC:89341"},
+		{"STA (zp,X)", 0xE002, map[uint16]uint8{0xE002: 0x81, 0xE003: 0x7E, 0x80: 0x00, 0x81: 0x02, 0x0200: 0x7F}, 0x7F, 0x02, 0x00, 0x24, 0xFB, 400,
+			"E002  81 7E     STA ($7E,X) @ 80 = 0200 = 7F    A:7F X:02 Y:00 P:24 SP:FB PPU:  3,177 CYC:400"},
+	}
+	for _, test := range tests {
+		bus := CreateFlatBus(NES2A03)
+		for addr, value := range test.memory {
+			bus.Memory[addr] = value
+		}
+		cpu := bus.CPU
+		cpu.PC, cpu.AC, cpu.X, cpu.Y, cpu.SR, cpu.SP, cpu.Cycles = test.pc, test.a, test.x, test.y, test.sr, test.sp, test.cycles
+		if line := TraceLine(cpu); line != test.line {
+			t.Errorf("%s:\n     got: %s\nexpected: %s", test.name, line, test.line)
+		}
+	}
+}
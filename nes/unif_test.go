@@ -0,0 +1,107 @@
+package nes
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// unifChunk builds a UNIF chunk, the id, a 4 byte length then the data
+func unifChunk(id string, data []byte) []byte {
+	chunk := append([]byte(id), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(data)))
+	return append(chunk, data...)
+}
+
+// createTestUNIF builds a UNIF file from a 32 byte header and chunks
+func createTestUNIF(chunks ...[]byte) []byte {
+	rom := make([]byte, 32)
+	copy(rom, unifMagic)
+	rom[4] = 7 //revision
+	for _, chunk := range chunks {
+		rom = append(rom, chunk...)
+	}
+	return rom
+}
+
+func filledBytes(size int, value byte) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = value
+	}
+	return data
+}
+
+func TestParseUNIF(t *testing.T) {
+	rom := createTestUNIF(
+		unifChunk("MAPR", []byte("NES-NROM-256\x00")),
+		unifChunk("NAME", []byte("Test\x00")),
+		unifChunk("PRG1", filledBytes(16*1024, 0x22)), //chunks are joined in numbered order, not file order
+		unifChunk("PRG0", filledBytes(16*1024, 0x11)),
+		unifChunk("CHR0", filledBytes(8*1024, 0x33)),
+		unifChunk("MIRR", []byte{1}),
+		unifChunk("BATR", []byte{1}),
+		unifChunk("TVCI", []byte{1}),
+	)
+	cart, err := CreateCartFromBytes(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cart.Format != FormatUNIF || cart.BoardName != "NES-NROM-256" || cart.MapperNumber != 0 {
+		t.Errorf("board %q mapper %d format %v", cart.BoardName, cart.MapperNumber, cart.Format)
+	}
+	if cart.PRGRomSize != 32*1024 || cart.PRGRom[0] != 0x11 || cart.PRGRom[16*1024] != 0x22 {
+		t.Errorf("%d bytes of PRG Rom starting with %02X, second bank %02X", cart.PRGRomSize, cart.PRGRom[0], cart.PRGRom[16*1024])
+	}
+	if cart.CHRRomSize != 8*1024 || cart.CHRRamSize != 0 || cart.CHRRom[0] != 0x33 {
+		t.Errorf("%d bytes of CHR Rom, %d of CHR Ram", cart.CHRRomSize, cart.CHRRamSize)
+	}
+	if !cart.MirrorVertically || !cart.HasBatteryRam || cart.Region != RegionPAL || cart.PRGRamSize != 8192 {
+		t.Errorf("vertical %t, battery %t, region %v, %d bytes of PRG Ram", cart.MirrorVertically, cart.HasBatteryRam, cart.Region, cart.PRGRamSize)
+	}
+}
+
+func TestParseUNIFErrors(t *testing.T) {
+	mapr := unifChunk("MAPR", []byte("NES-NROM-128"))
+	prg0 := unifChunk("PRG0", filledBytes(16*1024, 0xEA))
+	truncated := createTestUNIF(mapr, prg0)
+	tests := []struct {
+		name string
+		rom  []byte
+		err  string
+	}{
+		{"truncated header", createTestUNIF()[:31], "header is truncated"},
+		{"truncated chunk header", append(createTestUNIF(mapr, prg0), 'C', 'H', 'R'), "chunk at 0x"},
+		{"truncated chunk data", truncated[:len(truncated)-1], "PRG0 chunk is truncated"},
+		{"missing MAPR", createTestUNIF(prg0), "no MAPR chunk"},
+		{"unknown board", createTestUNIF(unifChunk("MAPR", []byte("UNL-NOTABOARD")), prg0), "unsupported UNIF board: UNL-NOTABOARD"},
+		{"missing PRG0", createTestUNIF(mapr, unifChunk("PRG1", filledBytes(16*1024, 0xEA))), "no PRG0 chunk"},
+	}
+	for _, test := range tests {
+		_, err := CreateCartFromBytes(test.rom)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: returned %v, expected %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestUNIFBoardMapper(t *testing.T) {
+	tests := []struct {
+		board  string
+		mapper uint16
+		ok     bool
+	}{
+		{"NROM", 0, true},
+		{"NES-SLROM", 1, true},
+		{"hvc-tlrom", 4, true},
+		{"NES-NROM-128", 0, true},
+		{"UNL-NOTABOARD", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		mapper, ok := unifBoardMapper(test.board)
+		if mapper != test.mapper || ok != test.ok {
+			t.Errorf("%q is mapper %d (%t), expected %d (%t)", test.board, mapper, ok, test.mapper, test.ok)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package nes
+
+// level of one VRC6 output step relative to the APU's full scale output
+// (a VRC6 pulse at volume 15 is about as loud as an APU pulse at volume 15)
+const vrc6MixLevel = 0.00996
+
+// vrc6Pulse is one of the VRC6's two pulse channels
+// 16 step sequence with 8 duty cycles, or a constant level in digitized mode
+type vrc6Pulse struct {
+	enabled   bool
+	digitized bool  // $9000 bit 7, outputs the volume regardless of duty
+	duty      uint8 // high for steps 0-duty
+	volume    uint8
+	period    uint16 // 12 bits
+	timer     uint16
+	step      uint8
+}
+
+func (pulse *vrc6Pulse) writeRegister(reg uint16, value uint8) {
+	switch reg {
+	case 0:
+		pulse.digitized = getBit(7, value)
+		pulse.duty = (value >> 4) & 0x7
+		pulse.volume = value & 0x0F
+	case 1:
+		pulse.period = pulse.period&0x0F00 | uint16(value)
+	case 2:
+		pulse.period = pulse.period&0x00FF | uint16(value&0x0F)<<8
+		pulse.enabled = getBit(7, value)
+		if !pulse.enabled {
+			pulse.step = 0
+		}
+	}
+}
+
+func (pulse *vrc6Pulse) clock(shift uint8) {
+	if !pulse.enabled {
+		return
+	}
+	if pulse.timer > 0 {
+		pulse.timer--
+		return
+	}
+	pulse.timer = pulse.period >> shift
+	pulse.step = (pulse.step + 1) & 0x0F
+}
+
+func (pulse *vrc6Pulse) output() uint8 {
+	if !pulse.enabled || (!pulse.digitized && pulse.step > pulse.duty) {
+		return 0
+	}
+	return pulse.volume
+}
+
+// vrc6Saw is the VRC6's sawtooth channel, an accumulator that has its
+// rate added every other clock and is reset after 7 additions
+type vrc6Saw struct {
+	enabled     bool
+	rate        uint8 // 6 bits
+	period      uint16
+	timer       uint16
+	step        uint8
+	accumulator uint8
+}
+
+func (saw *vrc6Saw) writeRegister(reg uint16, value uint8) {
+	switch reg {
+	case 0:
+		saw.rate = value & 0x3F
+	case 1:
+		saw.period = saw.period&0x0F00 | uint16(value)
+	case 2:
+		saw.period = saw.period&0x00FF | uint16(value&0x0F)<<8
+		saw.enabled = getBit(7, value)
+		if !saw.enabled {
+			saw.step = 0
+			saw.accumulator = 0
+		}
+	}
+}
+
+func (saw *vrc6Saw) clock(shift uint8) {
+	if !saw.enabled {
+		return
+	}
+	if saw.timer > 0 {
+		saw.timer--
+		return
+	}
+	saw.timer = saw.period >> shift
+	saw.step++
+	if saw.step >= 14 {
+		saw.step = 0
+		saw.accumulator = 0
+	} else if saw.step&1 == 0 {
+		saw.accumulator += saw.rate
+	}
+}
+
+func (saw *vrc6Saw) output() uint8 {
+	return saw.accumulator >> 3 //top 5 bits
+}
+
+// VRC6Audio is Konami's VRC6 expansion sound, two pulses and a sawtooth
+type VRC6Audio struct {
+	pulse1 vrc6Pulse
+	pulse2 vrc6Pulse
+	saw    vrc6Saw
+	halt   bool  // $9003 bit 0
+	shift  uint8 // $9003 bits 1-2, divides every period by 16 or 256
+}
+
+func createVRC6Audio() *VRC6Audio {
+	return new(VRC6Audio)
+}
+
+// writeRegister handles writes to $9000-$9003, $A000-$A002 and $B000-$B002
+// (VRC6a wiring, VRC6b boards swap address lines 0 and 1 before calling this)
+func (audio *VRC6Audio) writeRegister(addr uint16, value uint8) {
+	reg := addr & 0x3
+	switch addr & 0xF000 {
+	case 0x9000:
+		if reg == 3 {
+			audio.halt = getBit(0, value)
+			audio.shift = 0
+			if getBit(2, value) {
+				audio.shift = 8
+			} else if getBit(1, value) {
+				audio.shift = 4
+			}
+			return
+		}
+		audio.pulse1.writeRegister(reg, value)
+	case 0xA000:
+		audio.pulse2.writeRegister(reg, value)
+	case 0xB000:
+		audio.saw.writeRegister(reg, value)
+	}
+}
+
+// clock advances the channels by one cpu cycle
+func (audio *VRC6Audio) clock() {
+	if audio.halt {
+		return
+	}
+	audio.pulse1.clock(audio.shift)
+	audio.pulse2.clock(audio.shift)
+	audio.saw.clock(audio.shift)
+}
+
+// Output returns the mixed level of the three channels, scaled to the APU's output
+func (audio *VRC6Audio) Output() float32 {
+	sum := int(audio.pulse1.output()) + int(audio.pulse2.output()) + int(audio.saw.output())
+	return float32(sum) * vrc6MixLevel
+}
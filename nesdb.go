@@ -3,37 +3,86 @@
 // CLI debugger for debugging the 6502 emulation
 // supports printing registers and examining memory.
 // Uses same format specifers as GDB
+// flags:
+// --rom=<path to .nes rom>
+// --autopatch, applies <rom>.ips, <rom>.ups and <rom>.bps patches found next to the rom before loading it
+// --bios=<path to disksys.rom>, FDS BIOS used to run .fds disk images
+// --nestest-style, disassembles undocumented opcodes like nestest.log (*NOP, *ISB)
+// --binary=<path to raw binary>, runs a 6502 binary on a flat 64KB bus instead of a rom
+// --load=<address>, address to load the binary at (default 0x0000)
+// --reset=<address>, address to start the binary at, written to the reset vector ($FFFC)
+// --cpu=<2a03 | 6502 | 65c02>, cpu variant to emulate (default 2a03)
+// --trace, prints a nestest.log style line before every instruction run by ni and run
+// --ram=<zeros | ff | random>, what internal and cartridge ram hold at power on (default zeros)
+// --seed=<number>, seed for --ram=random (default picked from the clock and printed)
+// --labels=<path to ld65 -Ln label file>, names breakpoints can be set on (EX: b main)
+// --rewind=<megabytes>, memory the rewind snapshots can use, 0 turns rewind off (default 32)
 // format specifiers: x (hex), b(binary), i (instruction), d (decimal, default value if not specified)
 // valid number formats: 0xFFFF (hex), 0b0001 (binary), 1234 (decimal, default)
 // valid commands:
 // set <register or address> = <hex, binary, or decimal number>
 // x, prints content in memory at provided address. Either literal number address of pc for program counter
-// p, prints the contents of the bus.CPU's register: ex p x prints the x register
+// p, prints the contents of the CPU's register: ex p x prints the x register
 // cur, prints the current instruction and how many cycles remaining in the execution of the instruction
-// clock, clocks the bus.CPU
+// clock, clocks the CPU
 // ni, executes next instruction
+// run, c (continue), runs until a breakpoint is hit, the cpu halts or PC gets stuck in a trap loop
+// b (break) <address or label>, adds a breakpoint, labels come from --labels or are nmi, reset and irq (the vectors)
+// tbreak <address or label>, adds a breakpoint that is deleted once it is hit
+// d (delete) [number...], deletes breakpoints (all of them if no numbers are given)
+// disable [number...], enable [number...], disables or enables breakpoints (all of them if no numbers are given)
+// ignore <number> <count>, lets the next count hits of a breakpoint through
+// info breakpoints, lists the breakpoints with their hit and ignore counts
+// reset, presses the reset button (recovers the cpu after it halts), RAM is kept
+// power, turns the console off and on, RAM is filled with the --ram pattern
+// frame [count], runs until the start of the next frame (count frames)
+// save [slot], saves the console's state to slot 0-9 (0 by default), kept next to the rom as <rom>.state<slot>
+// load [slot], loads the state saved in a slot, states saved for another rom are refused
+// rewind [frames], goes back to the start of the frame (frames-1 frames before the current one)
+// rsi (reverse-stepi) [count], steps back count instructions (1 by default)
+// rc (reverse-continue), runs backwards to the previous breakpoint hit or the start of the rewind history
+// trace, toggles printing a nestest.log style line before every instruction
+// info [json], prints information about the loaded rom
+// disk [insert <side> | eject], swaps FDS disk sides
 // clear, clears the terminal
 // quit, quits the application
 package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/MaxSmoot/NES_Emulator/nes"
 )
 
-var bus *nes.NesSystem
+// system is what the debugger runs, the NES or a flat 64KB bus
+type system interface {
+	nes.Bus
+	Clock() error
+	Step() (nes.StepInfo, error)
+	PeekCPUByte(addr uint16) uint8
+}
+
+var bus system
+var cpu *nes.CPU
+var console *nes.Console //nil when running a raw binary
+var romFile string       //path of the loaded rom, save states are kept next to it
+var disassemblyStyle = nes.StyleDefault
+var tracing = false //print nes.TraceLine before each instruction
 
-// loadBinary loads the binary specified by --binary into memory
+// loadBinary loads the binary specified by --binary into a flat 64KB bus
 // at the starting address specified by -load flag
-func loadBinary(path string, loadAddr uint16) bool {
+func loadBinary(path string, loadAddr uint16, variant nes.CPUVariant) bool {
 
 	file, err := os.Open(path)
 	if err != nil {
@@ -45,14 +94,30 @@ func loadBinary(path string, loadAddr uint16) bool {
 		fmt.Println("Error Reading file")
 		return false
 	}
-	if len(buf) > nes.MemorySize {
-		fmt.Println("File exceeds 65KB")
+	flatBus := nes.CreateFlatBus(variant)
+	if err := flatBus.Load(buf, loadAddr); err != nil {
+		fmt.Println(err)
 		return false
 	}
-	fmt.Printf("%d bytes loaded\n", copy(bus.CPU.Bus.Memory[loadAddr:], buf))
+	fmt.Printf("%d bytes loaded at 0x%04X\n", len(buf), loadAddr)
+	bus = flatBus
+	cpu = flatBus.CPU
 	return true
 }
 
+// parseVariant returns the cpu variant named by --cpu
+func parseVariant(name string) (nes.CPUVariant, error) {
+	switch strings.ToLower(name) {
+	case "2a03", "nes":
+		return nes.NES2A03, nil
+	case "6502", "nmos":
+		return nes.NMOS6502, nil
+	case "65c02", "cmos":
+		return nes.CMOS65C02, nil
+	}
+	return 0, fmt.Errorf("unknown cpu %q, expected 2a03, 6502 or 65c02", name)
+}
+
 // boolToUint8 returns the provided bool as a uint8
 // false = 0
 // true = 0x1
@@ -161,7 +226,7 @@ func printMemCmd(args []string) {
 	}
 	var address uint16
 	if strings.ToLower(args[1]) == "pc" {
-		address = bus.CPU.PC
+		address = cpu.PC
 	} else {
 		num, err := getNumberArgument(args[1])
 		if err != nil {
@@ -173,7 +238,7 @@ func printMemCmd(args []string) {
 	if format == "i" {
 		offset := 0
 		for i := 0; i < numBytes; i++ {
-			instr, size := nes.DiassembleInstruction(bus.CPU.Bus, address+uint16(offset))
+			instr, size := nes.DisassembleInstructionStyle(bus, address+uint16(offset), disassemblyStyle)
 			fmt.Printf("0x%04X:\t%s\n", address+uint16(offset), instr)
 			offset += size
 		}
@@ -183,13 +248,13 @@ func printMemCmd(args []string) {
 		if i%8 == 0 {
 			fmt.Printf("\n0x%04X:\t", address+i)
 		}
-		fmt.Printf(format+" ", bus.CPU.Bus.GetCPUByte(address+i))
+		fmt.Printf(format+" ", bus.PeekCPUByte(address+i))
 	}
 	fmt.Println()
 
 }
 
-// printCmd prints the value stored in a bus.CPU register
+// printCmd prints the value stored in a CPU register
 // command is p</format> <register name>
 // ignores number of bytes specified. EX: p/10x is the same as p/x
 // this is for code reuse
@@ -219,34 +284,34 @@ func printCmd(args []string) {
 	switch strings.ToUpper(args[1]) {
 	//currently, printing the program counter will ignore the format and always print in HEX
 	case "PC":
-		fmt.Printf("0x%04X\n", bus.CPU.PC)
+		fmt.Printf("0x%04X\n", cpu.PC)
 		return
 	case "X":
-		value = bus.CPU.X
+		value = cpu.X
 	case "Y":
-		value = bus.CPU.Y
+		value = cpu.Y
 	case "AC":
-		value = bus.CPU.AC
+		value = cpu.AC
 	case "SR":
-		value = bus.CPU.SR
+		value = cpu.SR
 	case "S":
-		value = bus.CPU.SP
+		value = cpu.SP
 	case "CF":
-		value = boolToUint8(bus.CPU.GetFlag(nes.CF))
+		value = boolToUint8(cpu.GetFlag(nes.CF))
 	case "ZF":
-		value = boolToUint8(bus.CPU.GetFlag(nes.ZF))
+		value = boolToUint8(cpu.GetFlag(nes.ZF))
 	case "IF":
-		value = boolToUint8(bus.CPU.GetFlag(nes.IF))
+		value = boolToUint8(cpu.GetFlag(nes.IF))
 	case "DF":
-		value = boolToUint8(bus.CPU.GetFlag(nes.DF))
+		value = boolToUint8(cpu.GetFlag(nes.DF))
 	case "OF":
-		value = boolToUint8(bus.CPU.GetFlag(nes.OF))
+		value = boolToUint8(cpu.GetFlag(nes.OF))
 	case "NF":
-		value = boolToUint8(bus.CPU.GetFlag(nes.NF))
+		value = boolToUint8(cpu.GetFlag(nes.NF))
 	case "BF":
-		value = boolToUint8(bus.CPU.GetFlag(nes.BF))
+		value = boolToUint8(cpu.GetFlag(nes.BF))
 	case "OP":
-		fmt.Printf("0x%04X\n", bus.CPU.OperandAddr)
+		fmt.Printf("0x%04X\n", cpu.OperandAddr)
 		return
 	default:
 		fmt.Println("Can't print " + args[1])
@@ -267,17 +332,17 @@ func setRegister(target string, value uint16) (bool, error) {
 	}
 	switch target {
 	case "pc":
-		bus.CPU.PC = value
+		cpu.PC = value
 	case "x":
-		bus.CPU.X = uint8(value)
+		cpu.X = uint8(value)
 	case "y":
-		bus.CPU.Y = uint8(value)
+		cpu.Y = uint8(value)
 	case "ac":
-		bus.CPU.AC = uint8(value)
+		cpu.AC = uint8(value)
 	case "sp":
-		bus.CPU.SP = uint8(value)
+		cpu.SP = uint8(value)
 	case "sr":
-		bus.CPU.SR = uint8(value)
+		cpu.SR = uint8(value)
 	default:
 		return false, nil
 	}
@@ -317,7 +382,7 @@ func setCmd(cmd string) {
 		fmt.Println(err)
 		return
 	}
-	bus.CPU.Bus.SetCPUByte(targetAddr, convertedVal)
+	bus.SetCPUByte(targetAddr, convertedVal)
 }
 
 func Btoi(b bool) int {
@@ -327,50 +392,389 @@ func Btoi(b bool) int {
 	return 0
 }
 
+// diskCmd inserts, ejects or shows the inserted FDS disk side
+// disk, prints the inserted side
+// disk insert <side>, inserts a side (sides are numbered from 0, disk 1 side A = 0, side B = 1...)
+// disk eject, ejects the disk
+func diskCmd(args []string) {
+	if console == nil {
+		fmt.Println("No rom loaded")
+		return
+	}
+	fds := console.System.Cart.FDS()
+	if fds == nil {
+		fmt.Println("Loaded rom isn't an FDS disk image")
+		return
+	}
+	if len(args) == 1 {
+		if fds.InsertedSide() < 0 {
+			fmt.Printf("No disk inserted (%d sides)\n", fds.DiskSides())
+			return
+		}
+		fmt.Printf("Side %d of %d inserted\n", fds.InsertedSide(), fds.DiskSides())
+		return
+	}
+	switch strings.ToLower(args[1]) {
+	case "eject":
+		fds.EjectDisk()
+	case "insert":
+		if len(args) != 3 {
+			fmt.Println("Usage: disk insert <side>")
+			return
+		}
+		side, err := getNumberArgument(args[2])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := fds.InsertDisk(int(side)); err != nil {
+			fmt.Println(err)
+		}
+	default:
+		fmt.Println("Usage: disk [insert <side> | eject]")
+	}
+}
+
+// stateSlots is the number of save state slots per rom
+const stateSlots = 10
+
+// statePath returns the file a save state slot is kept in, next to the rom (EX: roms/game.state1)
+func statePath(slot uint16) string {
+	return strings.TrimSuffix(romFile, filepath.Ext(romFile)) + fmt.Sprintf(".state%d", slot)
+}
+
+// stateCmd saves or loads the console's state
+// save [slot], load [slot], slot 0 by default
+func stateCmd(args []string) {
+	if console == nil {
+		fmt.Println("No rom loaded")
+		return
+	}
+	slot := uint16(0)
+	if len(args) > 1 {
+		var err error
+		if slot, err = getNumberArgument(args[1]); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if slot >= stateSlots {
+		fmt.Printf("Slot must be 0-%d\n", stateSlots-1)
+		return
+	}
+	path := statePath(slot)
+	if args[0] == "save" {
+		file, err := os.Create(path)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer file.Close()
+		if err := console.SaveState(file); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("Saved slot %d to %s\n", slot, path)
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("Slot %d is empty\n", slot)
+		return
+	}
+	defer file.Close()
+	if err := console.LoadState(bufio.NewReader(file)); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Loaded slot %d from %s\n", slot, path)
+	printCurrentInstr()
+}
+
+// rewindCmd steps the console back a number of frames
+// rewind [frames]
+func rewindCmd(args []string) {
+	if console == nil {
+		fmt.Println("No rom loaded")
+		return
+	}
+	frames := uint16(1)
+	if len(args) > 1 {
+		var err error
+		if frames, err = getNumberArgument(args[1]); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if err := console.Rewind(int(frames)); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Frame %d, scanline %d, dot %d (%d frames saved)\n", console.Frame(), console.Scanline(), console.Dot(), console.RewindFrames())
+	printCurrentInstr()
+}
+
+// reverseStepCmd steps the console back a number of instructions
+// rsi [count]
+func reverseStepCmd(args []string) {
+	if console == nil {
+		fmt.Println("No rom loaded")
+		return
+	}
+	count := uint16(1)
+	if len(args) > 1 {
+		var err error
+		if count, err = getNumberArgument(args[1]); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	for i := uint16(0); i < count; i++ {
+		if err := console.ReverseStep(); err != nil {
+			fmt.Println(err)
+			break
+		}
+	}
+	printCurrentInstr()
+}
+
+// reverseContinueCmd runs the console backwards until it reaches an enabled breakpoint
+// or the start of the rewind history, hit and ignore counts are left alone
+func reverseContinueCmd() {
+	if console == nil {
+		fmt.Println("No rom loaded")
+		return
+	}
+	stop := func(console *nes.Console) bool { return breakAt[console.System.CPU.PC] }
+	if err := console.ReverseUntil(stop); err != nil {
+		fmt.Println(err)
+	} else {
+		for _, bp := range breakpoints {
+			if bp.enabled && bp.addr == cpu.PC {
+				printBreakpointHit(bp)
+				break
+			}
+		}
+	}
+	printCurrentInstr()
+}
+
+// frameCmd runs the console for a number of frames
+// frame [count]
+func frameCmd(args []string) {
+	if console == nil {
+		fmt.Println("No rom loaded")
+		return
+	}
+	count := uint16(1)
+	if len(args) > 1 {
+		var err error
+		if count, err = getNumberArgument(args[1]); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	for i := uint16(0); i < count; i++ {
+		if err := console.RunFrame(); err != nil {
+			printFault(err)
+			break
+		}
+	}
+	fmt.Printf("Frame %d, scanline %d, dot %d\n", console.Frame(), console.Scanline(), console.Dot())
+	printCurrentInstr()
+}
+
+// powerCmd power cycles the console, a binary keeps its memory and only the cpu powers on
+func powerCmd() {
+	if console != nil {
+		console.PowerCycle()
+	} else {
+		cpu.PowerOn()
+	}
+	printCurrentInstr()
+}
+
+// infoCmd prints information about the loaded rom or the breakpoints
+// info [cart] [json], info breakpoints
+func infoCmd(args []string) {
+	if len(args) > 1 && (args[1] == "b" || args[1] == "break" || args[1] == "breakpoints") {
+		printBreakpoints()
+		return
+	}
+	asJSON := false
+	for _, arg := range args[1:] {
+		switch strings.ToLower(arg) {
+		case "cart", "rom":
+		case "json":
+			asJSON = true
+		default:
+			fmt.Println("Unknown info command " + arg)
+			return
+		}
+	}
+	if console == nil {
+		fmt.Println("No rom loaded")
+		return
+	}
+	info := console.System.Cart.Info()
+	if !asJSON {
+		fmt.Println(info)
+		return
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(info); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// prints an error returned while clocking the system, the debugger keeps running
+func printFault(err error) {
+	var invalidOpcode *nes.InvalidOpcodeError
+	if errors.As(err, &invalidOpcode) {
+		fmt.Printf("CPU halted by opcode %02X at %04X, use reset to recover\n", invalidOpcode.Opcode, invalidOpcode.PC)
+		return
+	}
+	var stopped *nes.StoppedError
+	if errors.As(err, &stopped) {
+		fmt.Printf("CPU stopped by STP at %04X, use reset to recover\n", stopped.PC)
+		return
+	}
+	fmt.Println("Error:", err)
+}
+
 // uses disassembler to print the current instruction pointed to by the program counter
 func printCurrentInstr() {
-	instr, _ := nes.DiassembleInstruction(bus, bus.CPU.PC)
-	fmt.Printf("0x%04X:\t%s |\tCycles left executing previous instruction: %d\n", bus.CPU.PC, instr, bus.CPU.RemCycles)
+	instr, _ := nes.DisassembleInstructionStyle(bus, cpu.PC, disassemblyStyle)
+	fmt.Printf("0x%04X:\t%s |\tCycles left executing previous instruction: %d\n", cpu.PC, instr, cpu.RemCycles)
+}
+
+// loadRom loads the rom specified by --rom into an NES
+func loadRom(romPath string, autoPatch bool, biosPath string, variant nes.CPUVariant, ramPattern nes.RAMPattern, ramSeed int64) {
+	if romPath == "" {
+		fmt.Println("Must include a rom path. --rom=<Path to rom> (or a binary, --binary=<Path to binary>)")
+		os.Exit(1)
+	}
+	var patches []string
+	if autoPatch {
+		patches = nes.FindPatches(romPath)
+		for _, patch := range patches {
+			fmt.Println("Applying patch " + patch)
+		}
+	}
+	romBuffer, err := nes.ReadRomFile(romPath, patches)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	var cart *nes.Cartridge
+	if biosPath != "" {
+		var bios []byte
+		bios, err = os.ReadFile(biosPath)
+		if err != nil {
+			fmt.Println("Could not open BIOS " + biosPath)
+			os.Exit(1)
+		}
+		cart, err = nes.CreateFDSCart(romBuffer, bios)
+	} else {
+		cart, err = nes.CreateCartFromBytes(romBuffer)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	system := nes.CreateBusFromCart(cart)
+	if variant != nes.NES2A03 {
+		system.CPU = nes.CreateCPUVariant(system, variant)
+	}
+	system.RAMPattern = ramPattern
+	system.RAMSeed = ramSeed
+	console = nes.CreateConsoleFromSystem(system) //powers on the system
+	romFile = romPath
+	bus = console
+	cpu = system.CPU
+	fmt.Println(cart.Info())
 }
 
 func main() {
 	romPath := flag.String("rom", "", "Path to .nes rom")
+	autoPatch := flag.Bool("autopatch", false, "Apply <rom>.ips, <rom>.ups and <rom>.bps patches found alongside the rom")
+	biosPath := flag.String("bios", "", "Path to the FDS BIOS (disksys.rom), required for .fds disk images")
+	nestestStyle := flag.Bool("nestest-style", false, "Disassemble undocumented opcodes like nestest.log (*NOP, *ISB)")
+	binaryPath := flag.String("binary", "", "Path to a raw 6502 binary to run on a flat 64KB bus instead of a rom")
+	loadStr := flag.String("load", "0x0000", "Address to load the binary at")
+	resetStr := flag.String("reset", "", "Address to start the binary at, written to the reset vector")
+	cpuName := flag.String("cpu", "2a03", "CPU to emulate: 2a03, 6502 or 65c02")
+	flag.BoolVar(&tracing, "trace", false, "Print a nestest.log style line before every instruction")
+	ramStr := flag.String("ram", "zeros", "What ram holds at power on: zeros, ff or random")
+	ramSeed := flag.Int64("seed", 0, "Seed for --ram=random, picked from the clock if left out")
+	rewindMB := flag.Int("rewind", 32, "Megabytes the rewind snapshots can use, 0 turns rewind off")
+	labelsPath := flag.String("labels", "", "Path to an ld65 -Ln (VICE) label file")
 	flag.Parse()
-	if *romPath == "" {
-		fmt.Println("Must include a rom path. --rom=<Path to rom>")
+	if *nestestStyle {
+		disassemblyStyle = nes.StyleNestest
+	}
+	variant, err := parseVariant(*cpuName)
+	if err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
-	busObject, err := nes.CreateBus(*romPath)
+	if *labelsPath != "" {
+		if err := loadLabels(*labelsPath); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	ramPattern, err := nes.ParseRAMPattern(*ramStr)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	bus = busObject //command line flags
-	// binaryPathStrPtr := flag.String("binary", "", "Path to binary to load")
-
-	// loadAddr, err := getNumberArgument(*addrStrPtr)
-	// if err != nil {
-	// 	fmt.Println("Invalid load address specified")
-	// 	return
-	// }
-	// if *binaryPathStrPtr == "" {
-	// 	fmt.Println("Missing path to binary")
-	// 	fmt.Println("Usage:\n--binary=<PATH_TO_BINARY> [--load=<address to load binary>]")
-	// 	os.Exit(1)
-	// }
-
-	// if !loadBinary(*binaryPathStrPtr, loadAddr) {
-	// 	fmt.Println(*binaryPathStrPtr + " could not be loaded")
-	// 	os.Exit(1)
-	// }
-
-	bus.CPU.Reset()
-	fmt.Println("Rom Loaded.\nAwaiting Input...")
+	if ramPattern == nes.RAMRandom && *ramSeed == 0 {
+		*ramSeed = time.Now().UnixNano()
+		fmt.Printf("RAM seed: %d\n", *ramSeed)
+	}
+	if *binaryPath != "" {
+		if *romPath != "" {
+			fmt.Println("--rom and --binary can't be used together")
+			os.Exit(1)
+		}
+		loadAddr, err := getNumberArgument(*loadStr)
+		if err != nil {
+			fmt.Println("Invalid load address specified")
+			os.Exit(1)
+		}
+		if !loadBinary(*binaryPath, loadAddr, variant) {
+			fmt.Println(*binaryPath + " could not be loaded")
+			os.Exit(1)
+		}
+		if *resetStr != "" {
+			resetAddr, err := getNumberArgument(*resetStr)
+			if err != nil {
+				fmt.Println("Invalid reset address specified")
+				os.Exit(1)
+			}
+			bus.SetCPUByte(0xFFFC, uint8(resetAddr))
+			bus.SetCPUByte(0xFFFD, uint8(resetAddr>>8))
+		}
+		cpu.PowerOn()
+		fmt.Println("Binary Loaded.\nAwaiting Input...")
+	} else {
+		loadRom(*romPath, *autoPatch, *biosPath, variant, ramPattern, *ramSeed)
+		if *rewindMB > 0 {
+			console.EnableRewind(*rewindMB << 20)
+		}
+		fmt.Println("Rom Loaded.\nAwaiting Input...")
+	}
 	scanner := bufio.NewScanner(os.Stdin)
 	input := ""
 	for {
 		fmt.Print("NESDB> ")
-		scanner.Scan()
+		if !scanner.Scan() {
+			fmt.Println()
+			return //end of input
+		}
 		input = scanner.Text()
 		tokens := strings.Fields(input)
 		if len(tokens) == 0 {
@@ -383,50 +787,58 @@ func main() {
 		} else if tokens[0] == "clear" {
 			fmt.Print("\033[H\033[2J")
 		} else if tokens[0] == "ni" {
-			bus.CPU.Clock()
-			for bus.CPU.RemCycles > 0 {
-				bus.CPU.Clock()
+			if tracing {
+				fmt.Println(nes.TraceLine(cpu))
+			}
+			if _, err := bus.Step(); err != nil {
+				printFault(err)
 			}
 			printCurrentInstr()
+		} else if tokens[0] == "trace" {
+			tracing = !tracing
+			fmt.Println("Tracing:", tracing)
+		} else if tokens[0] == "reset" {
+			if console != nil {
+				console.Reset()
+			} else {
+				cpu.Reset()
+			}
+			printCurrentInstr()
+		} else if tokens[0] == "power" {
+			powerCmd()
+		} else if tokens[0] == "save" || tokens[0] == "load" {
+			stateCmd(tokens)
+		} else if tokens[0] == "rsi" || tokens[0] == "reverse-stepi" {
+			reverseStepCmd(tokens)
+		} else if tokens[0] == "rc" || tokens[0] == "reverse-continue" {
+			reverseContinueCmd()
+		} else if tokens[0] == "rewind" {
+			rewindCmd(tokens)
+		} else if tokens[0] == "frame" {
+			frameCmd(tokens)
 		} else if tokens[0] == "clock" {
-			bus.CPU.Clock()
+			if err := bus.Clock(); err != nil {
+				printFault(err)
+			}
 			printCurrentInstr()
+		} else if tokens[0] == "disk" {
+			diskCmd(tokens)
+		} else if tokens[0] == "info" {
+			infoCmd(tokens)
 		} else if tokens[0] == "quit" {
 			os.Exit(0)
 		} else if tokens[0] == "cur" {
 			printCurrentInstr()
-		} else if tokens[0] == "run" {
-			totalCycles := 0
-			var prev_pc uint16 = 0xFFFF
-			for {
-
-				// instr, size := nes.DiassembleInstruction(bus.CPU.Bus, bus.CPU.PC)
-				// var instrBytes []string
-				// for i := 0; i < 3; i++ {
-				// 	if i < size {
-				// 		instrBytes = append(instrBytes, fmt.Sprintf("%02X", bus.CPU.Bus.GetCPUByte(bus.CPU.PC+uint16(i))))
-				// 	} else {
-				// 		instrBytes = append(instrBytes, "  ")
-				// 	}
-				// }
-				// oldPc := bus.CPU.PC
-				bus.CPU.Clock()
-				if bus.CPU.PC == prev_pc {
-
-					fmt.Printf("PC stuck on %04X\n", bus.CPU.PC)
-					fmt.Println("Total Cycles", totalCycles)
-					break
-				}
-				prev_pc = bus.CPU.PC
-				totalCycles++
-				// fmt.Printf("%04X %s  %-13s |%02X %02X %02X %02X|%1b%1b%1b%1b%1b%1b|", oldPc, strings.Join(instrBytes, " "), instr, bus.CPU.AC, bus.CPU.X, bus.CPU.Y, bus.CPU.SP, Btoi(bus.CPU.GetFlag(nes.NF)), Btoi(bus.CPU.GetFlag(nes.OF)), Btoi(bus.CPU.GetFlag(nes.DF)), Btoi(bus.CPU.GetFlag(nes.IF)), Btoi(bus.CPU.GetFlag(nes.ZF)), Btoi(bus.CPU.GetFlag(nes.CF)))
-				// fmt.Println(bus.CPU.RemCycles + 1)
-				for bus.CPU.RemCycles > 0 {
-					totalCycles++
-					bus.CPU.Clock()
-				}
-
-			}
+		} else if tokens[0] == "run" || tokens[0] == "c" || tokens[0] == "continue" {
+			continueCmd()
+		} else if tokens[0] == "b" || tokens[0] == "break" || tokens[0] == "tbreak" {
+			breakCmd(tokens, tokens[0] == "tbreak")
+		} else if tokens[0] == "d" || tokens[0] == "delete" {
+			deleteCmd(tokens)
+		} else if tokens[0] == "enable" || tokens[0] == "disable" {
+			enableCmd(tokens, tokens[0] == "enable")
+		} else if tokens[0] == "ignore" {
+			ignoreCmd(tokens)
 		} else if tokens[0] == "set" {
 			setCmd(input)
 		} else {